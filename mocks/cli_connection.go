@@ -24,6 +24,9 @@ type CLIConnection struct {
 		Returns struct {
 			Service plugin_models.GetService_Model
 			Error   error
+
+			// ServicesByName, if set, is looked up instead of Service
+			ServicesByName map[string]plugin_models.GetService_Model
 		}
 	}
 
@@ -45,6 +48,20 @@ type CLIConnection struct {
 		}
 	}
 
+	GetCurrentSpaceCall struct {
+		Returns struct {
+			Space plugin_models.Space
+			Error error
+		}
+	}
+
+	GetCurrentOrgCall struct {
+		Returns struct {
+			Org   plugin_models.Organization
+			Error error
+		}
+	}
+
 	IsSSLDisabledCall struct {
 		Returns struct {
 			Disabled bool
@@ -64,6 +81,10 @@ func (c *CLIConnection) AccessToken() (string, error) {
 func (c *CLIConnection) GetService(name string) (plugin_models.GetService_Model, error) {
 	c.GetServiceCall.Receives.ServiceName = name
 
+	if c.GetServiceCall.Returns.ServicesByName != nil {
+		return c.GetServiceCall.Returns.ServicesByName[name], c.GetServiceCall.Returns.Error
+	}
+
 	return c.GetServiceCall.Returns.Service, c.GetServiceCall.Returns.Error
 }
 
@@ -80,3 +101,11 @@ func (c *CLIConnection) GetApp(name string) (plugin_models.GetAppModel, error) {
 func (c *CLIConnection) IsSSLDisabled() (bool, error) {
 	return c.IsSSLDisabledCall.Returns.Disabled, c.IsSSLDisabledCall.Returns.Error
 }
+
+func (c *CLIConnection) GetCurrentSpace() (plugin_models.Space, error) {
+	return c.GetCurrentSpaceCall.Returns.Space, c.GetCurrentSpaceCall.Returns.Error
+}
+
+func (c *CLIConnection) GetCurrentOrg() (plugin_models.Organization, error) {
+	return c.GetCurrentOrgCall.Returns.Org, c.GetCurrentOrgCall.Returns.Error
+}
@@ -0,0 +1,20 @@
+package mocks
+
+import "github.com/phopper-pivotal/autoscaling-cli-plugin/plugin"
+
+type Guardrails struct {
+	EvaluateCall struct {
+		Receives struct {
+			Subject plugin.GuardrailSubject
+		}
+		Returns struct {
+			Violations []plugin.GuardrailViolation
+		}
+	}
+}
+
+func (g *Guardrails) Evaluate(subject plugin.GuardrailSubject) []plugin.GuardrailViolation {
+	g.EvaluateCall.Receives.Subject = subject
+
+	return g.EvaluateCall.Returns.Violations
+}
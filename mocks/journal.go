@@ -0,0 +1,31 @@
+package mocks
+
+import "github.com/phopper-pivotal/autoscaling-cli-plugin/plugin"
+
+type Journal struct {
+	RecordCall struct {
+		Receives struct {
+			Entries []plugin.JournalEntry
+		}
+		Returns struct {
+			Error error
+		}
+	}
+
+	EntriesCall struct {
+		Returns struct {
+			Entries []plugin.JournalEntry
+			Error   error
+		}
+	}
+}
+
+func (j *Journal) Record(entry plugin.JournalEntry) error {
+	j.RecordCall.Receives.Entries = append(j.RecordCall.Receives.Entries, entry)
+
+	return j.RecordCall.Returns.Error
+}
+
+func (j *Journal) Entries() ([]plugin.JournalEntry, error) {
+	return j.EntriesCall.Returns.Entries, j.EntriesCall.Returns.Error
+}
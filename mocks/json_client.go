@@ -3,17 +3,20 @@ package mocks
 import (
 	"encoding/json"
 	"fmt"
+	"net/http"
 )
 
 type DoCall struct {
 	Receives struct {
 		Method       string
 		URL          string
+		Headers      http.Header
 		RequestData  interface{}
 		ResponseData interface{}
 	}
 	Returns struct {
-		Error error
+		Headers http.Header
+		Error   error
 	}
 
 	ResponseJSON string
@@ -35,20 +38,26 @@ func NewJSONClient(callCount int) *JSONClient {
 }
 
 func (c *JSONClient) Do(method string, url string, requestData interface{}, responseData interface{}) error {
+	_, err := c.DoWithHeaders(method, url, nil, requestData, responseData)
+	return err
+}
+
+func (c *JSONClient) DoWithHeaders(method string, url string, headers http.Header, requestData interface{}, responseData interface{}) (http.Header, error) {
 	call := c.DoCalls[c.DoCallCount]
 	defer func() { c.DoCallCount++ }()
 
 	call.Receives.Method = method
 	call.Receives.URL = url
+	call.Receives.Headers = headers
 	call.Receives.RequestData = requestData
 	call.Receives.ResponseData = responseData
 
 	if responseData != nil {
 		err := json.Unmarshal([]byte(call.ResponseJSON), responseData)
 		if err != nil {
-			return fmt.Errorf("Your FAKE response JSON couldn't be unmarshalled: %s", err)
+			return nil, fmt.Errorf("Your FAKE response JSON couldn't be unmarshalled: %s", err)
 		}
 	}
 
-	return call.Returns.Error
+	return call.Returns.Headers, call.Returns.Error
 }
@@ -0,0 +1,17 @@
+package mocks
+
+type TokenSource struct {
+	TokenCall struct {
+		CallCount int
+		Returns   struct {
+			Token string
+			Error error
+		}
+	}
+}
+
+func (s *TokenSource) Token() (string, error) {
+	s.TokenCall.CallCount++
+
+	return s.TokenCall.Returns.Token, s.TokenCall.Returns.Error
+}
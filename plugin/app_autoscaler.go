@@ -0,0 +1,283 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// AppAutoscalerPolicy is an app's policy in the open-source App Autoscaler.
+// Only its instance counts and CPU rules map to autoscaling settings; its
+// other rules, its schedules and any fields it doesn't model are written back
+// as they were.
+type AppAutoscalerPolicy struct {
+	InstanceMinCount int             `json:"instance_min_count"`
+	InstanceMaxCount int             `json:"instance_max_count"`
+	ScalingRules     []ScalingRule   `json:"scaling_rules,omitempty"`
+	Schedules        json.RawMessage `json:"schedules,omitempty"`
+
+	// Other holds the fields that aren't modelled, e.g. configuration
+	Other map[string]json.RawMessage `json:"-"`
+}
+
+type ScalingRule struct {
+	MetricType         string `json:"metric_type"`
+	BreachDurationSecs int    `json:"breach_duration_secs,omitempty"`
+	Threshold          int    `json:"threshold"`
+	Operator           string `json:"operator"`
+	CoolDownSecs       int    `json:"cool_down_secs,omitempty"`
+	Adjustment         string `json:"adjustment"`
+
+	Other map[string]json.RawMessage `json:"-"`
+}
+
+func (p *AppAutoscalerPolicy) UnmarshalJSON(data []byte) error {
+	type plain AppAutoscalerPolicy
+	if err := json.Unmarshal(data, (*plain)(p)); err != nil {
+		return err
+	}
+
+	var err error
+	p.Other, err = otherFields(data, "instance_min_count", "instance_max_count", "scaling_rules", "schedules")
+	return err
+}
+
+func (p AppAutoscalerPolicy) MarshalJSON() ([]byte, error) {
+	type plain AppAutoscalerPolicy
+	return marshalWithOtherFields(plain(p), p.Other)
+}
+
+func (r *ScalingRule) UnmarshalJSON(data []byte) error {
+	type plain ScalingRule
+	if err := json.Unmarshal(data, (*plain)(r)); err != nil {
+		return err
+	}
+
+	var err error
+	r.Other, err = otherFields(data, "metric_type", "breach_duration_secs", "threshold", "operator", "cool_down_secs", "adjustment")
+	return err
+}
+
+func (r ScalingRule) MarshalJSON() ([]byte, error) {
+	type plain ScalingRule
+	return marshalWithOtherFields(plain(r), r.Other)
+}
+
+// otherFields returns the fields of the JSON object in data besides known.
+func otherFields(data []byte, known ...string) (map[string]json.RawMessage, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+
+	for _, name := range known {
+		delete(fields, name)
+	}
+	if len(fields) == 0 {
+		return nil, nil
+	}
+
+	return fields, nil
+}
+
+// marshalWithOtherFields marshals v, a struct, adding the other fields.
+func marshalWithOtherFields(v interface{}, other map[string]json.RawMessage) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil || len(other) == 0 {
+		return data, err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	for name, value := range other {
+		if _, ok := fields[name]; !ok {
+			fields[name] = value
+		}
+	}
+
+	return json.Marshal(fields)
+}
+
+const cpuMetric = "cpu"
+
+func (r ScalingRule) scalesOut() bool {
+	return strings.HasPrefix(r.Operator, ">")
+}
+
+// cpuRule returns the index of the policy's first CPU rule scaling out, or
+// in, or -1 if there is none.
+func (p AppAutoscalerPolicy) cpuRule(scaleOut bool) int {
+	for i, rule := range p.ScalingRules {
+		if rule.MetricType == cpuMetric && rule.scalesOut() == scaleOut {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// Binding returns the policy's settings. A policy is always enabled, as
+// disabling autoscaling deletes it.
+func (p AppAutoscalerPolicy) Binding() AutoscalingBinding {
+	binding := AutoscalingBinding{
+		MinInstances: p.InstanceMinCount,
+		MaxInstances: p.InstanceMaxCount,
+		Enabled:      true,
+	}
+
+	if i := p.cpuRule(false); i >= 0 {
+		binding.CPUMinThreshold = p.ScalingRules[i].Threshold
+	}
+	if i := p.cpuRule(true); i >= 0 {
+		binding.CPUMaxThreshold = p.ScalingRules[i].Threshold
+	}
+
+	return binding
+}
+
+// WithBinding returns a copy of the policy with the settings of binding,
+// adding CPU rules scaling one instance at a time if it has none.
+func (p AppAutoscalerPolicy) WithBinding(binding AutoscalingBinding) AppAutoscalerPolicy {
+	p.InstanceMinCount = binding.MinInstances
+	p.InstanceMaxCount = binding.MaxInstances
+	p.ScalingRules = append([]ScalingRule(nil), p.ScalingRules...)
+
+	setThreshold := func(scaleOut bool, threshold int, rule ScalingRule) {
+		if i := p.cpuRule(scaleOut); i >= 0 {
+			p.ScalingRules[i].Threshold = threshold
+			return
+		}
+
+		rule.Threshold = threshold
+		p.ScalingRules = append(p.ScalingRules, rule)
+	}
+
+	setThreshold(false, binding.CPUMinThreshold, ScalingRule{MetricType: cpuMetric, Operator: "<", Adjustment: "-1"})
+	setThreshold(true, binding.CPUMaxThreshold, ScalingRule{MetricType: cpuMetric, Operator: ">=", Adjustment: "+1"})
+
+	return p
+}
+
+// onlySettings tells whether the policy holds nothing but the settings:
+// the instance counts and the CPU rules WithBinding would create, in either
+// order, with no other rules, schedules or fields. Recreating such a policy
+// from its settings gives the same policy.
+func (p AppAutoscalerPolicy) onlySettings() bool {
+	if len(p.Other) > 0 || len(p.ScalingRules) != 2 {
+		return false
+	}
+	if len(p.Schedules) > 0 && string(p.Schedules) != "null" {
+		return false
+	}
+
+	recreated := AppAutoscalerPolicy{}.WithBinding(p.Binding())
+	for _, scaleOut := range []bool{false, true} {
+		i := p.cpuRule(scaleOut)
+		if i < 0 || !p.ScalingRules[i].sameAs(recreated.ScalingRules[recreated.cpuRule(scaleOut)]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// sameAs tells whether the rules are the same, fields it doesn't model
+// included.
+func (r ScalingRule) sameAs(other ScalingRule) bool {
+	return r.MetricType == other.MetricType &&
+		r.BreachDurationSecs == other.BreachDurationSecs &&
+		r.Threshold == other.Threshold &&
+		r.Operator == other.Operator &&
+		r.CoolDownSecs == other.CoolDownSecs &&
+		r.Adjustment == other.Adjustment &&
+		len(r.Other) == 0 && len(other.Other) == 0
+}
+
+// AppAutoscalerBackend is the open-source App Autoscaler's public API, which
+// keeps a policy per app at /v1/apps/GUID/policy.
+type AppAutoscalerBackend struct{}
+
+func (AppAutoscalerBackend) URL(dependencies CLIDependencies, binding ccResource) (string, error) {
+	base, err := autoscalerAPI(dependencies.AutoscalerAPI, binding.Entity.Credentials, func() (string, error) {
+		return appAutoscalerHost(dependencies.APIEndpoint)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s/v1/apps/%s/policy", base, dependencies.App.Guid), nil
+}
+
+func (AppAutoscalerBackend) Get(dependencies CLIDependencies, url string) (remoteBinding, error) {
+	var policy AppAutoscalerPolicy
+
+	headers, err := dependencies.JSONClient.DoWithHeaders("GET", url, nil, nil, &policy)
+
+	// apps without a policy aren't autoscaled, and start from the defaults
+	if responseErr, ok := err.(UnexpectedResponseError); ok && responseErr.StatusCode == http.StatusNotFound {
+		return remoteBinding{URL: url, Binding: DefaultBinding}, nil
+	}
+	if err != nil {
+		return remoteBinding{}, fmt.Errorf("autoscaling API: %s", err)
+	}
+
+	return remoteBinding{
+		URL:          url,
+		Binding:      policy.Binding(),
+		ETag:         headers.Get("ETag"),
+		LastModified: headers.Get("Last-Modified"),
+		Policy:       &policy,
+	}, nil
+}
+
+// Check refuses to disable autoscaling unless deleting the policy loses
+// nothing, as the App Autoscaler can only disable autoscaling by deleting it
+// and undoing that recreates the policy from the settings alone. Apps being
+// unbound lose the policy anyway.
+func (AppAutoscalerBackend) Check(dependencies CLIDependencies, current remoteBinding, updated AutoscalingBinding) error {
+	if updated.Enabled || current.Policy == nil || dependencies.Unbinding {
+		return nil
+	}
+
+	if !current.Policy.onlySettings() {
+		return fmt.Errorf("couldn't disable autoscaling for %s: its App Autoscaler policy has schedules, rules or options besides the instance limits and CPU thresholds, which deleting the policy would lose", dependencies.AppName)
+	}
+
+	return nil
+}
+
+func (AppAutoscalerBackend) Put(dependencies CLIDependencies, current remoteBinding, updated AutoscalingBinding, headers http.Header) error {
+	if !updated.Enabled {
+		if current.Policy == nil {
+			return nil
+		}
+
+		_, err := dependencies.JSONClient.DoWithHeaders("DELETE", current.URL, headers, nil, nil)
+		return err
+	}
+
+	var policy AppAutoscalerPolicy
+	if current.Policy != nil {
+		policy = *current.Policy
+	}
+	policy = policy.WithBinding(updated)
+
+	_, err := dependencies.JSONClient.DoWithHeaders("PUT", current.URL, headers, &policy, nil)
+	return err
+}
+
+// appAutoscalerHost guesses the App Autoscaler's public API from cloud
+// controller's, which it's deployed next to, e.g. https://autoscaler.sys.example.com
+// for https://api.sys.example.com.
+func appAutoscalerHost(apiEndpoint string) (string, error) {
+	api, err := url.Parse(apiEndpoint)
+	if err != nil || !strings.HasPrefix(api.Host, "api.") {
+		return "", fmt.Errorf("couldn't work out the App Autoscaler API URL from %s, give it with --autoscaler-api", apiEndpoint)
+	}
+
+	return fmt.Sprintf("%s://autoscaler.%s", api.Scheme, strings.TrimPrefix(api.Host, "api.")), nil
+}
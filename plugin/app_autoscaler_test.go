@@ -0,0 +1,263 @@
+package plugin_test
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"code.cloudfoundry.org/cli/plugin/models"
+	"github.com/phopper-pivotal/autoscaling-cli-plugin/mocks"
+	"github.com/phopper-pivotal/autoscaling-cli-plugin/plugin"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("AppAutoscalerPolicy", func() {
+	policy := plugin.AppAutoscalerPolicy{
+		InstanceMinCount: 2,
+		InstanceMaxCount: 8,
+		ScalingRules: []plugin.ScalingRule{
+			{MetricType: "memoryused", Threshold: 900, Operator: ">", Adjustment: "+2"},
+			{MetricType: "cpu", Threshold: 25, Operator: "<=", Adjustment: "-1", CoolDownSecs: 300},
+			{MetricType: "cpu", Threshold: 75, Operator: ">", Adjustment: "+1", BreachDurationSecs: 120},
+		},
+		Schedules: json.RawMessage(`{"timezone":"Europe/London"}`),
+	}
+
+	Describe("Binding", func() {
+		It("takes the instance counts and the CPU rules' thresholds", func() {
+			Expect(policy.Binding()).To(Equal(plugin.AutoscalingBinding{
+				MinInstances:    2,
+				MaxInstances:    8,
+				CPUMinThreshold: 25,
+				CPUMaxThreshold: 75,
+				Enabled:         true,
+			}))
+		})
+	})
+
+	Describe("WithBinding", func() {
+		It("updates the instance counts and CPU rules, keeping everything else", func() {
+			updated := policy.WithBinding(plugin.AutoscalingBinding{MinInstances: 3, MaxInstances: 10, CPUMinThreshold: 30, CPUMaxThreshold: 80})
+
+			Expect(updated).To(Equal(plugin.AppAutoscalerPolicy{
+				InstanceMinCount: 3,
+				InstanceMaxCount: 10,
+				ScalingRules: []plugin.ScalingRule{
+					{MetricType: "memoryused", Threshold: 900, Operator: ">", Adjustment: "+2"},
+					{MetricType: "cpu", Threshold: 30, Operator: "<=", Adjustment: "-1", CoolDownSecs: 300},
+					{MetricType: "cpu", Threshold: 80, Operator: ">", Adjustment: "+1", BreachDurationSecs: 120},
+				},
+				Schedules: json.RawMessage(`{"timezone":"Europe/London"}`),
+			}))
+		})
+
+		It("doesn't change the policy it's called on", func() {
+			policy.WithBinding(plugin.AutoscalingBinding{CPUMinThreshold: 30, CPUMaxThreshold: 80})
+			Expect(policy.ScalingRules[1].Threshold).To(Equal(25))
+			Expect(policy.ScalingRules[2].Threshold).To(Equal(75))
+		})
+
+		It("adds CPU rules when there are none", func() {
+			updated := plugin.AppAutoscalerPolicy{}.WithBinding(plugin.AutoscalingBinding{MinInstances: 1, MaxInstances: 4, CPUMinThreshold: 20, CPUMaxThreshold: 80})
+
+			Expect(updated.ScalingRules).To(Equal([]plugin.ScalingRule{
+				{MetricType: "cpu", Threshold: 20, Operator: "<", Adjustment: "-1"},
+				{MetricType: "cpu", Threshold: 80, Operator: ">=", Adjustment: "+1"},
+			}))
+		})
+	})
+})
+
+var _ = Describe("App Autoscaler backend", func() {
+	var (
+		p            *plugin.Plugin
+		jsonClient   *mocks.JSONClient
+		dependencies plugin.CLIDependencies
+		flags        plugin.Flags
+	)
+
+	const policyURL = "https://autoscaler.sys.example.com/v1/apps/some-app-guid/policy"
+
+	BeforeEach(func() {
+		p = plugin.NewPlugin()
+		jsonClient = mocks.NewJSONClient(3)
+		jsonClient.DoCalls[0].ResponseJSON = `{"resources": [{"metadata": {"guid": "some-service-binding-guid"}}]}`
+		jsonClient.DoCalls[1].ResponseJSON = `{
+			"instance_min_count": 2,
+			"instance_max_count": 6,
+			"scaling_rules": [
+				{"metric_type": "cpu", "threshold": 20, "operator": "<", "adjustment": "-1"},
+				{"metric_type": "cpu", "threshold": 80, "operator": ">=", "adjustment": "+1"},
+				{"metric_type": "throughput", "threshold": 500, "operator": ">", "adjustment": "+1"}
+			],
+			"schedules": {"timezone": "Europe/London", "recurring_schedule": []}
+		}`
+		jsonClient.DoCalls[1].Returns.Headers = http.Header{"Etag": []string{`"some-version"`}}
+
+		dependencies = plugin.CLIDependencies{
+			AppName:     "app-name",
+			ServiceName: "service-name",
+			Service: plugin_models.GetService_Model{
+				Guid:         "some-service-instance-guid",
+				DashboardUrl: "https://dashboard.example.com/something-that-doesnot-matter",
+			},
+			APIEndpoint: "https://api.sys.example.com",
+			App:         plugin_models.GetAppModel{Guid: "some-app-guid"},
+			JSONClient:  jsonClient,
+		}
+		dependencies.Service.ServiceOffering.Name = "autoscaler"
+
+		flags = plugin.Flags{
+			MinInstances:    intPtr(3),
+			CPUMaxThreshold: intPtr(70),
+			Force:           true,
+		}
+	})
+
+	It("gets the app's policy from the App Autoscaler API next to cloud controller", func() {
+		Expect(p.RunWithError(dependencies, flags)).To(Succeed())
+		Expect(jsonClient.DoCalls[1].Receives.Method).To(Equal("GET"))
+		Expect(jsonClient.DoCalls[1].Receives.URL).To(Equal(policyURL))
+	})
+
+	It("puts the policy back with the new settings, keeping its other rules and schedules", func() {
+		Expect(p.RunWithError(dependencies, flags)).To(Succeed())
+		Expect(jsonClient.DoCalls[2].Receives.Method).To(Equal("PUT"))
+		Expect(jsonClient.DoCalls[2].Receives.URL).To(Equal(policyURL))
+		Expect(jsonClient.DoCalls[2].Receives.Headers.Get("If-Match")).To(Equal(`"some-version"`))
+		Expect(json.Marshal(jsonClient.DoCalls[2].Receives.RequestData)).To(MatchJSON(`{
+			"instance_min_count": 3,
+			"instance_max_count": 6,
+			"scaling_rules": [
+				{"metric_type": "cpu", "threshold": 20, "operator": "<", "adjustment": "-1"},
+				{"metric_type": "cpu", "threshold": 70, "operator": ">=", "adjustment": "+1"},
+				{"metric_type": "throughput", "threshold": 500, "operator": ">", "adjustment": "+1"}
+			],
+			"schedules": {"timezone": "Europe/London", "recurring_schedule": []}
+		}`))
+	})
+
+	It("uses the autoscaling API URL when one is given", func() {
+		dependencies.AutoscalerAPI = "https://apps.example.com/autoscaler"
+
+		Expect(p.RunWithError(dependencies, flags)).To(Succeed())
+		Expect(jsonClient.DoCalls[1].Receives.URL).To(Equal("https://apps.example.com/autoscaler/v1/apps/some-app-guid/policy"))
+	})
+
+	Context("when disabling autoscaling", func() {
+		BeforeEach(func() {
+			enabled := false
+			flags = plugin.Flags{Enabled: &enabled, Force: true}
+		})
+
+		It("deletes a policy of just the instance limits and CPU rules", func() {
+			jsonClient.DoCalls[1].ResponseJSON = `{
+				"instance_min_count": 2,
+				"instance_max_count": 6,
+				"scaling_rules": [
+					{"metric_type": "cpu", "threshold": 20, "operator": "<", "adjustment": "-1"},
+					{"metric_type": "cpu", "threshold": 80, "operator": ">=", "adjustment": "+1"}
+				]
+			}`
+
+			Expect(p.RunWithError(dependencies, flags)).To(Succeed())
+			Expect(jsonClient.DoCalls[2].Receives.Method).To(Equal("DELETE"))
+			Expect(jsonClient.DoCalls[2].Receives.URL).To(Equal(policyURL))
+		})
+
+		It("deletes a policy listing the CPU rules scale-out first", func() {
+			jsonClient.DoCalls[1].ResponseJSON = `{
+				"instance_min_count": 2,
+				"instance_max_count": 6,
+				"scaling_rules": [
+					{"metric_type": "cpu", "threshold": 80, "operator": ">=", "adjustment": "+1"},
+					{"metric_type": "cpu", "threshold": 20, "operator": "<", "adjustment": "-1"}
+				],
+				"schedules": null
+			}`
+
+			Expect(p.RunWithError(dependencies, flags)).To(Succeed())
+			Expect(jsonClient.DoCalls[2].Receives.Method).To(Equal("DELETE"))
+		})
+
+		It("refuses to delete a policy whose CPU rules scale by more than one instance", func() {
+			jsonClient.DoCalls[1].ResponseJSON = `{
+				"instance_min_count": 2,
+				"instance_max_count": 6,
+				"scaling_rules": [
+					{"metric_type": "cpu", "threshold": 80, "operator": ">=", "adjustment": "+2"},
+					{"metric_type": "cpu", "threshold": 20, "operator": "<", "adjustment": "-1"}
+				]
+			}`
+
+			err := p.RunWithError(dependencies, flags)
+			Expect(err).To(MatchError(ContainSubstring("which deleting the policy would lose")))
+			Expect(jsonClient.DoCallCount).To(Equal(2))
+		})
+
+		It("refuses to delete a policy with anything else, which undoing couldn't restore", func() {
+			err := p.RunWithError(dependencies, flags)
+			Expect(err).To(MatchError("couldn't disable autoscaling for app-name: its App Autoscaler policy has schedules, rules or options besides the instance limits and CPU thresholds, which deleting the policy would lose"))
+			Expect(jsonClient.DoCallCount).To(Equal(2))
+		})
+	})
+
+	It("keeps the fields of the policy it doesn't know about", func() {
+		jsonClient.DoCalls[1].ResponseJSON = `{
+			"instance_min_count": 2,
+			"instance_max_count": 6,
+			"scaling_rules": [
+				{"metric_type": "cpu", "threshold": 80, "operator": ">=", "adjustment": "+1", "stats_window_secs": 60},
+				{"metric_type": "cpu", "threshold": 20, "operator": "<", "adjustment": "-1"}
+			],
+			"configuration": {"custom_metrics": {"metric_submission_strategy": {"allow_from": "bound_app"}}}
+		}`
+
+		Expect(p.RunWithError(dependencies, flags)).To(Succeed())
+		Expect(json.Marshal(jsonClient.DoCalls[2].Receives.RequestData)).To(MatchJSON(`{
+			"instance_min_count": 3,
+			"instance_max_count": 6,
+			"scaling_rules": [
+				{"metric_type": "cpu", "threshold": 70, "operator": ">=", "adjustment": "+1", "stats_window_secs": 60},
+				{"metric_type": "cpu", "threshold": 20, "operator": "<", "adjustment": "-1"}
+			],
+			"configuration": {"custom_metrics": {"metric_submission_strategy": {"allow_from": "bound_app"}}}
+		}`))
+	})
+
+	Context("when the app has no policy", func() {
+		BeforeEach(func() {
+			jsonClient.DoCalls[1].ResponseJSON = `{}`
+			jsonClient.DoCalls[1].Returns.Error = plugin.UnexpectedResponseError{StatusCode: http.StatusNotFound, Status: "404 Not Found"}
+		})
+
+		It("creates one from the default settings", func() {
+			// without an ETag, the policy is checked again just before putting it
+			jsonClient.DoCalls[2].ResponseJSON = `{}`
+			jsonClient.DoCalls[2].Returns.Error = plugin.UnexpectedResponseError{StatusCode: http.StatusNotFound, Status: "404 Not Found"}
+			jsonClient.DoCalls[3] = &mocks.DoCall{}
+
+			Expect(p.RunWithError(dependencies, flags)).To(Succeed())
+			Expect(jsonClient.DoCalls[3].Receives.Method).To(Equal("PUT"))
+			Expect(jsonClient.DoCalls[3].Receives.URL).To(Equal(policyURL))
+			Expect(json.Marshal(jsonClient.DoCalls[3].Receives.RequestData)).To(MatchJSON(`{
+				"instance_min_count": 3,
+				"instance_max_count": 5,
+				"scaling_rules": [
+					{"metric_type": "cpu", "threshold": 20, "operator": "<", "adjustment": "-1"},
+					{"metric_type": "cpu", "threshold": 70, "operator": ">=", "adjustment": "+1"}
+				]
+			}`))
+		})
+	})
+
+	Context("when cloud controller's API isn't on an api. host", func() {
+		It("asks for the autoscaling API URL", func() {
+			dependencies.APIEndpoint = "https://cloudcontroller.example.com"
+
+			err := p.RunWithError(dependencies, flags)
+			Expect(err).To(MatchError("couldn't work out the App Autoscaler API URL from https://cloudcontroller.example.com, give it with --autoscaler-api"))
+		})
+	})
+})
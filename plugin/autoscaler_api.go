@@ -0,0 +1,48 @@
+package plugin
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// autoscalerAPICredential is the binding credential in which brokers can give
+// the autoscaling API's URL.
+const autoscalerAPICredential = "api_url"
+
+// autoscalerAPI returns the base URL of the autoscaling API for a binding.
+// The override, from the --autoscaler-api flag or the plugin config file,
+// comes first, then the binding's credentials. Failing those, guess works it
+// out from where the API is usually deployed.
+func autoscalerAPI(override string, credentials map[string]interface{}, guess func() (string, error)) (string, error) {
+	if override != "" {
+		return parseAutoscalerAPI(override)
+	}
+
+	if fromCredentials, ok := credentials[autoscalerAPICredential].(string); ok && fromCredentials != "" {
+		return parseAutoscalerAPI(fromCredentials)
+	}
+
+	return guess()
+}
+
+func parseAutoscalerAPI(apiURL string) (string, error) {
+	parsed, err := url.Parse(apiURL)
+	if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+		return "", fmt.Errorf("invalid autoscaling API URL: %s", apiURL)
+	}
+
+	// the API may sit under a path on a shared router
+	return strings.TrimSuffix(parsed.String(), "/"), nil
+}
+
+// dashboardHost returns the scheme and host of the service instance's
+// dashboard, where the autoscaling service's API is usually deployed.
+func dashboardHost(dashboardURL string) (string, error) {
+	dashboard, err := url.Parse(dashboardURL)
+	if err != nil || dashboard.Host == "" {
+		return "", fmt.Errorf("invalid dashboard URL from service instance: %s", dashboardURL)
+	}
+
+	return fmt.Sprintf("%s://%s", dashboard.Scheme, dashboard.Host), nil
+}
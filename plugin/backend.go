@@ -0,0 +1,127 @@
+package plugin
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+)
+
+const (
+	appAutoscalerServiceOfferingEnv     = "AUTOSCALING_APP_AUTOSCALER_OFFERING"
+	defaultAppAutoscalerServiceOffering = "autoscaler"
+)
+
+// backend is an autoscaling API, which keeps the autoscaling settings of the
+// apps bound to its service instances.
+type backend interface {
+	// URL returns the URL of the settings of the app that binding binds
+	URL(dependencies CLIDependencies, binding ccResource) (string, error)
+
+	Get(dependencies CLIDependencies, url string) (remoteBinding, error)
+
+	// Check returns an error if updated can't replace current
+	Check(dependencies CLIDependencies, current remoteBinding, updated AutoscalingBinding) error
+
+	// Put replaces the settings with updated, sending headers along to make
+	// the change conditional where the API supports it
+	Put(dependencies CLIDependencies, current remoteBinding, updated AutoscalingBinding, headers http.Header) error
+}
+
+// appAutoscalerServiceOffering returns the label of the open-source App
+// Autoscaler's service offering, from AUTOSCALING_APP_AUTOSCALER_OFFERING if
+// set.
+func appAutoscalerServiceOffering() string {
+	if label := os.Getenv(appAutoscalerServiceOfferingEnv); label != "" {
+		return label
+	}
+
+	return defaultAppAutoscalerServiceOffering
+}
+
+// autoscalerServiceOfferings returns the labels of the service offerings of
+// every backend.
+func autoscalerServiceOfferings() []string {
+	offerings := []string{autoscalerServiceOffering()}
+	if appAutoscaler := appAutoscalerServiceOffering(); appAutoscaler != offerings[0] {
+		offerings = append(offerings, appAutoscaler)
+	}
+
+	return offerings
+}
+
+// isAutoscalerServiceOffering tells whether offering is the service offering
+// of one of the backends.
+func isAutoscalerServiceOffering(offering string) bool {
+	for _, candidate := range autoscalerServiceOfferings() {
+		if offering == candidate {
+			return true
+		}
+	}
+
+	return false
+}
+
+// serviceOfferingLabel returns the label of the service offering of a
+// service instance's plan.
+func serviceOfferingLabel(dependencies CLIDependencies, planGUID string) (string, error) {
+	var plan, service ccResource
+	err := getCCResource(dependencies, fmt.Sprintf("/v2/service_plans/%s", planGUID), &plan)
+	if err == nil {
+		err = getCCResource(dependencies, fmt.Sprintf("/v2/services/%s", plan.Entity.ServiceGUID), &service)
+	}
+	if err != nil {
+		return "", fmt.Errorf("couldn't look up the service offering of plan %s: %s", planGUID, err)
+	}
+
+	return service.Entity.Label, nil
+}
+
+// backendFor returns the backend of the dependencies' service instance,
+// going by its service offering.
+func backendFor(dependencies CLIDependencies) backend {
+	if dependencies.Service.ServiceOffering.Name == appAutoscalerServiceOffering() {
+		return AppAutoscalerBackend{}
+	}
+
+	return BindingBackend{}
+}
+
+// BindingBackend is the autoscaling service's binding API, at
+// /api/bindings/GUID.
+type BindingBackend struct{}
+
+func (BindingBackend) URL(dependencies CLIDependencies, binding ccResource) (string, error) {
+	base, err := autoscalerAPI(dependencies.AutoscalerAPI, binding.Entity.Credentials, func() (string, error) {
+		return dashboardHost(dependencies.Service.DashboardUrl)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s/api/bindings/%s", base, binding.Metadata.GUID), nil
+}
+
+func (BindingBackend) Get(dependencies CLIDependencies, url string) (remoteBinding, error) {
+	var autoscalingBinding AutoscalingBinding
+
+	headers, err := dependencies.JSONClient.DoWithHeaders("GET", url, nil, nil, &autoscalingBinding)
+	if err != nil {
+		return remoteBinding{}, fmt.Errorf("autoscaling API: %s", err)
+	}
+
+	return remoteBinding{
+		URL:          url,
+		Binding:      autoscalingBinding,
+		ETag:         headers.Get("ETag"),
+		LastModified: headers.Get("Last-Modified"),
+	}, nil
+}
+
+func (BindingBackend) Check(dependencies CLIDependencies, current remoteBinding, updated AutoscalingBinding) error {
+	return nil
+}
+
+func (BindingBackend) Put(dependencies CLIDependencies, current remoteBinding, updated AutoscalingBinding, headers http.Header) error {
+	_, err := dependencies.JSONClient.DoWithHeaders("POST", current.URL, headers, &updated, nil)
+	return err
+}
@@ -0,0 +1,159 @@
+package plugin
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const maxConflictAttempts = 3
+
+// ConflictError is returned when a binding was changed by someone else
+// between fetching it and posting the new settings.
+type ConflictError struct {
+	AppName     string
+	ServiceName string
+	Changes     []FieldChange
+}
+
+func (e ConflictError) Error() string {
+	message := []string{fmt.Sprintf("the autoscaling binding for %s to %s was changed by someone else in the meantime:", e.AppName, e.ServiceName)}
+	for _, change := range e.Changes {
+		message = append(message, fmt.Sprintf("  %s", change))
+	}
+	message = append(message, "re-run the command to apply your settings on top of theirs, or use --retry-on-conflict")
+
+	return strings.Join(message, "\n")
+}
+
+// confirmChange confirms a change that passed the checks, just before it's
+// posted.
+type confirmChange func(current, updated AutoscalingBinding) error
+
+// onlyDisables tells whether updated keeps current's settings and only turns
+// autoscaling off.
+func onlyDisables(current, updated AutoscalingBinding) bool {
+	disabled := current
+	disabled.AppGuid = updated.AppGuid
+	disabled.Enabled = false
+
+	return updated == disabled
+}
+
+// checkBinding fails when updated is out of range, doesn't fit the space's
+// instance quotas or breaks a guardrail. Guardrails apply even when forced.
+// Only turning autoscaling off is never checked, so settings that no longer
+// pass can still be disabled.
+func checkBinding(dependencies CLIDependencies, current, updated AutoscalingBinding) error {
+	if onlyDisables(current, updated) {
+		return nil
+	}
+
+	// the space isn't known when the app wasn't looked up through the cli
+	var quotas []InstanceQuota
+	if dependencies.App.SpaceGuid != "" {
+		var err error
+		quotas, err = fetchInstanceQuotas(dependencies)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := ValidateBinding(updated, quotas); err != nil {
+		return err
+	}
+
+	if dependencies.Guardrails == nil {
+		return nil
+	}
+
+	// guardrails can depend on the app's labels, which aren't known when the
+	// app wasn't looked up through the cli
+	var labels map[string]string
+	if dependencies.App.Guid != "" {
+		var err error
+		labels, err = fetchAppLabels(dependencies)
+		if err != nil {
+			return err
+		}
+	}
+
+	return checkGuardrails(dependencies, labels, updated)
+}
+
+// postBinding is the single path every command writes a binding through. It
+// checks updated, asks confirm if given, and puts it.
+func postBinding(dependencies CLIDependencies, current remoteBinding, updated AutoscalingBinding, confirm confirmChange) error {
+	if err := checkBinding(dependencies, current.Binding, updated); err != nil {
+		return err
+	}
+
+	if confirm != nil {
+		if err := confirm(current.Binding, updated); err != nil {
+			return err
+		}
+	}
+
+	return putBinding(dependencies, current, updated)
+}
+
+// putBinding posts updated without checking it, unless the binding changed
+// since current was fetched, and records the change in the journal. The
+// change is detected with the binding's ETag or Last-Modified time where the
+// API provides them, and otherwise by fetching it again just before posting.
+// Only restoring settings that were in place before goes straight here.
+func putBinding(dependencies CLIDependencies, current remoteBinding, updated AutoscalingBinding) error {
+	backend := backendFor(dependencies)
+	if err := backend.Check(dependencies, current, updated); err != nil {
+		return err
+	}
+
+	headers := http.Header{}
+
+	switch {
+	case current.ETag != "":
+		headers.Set("If-Match", current.ETag)
+	case current.LastModified != "":
+		headers.Set("If-Unmodified-Since", current.LastModified)
+	default:
+		latest, err := getBinding(dependencies, current.URL)
+		if err != nil {
+			return err
+		}
+
+		if changes := DiffBindings(current.Binding, latest.Binding); len(changes) > 0 {
+			return ConflictError{AppName: dependencies.AppName, ServiceName: dependencies.ServiceName, Changes: changes}
+		}
+	}
+
+	err := backend.Put(dependencies, current, updated, headers)
+	if responseErr, ok := err.(UnexpectedResponseError); ok && responseErr.StatusCode == http.StatusPreconditionFailed {
+		latest, err := getBinding(dependencies, current.URL)
+		if err != nil {
+			return err
+		}
+
+		return ConflictError{AppName: dependencies.AppName, ServiceName: dependencies.ServiceName, Changes: DiffBindings(current.Binding, latest.Binding)}
+	}
+	if err != nil {
+		return fmt.Errorf("autoscaling API: %s", err)
+	}
+
+	if dependencies.Journal != nil {
+		err = dependencies.Journal.Record(JournalEntry{
+			Foundation:  dependencies.APIEndpoint,
+			SpaceName:   dependencies.SpaceName,
+			AppName:     dependencies.AppName,
+			AppGUID:     dependencies.App.Guid,
+			ServiceName: dependencies.ServiceName,
+			ServiceGUID: dependencies.Service.Guid,
+			Before:      current.Binding,
+			After:       updated,
+		})
+		if err != nil {
+			return fmt.Errorf("the settings were applied but couldn't be recorded in the autoscaling history: %s", err)
+		}
+	}
+
+	return nil
+}
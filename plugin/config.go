@@ -0,0 +1,107 @@
+package plugin
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Config is the plugin's config file, e.g.
+//
+//	targets:
+//	  east:
+//	    api: https://api.sys.east.example.com
+//	    ...
+//	tls:
+//	  ca_cert_files: [/etc/ssl/internal-ca.pem]
+//	proxy:
+//	  url: http://proxy.example.com:3128
+//	autoscaler_api: https://apps.example.com/autoscaler
+type Config struct {
+	Targets       map[string]Target `yaml:"targets"`
+	TLS           TLSOptions        `yaml:"tls"`
+	Proxy         ProxyOptions      `yaml:"proxy"`
+	AutoscalerAPI string            `yaml:"autoscaler_api"`
+}
+
+func DefaultConfigPath() string {
+	return filepath.Join(pluginConfigDir(), "config.yml")
+}
+
+// LoadConfig loads the config file in path. A missing file is an empty
+// config.
+func LoadConfig(path string) (Config, error) {
+	contents, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return Config{}, nil
+	}
+	if err != nil {
+		return Config{}, fmt.Errorf("couldn't read plugin config file: %s", err)
+	}
+
+	var config Config
+	if err := yaml.UnmarshalStrict(contents, &config); err != nil {
+		return Config{}, fmt.Errorf("couldn't parse plugin config file %s: %s", path, err)
+	}
+
+	return config, nil
+}
+
+// GlobalFlags are the flags that work with every command.
+type GlobalFlags struct {
+	Target         string
+	CACertFiles    []string
+	ClientCertFile string
+	ClientKeyFile  string
+	AutoscalerAPI  string
+}
+
+// ParseGlobalFlags takes the global flags out of args, wherever they are,
+// leaving the rest for the command.
+func ParseGlobalFlags(args []string) (GlobalFlags, []string, error) {
+	var flags GlobalFlags
+	setters := map[string]func(string){
+		"target":         func(value string) { flags.Target = value },
+		"ca-cert":        func(value string) { flags.CACertFiles = append(flags.CACertFiles, value) },
+		"client-cert":    func(value string) { flags.ClientCertFile = value },
+		"client-key":     func(value string) { flags.ClientKeyFile = value },
+		"autoscaler-api": func(value string) { flags.AutoscalerAPI = value },
+	}
+
+	var rest []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		name := strings.TrimLeft(arg, "-")
+		if !strings.HasPrefix(arg, "-") || name == "" {
+			rest = append(rest, arg)
+			continue
+		}
+
+		value, hasValue := "", false
+		if equals := strings.Index(name, "="); equals >= 0 {
+			name, value, hasValue = name[:equals], name[equals+1:], true
+		}
+
+		set, ok := setters[name]
+		if !ok {
+			rest = append(rest, arg)
+			continue
+		}
+
+		if !hasValue {
+			if i+1 == len(args) {
+				return GlobalFlags{}, nil, fmt.Errorf("flag needs an argument: %s", arg)
+			}
+			value = args[i+1]
+			i++
+		}
+
+		set(value)
+	}
+
+	return flags, rest, nil
+}
@@ -0,0 +1,122 @@
+package plugin_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/phopper-pivotal/autoscaling-cli-plugin/plugin"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Config", func() {
+	Describe("LoadConfig", func() {
+		var dir string
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "config")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		It("loads the targets", func() {
+			path := filepath.Join(dir, "config.yml")
+			Expect(ioutil.WriteFile(path, []byte("targets:\n  east:\n    api: https://api.east.example.com\n    refresh_token: some-refresh-token\n    skip_ssl_validation: true\n    org: some-org\n    space: some-space\n"), 0600)).To(Succeed())
+
+			config, err := plugin.LoadConfig(path)
+			Expect(err).NotTo(HaveOccurred())
+
+			target, err := config.Target("east")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(target).To(Equal(plugin.Target{
+				API:               "https://api.east.example.com",
+				RefreshToken:      "some-refresh-token",
+				SkipSSLValidation: true,
+				Org:               "some-org",
+				Space:             "some-space",
+			}))
+		})
+
+		It("loads the TLS settings", func() {
+			path := filepath.Join(dir, "config.yml")
+			Expect(ioutil.WriteFile(path, []byte("tls:\n  ca_cert_files: [internal-ca.pem]\n  client_cert_file: client.pem\n  client_key_file: client-key.pem\n"), 0600)).To(Succeed())
+
+			config, err := plugin.LoadConfig(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(config.TLS).To(Equal(plugin.TLSOptions{
+				CACertFiles:    []string{"internal-ca.pem"},
+				ClientCertFile: "client.pem",
+				ClientKeyFile:  "client-key.pem",
+			}))
+		})
+
+		It("loads the autoscaling API URLs", func() {
+			path := filepath.Join(dir, "config.yml")
+			Expect(ioutil.WriteFile(path, []byte("autoscaler_api: https://apps.example.com/autoscaler\ntargets:\n  east:\n    api: https://api.east.example.com\n    autoscaler_api: https://apps.east.example.com/autoscaler\n"), 0600)).To(Succeed())
+
+			config, err := plugin.LoadConfig(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(config.AutoscalerAPI).To(Equal("https://apps.example.com/autoscaler"))
+			Expect(config.Targets["east"].AutoscalerAPI).To(Equal("https://apps.east.example.com/autoscaler"))
+		})
+
+		It("is empty when there is no config file", func() {
+			config, err := plugin.LoadConfig(filepath.Join(dir, "config.yml"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(config.Targets).To(BeEmpty())
+		})
+
+		Context("when the config file contains unknown fields", func() {
+			It("returns an error", func() {
+				path := filepath.Join(dir, "config.yml")
+				Expect(ioutil.WriteFile(path, []byte("targets:\n  east:\n    endpoint: https://api.east.example.com\n"), 0600)).To(Succeed())
+
+				_, err := plugin.LoadConfig(path)
+				Expect(err).To(MatchError(ContainSubstring("couldn't parse plugin config file")))
+			})
+		})
+	})
+
+	Describe("ParseGlobalFlags", func() {
+		It("takes the global flags out of the arguments", func() {
+			flags, args, err := plugin.ParseGlobalFlags([]string{
+				"configure-autoscaling", "--min-instances", "2", "--target", "east",
+				"--ca-cert", "internal-ca.pem", "-ca-cert=other-ca.pem", "--client-cert", "client.pem", "--client-key=client-key.pem",
+				"--autoscaler-api", "https://apps.example.com/autoscaler", "app-name",
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(flags).To(Equal(plugin.GlobalFlags{
+				Target:         "east",
+				CACertFiles:    []string{"internal-ca.pem", "other-ca.pem"},
+				ClientCertFile: "client.pem",
+				ClientKeyFile:  "client-key.pem",
+				AutoscalerAPI:  "https://apps.example.com/autoscaler",
+			}))
+			Expect(args).To(Equal([]string{"configure-autoscaling", "--min-instances", "2", "app-name"}))
+		})
+
+		It("accepts --target=NAME", func() {
+			flags, args, err := plugin.ParseGlobalFlags([]string{"autoscaling-status", "--target=east", "app-name"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(flags.Target).To(Equal("east"))
+			Expect(args).To(Equal([]string{"autoscaling-status", "app-name"}))
+		})
+
+		It("leaves the command's own flags alone", func() {
+			_, args, err := plugin.ParseGlobalFlags([]string{"autoscaling-drift-report", "--policies=policies", "-f", "--"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(args).To(Equal([]string{"autoscaling-drift-report", "--policies=policies", "-f", "--"}))
+		})
+
+		It("fails when a flag has no value", func() {
+			_, _, err := plugin.ParseGlobalFlags([]string{"autoscaling-status", "--target"})
+			Expect(err).To(MatchError("flag needs an argument: --target"))
+		})
+	})
+})
@@ -0,0 +1,160 @@
+package plugin
+
+import (
+	"code.cloudfoundry.org/cli/plugin/models"
+	"flag"
+	"fmt"
+	"net/url"
+)
+
+// findInSpace returns the resource named name from a cloud controller list
+// of a space's resources, e.g. /v2/spaces/:guid/apps.
+func findInSpace(dependencies CLIDependencies, path, name string) (ccResource, bool, error) {
+	resourcesURL, err := getCCURL(dependencies.APIEndpoint, path, url.Values{
+		"q": []string{fmt.Sprintf("name:%s", name)},
+	})
+	if err != nil {
+		return ccResource{}, false, err
+	}
+
+	var resources ccResources
+	err = dependencies.JSONClient.Do("GET", resourcesURL, nil, &resources)
+	if err != nil {
+		return ccResource{}, false, err
+	}
+
+	if len(resources.Resources) == 0 {
+		return ccResource{}, false, nil
+	}
+
+	return resources.Resources[0], true, nil
+}
+
+// ResolveDependenciesInSpace returns dependencies for an app and service
+// instance in another space of the org, looked up through cloud controller
+// with the connection details of base.
+func ResolveDependenciesInSpace(base CLIDependencies, orgGUID, spaceName, appName, serviceName string) (CLIDependencies, error) {
+	space, found, err := findInSpace(base, fmt.Sprintf("/v2/organizations/%s/spaces", orgGUID), spaceName)
+	if err != nil {
+		return CLIDependencies{}, fmt.Errorf("couldn't look up space %s: %s", spaceName, err)
+	}
+	if !found {
+		return CLIDependencies{}, fmt.Errorf("couldn't find space %s", spaceName)
+	}
+
+	app, found, err := findInSpace(base, fmt.Sprintf("/v2/spaces/%s/apps", space.Metadata.GUID), appName)
+	if err != nil {
+		return CLIDependencies{}, fmt.Errorf("couldn't look up app %s: %s", appName, err)
+	}
+	if !found {
+		return CLIDependencies{}, fmt.Errorf("couldn't find app %s in space %s", appName, spaceName)
+	}
+
+	service, found, err := findInSpace(base, fmt.Sprintf("/v2/spaces/%s/service_instances", space.Metadata.GUID), serviceName)
+	if err != nil {
+		return CLIDependencies{}, fmt.Errorf("couldn't look up service instance %s: %s", serviceName, err)
+	}
+	if !found {
+		return CLIDependencies{}, fmt.Errorf("couldn't find service instance %s in space %s", serviceName, spaceName)
+	}
+
+	// the offering decides which backend keeps the settings
+	offering, err := serviceOfferingLabel(base, service.Entity.ServicePlanGUID)
+	if err != nil {
+		return CLIDependencies{}, err
+	}
+
+	dependencies := CLIDependencies{
+		AccessToken: base.AccessToken,
+		AppName:     appName,
+		ServiceName: serviceName,
+		Service: plugin_models.GetService_Model{
+			Guid:         service.Metadata.GUID,
+			Name:         serviceName,
+			DashboardUrl: service.Entity.DashboardURL,
+		},
+		APIEndpoint:   base.APIEndpoint,
+		AutoscalerAPI: base.AutoscalerAPI,
+		App: plugin_models.GetAppModel{
+			Guid:      app.Metadata.GUID,
+			Name:      appName,
+			SpaceGuid: space.Metadata.GUID,
+		},
+		SpaceName:  spaceName,
+		JSONClient: base.JSONClient,
+		UI:         base.UI,
+	}
+	dependencies.Service.ServiceOffering.Name = offering
+
+	return dependencies, nil
+}
+
+// CopyWithError applies the settings of the source app's binding, enabled
+// state included, to the destination app's binding.
+func (p *Plugin) CopyWithError(source, destination CLIDependencies, force bool) error {
+	current, err := p.fetchBinding(source)
+	if err != nil {
+		return err
+	}
+
+	flags := flagsFor(current.Binding)
+	flags.Force = force
+
+	err = p.RunWithError(destination, flags)
+	if err != nil {
+		return err
+	}
+
+	destination.UI.Say("Copied autoscaling settings from %s to %s", source.AppName, destination.AppName)
+	return nil
+}
+
+func (p *Plugin) runCopy(cliConnection cliConnection, args []string) error {
+	var (
+		sourceSpace string
+		destService string
+		force       bool
+	)
+
+	flagSet := flag.NewFlagSet("copy-autoscaling", flag.ContinueOnError)
+	flagSet.StringVar(&sourceSpace, "source-space", "", "(optional) space of the source app and service instance")
+	flagSet.StringVar(&destService, "dest-service", "", "(optional) service instance of the destination app")
+	flagSet.BoolVar(&force, "f", false, "(optional) apply risky changes without asking for confirmation")
+	flagSet.BoolVar(&force, "force", false, "(optional) apply risky changes without asking for confirmation")
+	err := flagSet.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if flagSet.NArg() != 3 {
+		return fmt.Errorf("provide SOURCE_APP, DEST_APP and SERVICE_INSTANCE on command line")
+	}
+
+	sourceApp, destApp, serviceName := flagSet.Arg(0), flagSet.Arg(1), flagSet.Arg(2)
+	if destService == "" {
+		destService = serviceName
+	}
+
+	destination, err := p.FetchCLIDependencies(cliConnection, []string{destApp, destService})
+	if err != nil {
+		return err
+	}
+
+	var source CLIDependencies
+	if sourceSpace == "" {
+		source, err = p.FetchCLIDependencies(cliConnection, []string{sourceApp, serviceName})
+	} else {
+		var org plugin_models.Organization
+		org, err = cliConnection.GetCurrentOrg()
+		if err != nil {
+			return fmt.Errorf("couldn't get current org: %s", err)
+		}
+
+		source, err = ResolveDependenciesInSpace(destination, org.Guid, sourceSpace, sourceApp, serviceName)
+	}
+	if err != nil {
+		return err
+	}
+
+	return p.CopyWithError(source, destination, force)
+}
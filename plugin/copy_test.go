@@ -0,0 +1,207 @@
+package plugin_test
+
+import (
+	"bytes"
+	"net/http"
+
+	"code.cloudfoundry.org/cli/plugin/models"
+	"github.com/phopper-pivotal/autoscaling-cli-plugin/mocks"
+	"github.com/phopper-pivotal/autoscaling-cli-plugin/plugin"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Copy", func() {
+	Describe("CopyWithError", func() {
+		var (
+			p                 *plugin.Plugin
+			sourceClient      *mocks.JSONClient
+			destinationClient *mocks.JSONClient
+			source            plugin.CLIDependencies
+			destination       plugin.CLIDependencies
+			out               *bytes.Buffer
+		)
+
+		BeforeEach(func() {
+			p = plugin.NewPlugin()
+
+			sourceClient = mocks.NewJSONClient(2)
+			sourceClient.DoCalls[0].ResponseJSON = `{"Resources": [{"Metadata": {"GUID": "source-binding-guid"}}]}`
+			sourceClient.DoCalls[1].ResponseJSON = `{"app_guid": "source-app-guid", "min_instances": 4, "max_instances": 20, "cpu_min_threshold": 30, "cpu_max_threshold": 70, "enabled": false}`
+
+			destinationClient = mocks.NewJSONClient(3)
+			destinationClient.DoCalls[0].ResponseJSON = `{"Resources": [{"Metadata": {"GUID": "dest-binding-guid"}}]}`
+			destinationClient.DoCalls[1].ResponseJSON = `{"min_instances": 2, "max_instances": 5, "cpu_min_threshold": 20, "cpu_max_threshold": 80, "enabled": false}`
+			destinationClient.DoCalls[1].Returns.Headers = http.Header{"Etag": []string{`"some-version"`}}
+
+			out = &bytes.Buffer{}
+			source = plugin.CLIDependencies{
+				AppName:     "app-blue",
+				ServiceName: "service-name",
+				Service: plugin_models.GetService_Model{
+					Guid:         "source-service-guid",
+					DashboardUrl: "http://autoscaling.example.com/dashboard",
+				},
+				APIEndpoint: "https://cloudcontroller.example.com",
+				App:         plugin_models.GetAppModel{Guid: "source-app-guid"},
+				JSONClient:  sourceClient,
+			}
+			destination = plugin.CLIDependencies{
+				AppName:     "app-green",
+				ServiceName: "other-service",
+				Service: plugin_models.GetService_Model{
+					Guid:         "dest-service-guid",
+					DashboardUrl: "http://autoscaling.example.com/dashboard",
+				},
+				APIEndpoint: "https://cloudcontroller.example.com",
+				App:         plugin_models.GetAppModel{Guid: "dest-app-guid"},
+				JSONClient:  destinationClient,
+				UI:          plugin.UI{Out: out},
+			}
+		})
+
+		It("posts the source's settings to the destination's binding", func() {
+			Expect(p.CopyWithError(source, destination, false)).To(Succeed())
+
+			Expect(sourceClient.DoCalls[1].Receives.URL).To(Equal("http://autoscaling.example.com/api/bindings/source-binding-guid"))
+			Expect(destinationClient.DoCalls[2].Receives.Method).To(Equal("POST"))
+			Expect(destinationClient.DoCalls[2].Receives.URL).To(Equal("http://autoscaling.example.com/api/bindings/dest-binding-guid"))
+			Expect(destinationClient.DoCalls[2].Receives.RequestData).To(Equal(&plugin.AutoscalingBinding{
+				AppGuid:         "dest-app-guid",
+				MinInstances:    4,
+				MaxInstances:    20,
+				CPUMinThreshold: 30,
+				CPUMaxThreshold: 70,
+				Enabled:         false,
+			}))
+			Expect(out.String()).To(Equal("Copied autoscaling settings from app-blue to app-green\n"))
+		})
+
+		It("asks for confirmation of risky changes", func() {
+			destinationClient.DoCalls[1].ResponseJSON = `{"min_instances": 2, "max_instances": 50, "cpu_min_threshold": 20, "cpu_max_threshold": 80, "enabled": true}`
+
+			err := p.CopyWithError(source, destination, false)
+			Expect(err).To(MatchError(ContainSubstring("autoscaling will be disabled")))
+			Expect(destinationClient.DoCalls[2].Receives.Method).To(BeEmpty())
+		})
+	})
+
+	Describe("ResolveDependenciesInSpace", func() {
+		var (
+			jsonClient *mocks.JSONClient
+			base       plugin.CLIDependencies
+		)
+
+		BeforeEach(func() {
+			jsonClient = mocks.NewJSONClient(7)
+			jsonClient.DoCalls[0].ResponseJSON = `{"resources": [{"metadata": {"guid": "staging-space-guid"}, "entity": {"name": "staging"}}]}`
+			jsonClient.DoCalls[1].ResponseJSON = `{"resources": [{"metadata": {"guid": "source-app-guid"}, "entity": {"name": "app-name"}}]}`
+			jsonClient.DoCalls[2].ResponseJSON = `{"resources": [{"metadata": {"guid": "source-service-guid"}, "entity": {"name": "service-name", "dashboard_url": "http://autoscaling.example.com/dashboard", "service_plan_guid": "some-plan-guid"}}]}`
+			jsonClient.DoCalls[3].ResponseJSON = `{"entity": {"service_guid": "some-service-guid"}}`
+			jsonClient.DoCalls[4].ResponseJSON = `{"entity": {"label": "app-autoscaler"}}`
+
+			base = plugin.CLIDependencies{
+				AccessToken: "bearer some-token",
+				AppName:     "other-app",
+				APIEndpoint: "https://cloudcontroller.example.com",
+				JSONClient:  jsonClient,
+			}
+		})
+
+		It("looks up the app and service instance in the other space", func() {
+			dependencies, err := plugin.ResolveDependenciesInSpace(base, "some-org-guid", "staging", "app-name", "service-name")
+			Expect(err).NotTo(HaveOccurred())
+
+			expected := plugin.CLIDependencies{
+				AccessToken: "bearer some-token",
+				AppName:     "app-name",
+				ServiceName: "service-name",
+				Service: plugin_models.GetService_Model{
+					Guid:         "source-service-guid",
+					Name:         "service-name",
+					DashboardUrl: "http://autoscaling.example.com/dashboard",
+				},
+				APIEndpoint: "https://cloudcontroller.example.com",
+				App: plugin_models.GetAppModel{
+					Guid:      "source-app-guid",
+					Name:      "app-name",
+					SpaceGuid: "staging-space-guid",
+				},
+				SpaceName:  "staging",
+				JSONClient: jsonClient,
+			}
+			expected.Service.ServiceOffering.Name = "app-autoscaler"
+			Expect(dependencies).To(Equal(expected))
+
+			Expect(jsonClient.DoCalls[0].Receives.URL).To(Equal("https://cloudcontroller.example.com/v2/organizations/some-org-guid/spaces?q=name%3Astaging"))
+			Expect(jsonClient.DoCalls[1].Receives.URL).To(Equal("https://cloudcontroller.example.com/v2/spaces/staging-space-guid/apps?q=name%3Aapp-name"))
+			Expect(jsonClient.DoCalls[2].Receives.URL).To(Equal("https://cloudcontroller.example.com/v2/spaces/staging-space-guid/service_instances?q=name%3Aservice-name"))
+			Expect(jsonClient.DoCalls[3].Receives.URL).To(Equal("https://cloudcontroller.example.com/v2/service_plans/some-plan-guid"))
+			Expect(jsonClient.DoCalls[4].Receives.URL).To(Equal("https://cloudcontroller.example.com/v2/services/some-service-guid"))
+		})
+
+		Context("when the service instance is an App Autoscaler's", func() {
+			It("copies the settings from the app's policy", func() {
+				jsonClient.DoCalls[4].ResponseJSON = `{"entity": {"label": "autoscaler"}}`
+				jsonClient.DoCalls[5].ResponseJSON = `{"resources": [{"metadata": {"guid": "source-binding-guid"}}]}`
+				jsonClient.DoCalls[6].ResponseJSON = `{"instance_min_count": 3, "instance_max_count": 9, "scaling_rules": [
+					{"metric_type": "cpu", "threshold": 25, "operator": "<", "adjustment": "-1"},
+					{"metric_type": "cpu", "threshold": 75, "operator": ">=", "adjustment": "+1"}
+				]}`
+				base.AutoscalerAPI = "https://autoscaler.example.com"
+
+				source, err := plugin.ResolveDependenciesInSpace(base, "some-org-guid", "staging", "app-name", "service-name")
+				Expect(err).NotTo(HaveOccurred())
+
+				destinationClient := mocks.NewJSONClient(3)
+				destinationClient.DoCalls[0].ResponseJSON = `{"Resources": [{"Metadata": {"GUID": "dest-binding-guid"}}]}`
+				destinationClient.DoCalls[1].ResponseJSON = `{"min_instances": 2, "max_instances": 5, "cpu_min_threshold": 20, "cpu_max_threshold": 80, "enabled": true}`
+				destinationClient.DoCalls[1].Returns.Headers = http.Header{"Etag": []string{`"some-version"`}}
+				destination := plugin.CLIDependencies{
+					AppName:     "app-green",
+					ServiceName: "other-service",
+					Service:     plugin_models.GetService_Model{Guid: "dest-service-guid", DashboardUrl: "http://autoscaling.example.com/dashboard"},
+					APIEndpoint: "https://cloudcontroller.example.com",
+					App:         plugin_models.GetAppModel{Guid: "dest-app-guid"},
+					JSONClient:  destinationClient,
+					UI:          plugin.UI{Out: &bytes.Buffer{}},
+				}
+
+				Expect(plugin.NewPlugin().CopyWithError(source, destination, true)).To(Succeed())
+				Expect(jsonClient.DoCalls[6].Receives.URL).To(Equal("https://autoscaler.example.com/v1/apps/source-app-guid/policy"))
+				Expect(destinationClient.DoCalls[2].Receives.RequestData).To(Equal(&plugin.AutoscalingBinding{
+					AppGuid:         "dest-app-guid",
+					MinInstances:    3,
+					MaxInstances:    9,
+					CPUMinThreshold: 25,
+					CPUMaxThreshold: 75,
+					Enabled:         true,
+				}))
+			})
+		})
+
+		Context("failure cases", func() {
+			It("fails when the space doesn't exist", func() {
+				jsonClient.DoCalls[0].ResponseJSON = `{"resources": []}`
+
+				_, err := plugin.ResolveDependenciesInSpace(base, "some-org-guid", "staging", "app-name", "service-name")
+				Expect(err).To(MatchError("couldn't find space staging"))
+			})
+
+			It("fails when the app isn't in the space", func() {
+				jsonClient.DoCalls[1].ResponseJSON = `{"resources": []}`
+
+				_, err := plugin.ResolveDependenciesInSpace(base, "some-org-guid", "staging", "app-name", "service-name")
+				Expect(err).To(MatchError("couldn't find app app-name in space staging"))
+			})
+
+			It("fails when the service instance isn't in the space", func() {
+				jsonClient.DoCalls[2].ResponseJSON = `{"resources": []}`
+
+				_, err := plugin.ResolveDependenciesInSpace(base, "some-org-guid", "staging", "app-name", "service-name")
+				Expect(err).To(MatchError("couldn't find service instance service-name in space staging"))
+			})
+		})
+	})
+})
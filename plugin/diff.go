@@ -0,0 +1,185 @@
+package plugin
+
+import (
+	"code.cloudfoundry.org/cli/plugin/models"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+)
+
+// FieldChange is a setting that differs between two bindings.
+type FieldChange struct {
+	Field string `json:"field"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+}
+
+func (c FieldChange) String() string {
+	return fmt.Sprintf("%s: %s -> %s", c.Field, c.From, c.To)
+}
+
+// DiffBindings lists the settings that differ between two bindings, in the
+// order they appear in the autoscaling API. The app GUID isn't a setting and
+// is ignored.
+func DiffBindings(from, to AutoscalingBinding) []FieldChange {
+	var changes []FieldChange
+
+	addInt := func(field string, from, to int) {
+		if from != to {
+			changes = append(changes, FieldChange{Field: field, From: strconv.Itoa(from), To: strconv.Itoa(to)})
+		}
+	}
+
+	addInt("min_instances", from.MinInstances, to.MinInstances)
+	addInt("max_instances", from.MaxInstances, to.MaxInstances)
+	addInt("cpu_min_threshold", from.CPUMinThreshold, to.CPUMinThreshold)
+	addInt("cpu_max_threshold", from.CPUMaxThreshold, to.CPUMaxThreshold)
+
+	if from.Enabled != to.Enabled {
+		changes = append(changes, FieldChange{Field: "enabled", From: strconv.FormatBool(from.Enabled), To: strconv.FormatBool(to.Enabled)})
+	}
+
+	return changes
+}
+
+// DriftError is returned when the compared settings differ.
+type DriftError struct {
+	Changes []FieldChange
+}
+
+func (e DriftError) Error() string {
+	return "the autoscaling settings differ"
+}
+
+func bindingLines(binding AutoscalingBinding) []string {
+	return []string{
+		fmt.Sprintf("min_instances: %d", binding.MinInstances),
+		fmt.Sprintf("max_instances: %d", binding.MaxInstances),
+		fmt.Sprintf("cpu_min_threshold: %d", binding.CPUMinThreshold),
+		fmt.Sprintf("cpu_max_threshold: %d", binding.CPUMaxThreshold),
+		fmt.Sprintf("enabled: %t", binding.Enabled),
+	}
+}
+
+// RenderBindingDiff writes a unified diff of the settings, in policy file
+// form, and returns a DriftError if they differ.
+func RenderBindingDiff(w io.Writer, fromLabel, toLabel string, from, to AutoscalingBinding) error {
+	changes := DiffBindings(from, to)
+	if len(changes) == 0 {
+		return nil
+	}
+
+	fmt.Fprintf(w, "--- %s\n+++ %s\n", fromLabel, toLabel)
+
+	fromLines, toLines := bindingLines(from), bindingLines(to)
+	for i := range fromLines {
+		if fromLines[i] == toLines[i] {
+			fmt.Fprintf(w, " %s\n", fromLines[i])
+			continue
+		}
+
+		fmt.Fprintf(w, "-%s\n+%s\n", fromLines[i], toLines[i])
+	}
+
+	return DriftError{Changes: changes}
+}
+
+func bindingLabel(dependencies CLIDependencies) string {
+	label := fmt.Sprintf("%s (%s)", dependencies.AppName, dependencies.ServiceName)
+	if dependencies.SpaceName != "" {
+		label = fmt.Sprintf("%s in %s", label, dependencies.SpaceName)
+	}
+
+	return label
+}
+
+// DiffAppsWithError compares the settings of two apps' bindings.
+func (p *Plugin) DiffAppsWithError(w io.Writer, from, to CLIDependencies) error {
+	fromBinding, err := p.fetchBinding(from)
+	if err != nil {
+		return err
+	}
+
+	toBinding, err := p.fetchBinding(to)
+	if err != nil {
+		return err
+	}
+
+	return RenderBindingDiff(w, bindingLabel(from), bindingLabel(to), fromBinding.Binding, toBinding.Binding)
+}
+
+// DiffPolicyWithError compares the settings of the app's binding with a
+// policy file.
+func (p *Plugin) DiffPolicyWithError(w io.Writer, dependencies CLIDependencies, policyPath string) error {
+	policy, err := LoadPolicy(policyPath)
+	if err != nil {
+		return err
+	}
+
+	current, err := p.fetchBinding(dependencies)
+	if err != nil {
+		return err
+	}
+
+	return RenderBindingDiff(w, bindingLabel(dependencies), policyPath, current.Binding, policy.Binding())
+}
+
+func (p *Plugin) runDiff(cliConnection cliConnection, args []string) error {
+	var (
+		policyPath   string
+		otherSpace   string
+		otherService string
+	)
+
+	flagSet := flag.NewFlagSet("diff-autoscaling", flag.ContinueOnError)
+	flagSet.StringVar(&policyPath, "policy", "", "(optional) policy file to compare the app with")
+	flagSet.StringVar(&otherSpace, "other-space", "", "(optional) space of the other app")
+	flagSet.StringVar(&otherService, "other-service", "", "(optional) service instance of the other app")
+	err := flagSet.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if policyPath != "" {
+		dependencies, err := p.FetchCLIDependencies(cliConnection, flagSet.Args())
+		if err != nil {
+			return err
+		}
+
+		return p.DiffPolicyWithError(os.Stdout, dependencies, policyPath)
+	}
+
+	if flagSet.NArg() != 3 {
+		return fmt.Errorf("provide APP_NAME, OTHER_APP and SERVICE_INSTANCE, or --policy, on command line")
+	}
+
+	appName, otherApp, serviceName := flagSet.Arg(0), flagSet.Arg(1), flagSet.Arg(2)
+	if otherService == "" {
+		otherService = serviceName
+	}
+
+	from, err := p.FetchCLIDependencies(cliConnection, []string{appName, serviceName})
+	if err != nil {
+		return err
+	}
+
+	var to CLIDependencies
+	if otherSpace == "" {
+		to, err = p.FetchCLIDependencies(cliConnection, []string{otherApp, otherService})
+	} else {
+		var org plugin_models.Organization
+		org, err = cliConnection.GetCurrentOrg()
+		if err != nil {
+			return fmt.Errorf("couldn't get current org: %s", err)
+		}
+
+		to, err = ResolveDependenciesInSpace(from, org.Guid, otherSpace, otherApp, otherService)
+	}
+	if err != nil {
+		return err
+	}
+
+	return p.DiffAppsWithError(os.Stdout, from, to)
+}
@@ -0,0 +1,146 @@
+package plugin_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+
+	"code.cloudfoundry.org/cli/plugin/models"
+	"github.com/phopper-pivotal/autoscaling-cli-plugin/mocks"
+	"github.com/phopper-pivotal/autoscaling-cli-plugin/plugin"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DiffBindings", func() {
+	It("lists the settings that differ", func() {
+		from := plugin.AutoscalingBinding{AppGuid: "some-app-guid", MinInstances: 2, MaxInstances: 5, CPUMinThreshold: 20, CPUMaxThreshold: 80, Enabled: true}
+		to := plugin.AutoscalingBinding{MinInstances: 2, MaxInstances: 8, CPUMinThreshold: 20, CPUMaxThreshold: 70}
+
+		Expect(plugin.DiffBindings(from, to)).To(Equal([]plugin.FieldChange{
+			{Field: "max_instances", From: "5", To: "8"},
+			{Field: "cpu_max_threshold", From: "80", To: "70"},
+			{Field: "enabled", From: "true", To: "false"},
+		}))
+	})
+
+	It("returns nothing for the same settings", func() {
+		binding := plugin.AutoscalingBinding{MinInstances: 2, MaxInstances: 5}
+
+		Expect(plugin.DiffBindings(binding, binding)).To(BeEmpty())
+	})
+})
+
+var _ = Describe("RenderBindingDiff", func() {
+	It("writes a unified diff and reports the drift", func() {
+		buffer := &bytes.Buffer{}
+		from := plugin.AutoscalingBinding{MinInstances: 2, MaxInstances: 5, CPUMinThreshold: 20, CPUMaxThreshold: 80, Enabled: true}
+		to := plugin.AutoscalingBinding{MinInstances: 2, MaxInstances: 10, CPUMinThreshold: 20, CPUMaxThreshold: 80, Enabled: false}
+
+		err := plugin.RenderBindingDiff(buffer, "app-name (scaler)", "policy.yml", from, to)
+		Expect(err).To(MatchError("the autoscaling settings differ"))
+		Expect(err.(plugin.DriftError).Changes).To(HaveLen(2))
+		Expect(buffer.String()).To(Equal(`--- app-name (scaler)
++++ policy.yml
+ min_instances: 2
+-max_instances: 5
++max_instances: 10
+ cpu_min_threshold: 20
+ cpu_max_threshold: 80
+-enabled: true
++enabled: false
+`))
+	})
+
+	It("writes nothing when the settings are the same", func() {
+		buffer := &bytes.Buffer{}
+		binding := plugin.AutoscalingBinding{MinInstances: 2, MaxInstances: 5}
+
+		Expect(plugin.RenderBindingDiff(buffer, "a", "b", binding, binding)).To(Succeed())
+		Expect(buffer.String()).To(BeEmpty())
+	})
+})
+
+var _ = Describe("Diffing deployed settings", func() {
+	var (
+		p            *plugin.Plugin
+		jsonClient   *mocks.JSONClient
+		dependencies plugin.CLIDependencies
+		buffer       *bytes.Buffer
+	)
+
+	BeforeEach(func() {
+		p = plugin.NewPlugin()
+		jsonClient = mocks.NewJSONClient(4)
+		jsonClient.DoCalls[0].ResponseJSON = `{"Resources": [{"Metadata": {"GUID": "some-binding-guid"}}]}`
+		jsonClient.DoCalls[1].ResponseJSON = `{"min_instances": 2, "max_instances": 5, "cpu_min_threshold": 20, "cpu_max_threshold": 80, "enabled": true}`
+		jsonClient.DoCalls[2].ResponseJSON = `{"Resources": [{"Metadata": {"GUID": "other-binding-guid"}}]}`
+		jsonClient.DoCalls[3].ResponseJSON = `{"min_instances": 2, "max_instances": 8, "cpu_min_threshold": 20, "cpu_max_threshold": 80, "enabled": true}`
+
+		buffer = &bytes.Buffer{}
+		dependencies = plugin.CLIDependencies{
+			AppName:     "app-name",
+			ServiceName: "scaler",
+			Service: plugin_models.GetService_Model{
+				Guid:         "some-service-guid",
+				DashboardUrl: "http://autoscaling.example.com/dashboard",
+			},
+			APIEndpoint: "https://cloudcontroller.example.com",
+			App:         plugin_models.GetAppModel{Guid: "some-app-guid"},
+			SpaceName:   "staging",
+			JSONClient:  jsonClient,
+		}
+	})
+
+	Describe("DiffAppsWithError", func() {
+		It("compares the bindings of both apps", func() {
+			other := dependencies
+			other.App.Guid = "other-app-guid"
+			other.SpaceName = "production"
+
+			err := p.DiffAppsWithError(buffer, dependencies, other)
+			Expect(err).To(MatchError("the autoscaling settings differ"))
+			Expect(jsonClient.DoCalls[3].Receives.URL).To(Equal("http://autoscaling.example.com/api/bindings/other-binding-guid"))
+			Expect(buffer.String()).To(HavePrefix("--- app-name (scaler) in staging\n+++ app-name (scaler) in production\n"))
+			Expect(buffer.String()).To(ContainSubstring("-max_instances: 5\n+max_instances: 8\n"))
+		})
+	})
+
+	Describe("DiffPolicyWithError", func() {
+		var policyPath string
+
+		BeforeEach(func() {
+			policyFile, err := ioutil.TempFile("", "policy")
+			Expect(err).NotTo(HaveOccurred())
+			policyPath = policyFile.Name()
+
+			_, err = policyFile.WriteString("min_instances: 2\nmax_instances: 5\ncpu_min_threshold: 20\ncpu_max_threshold: 80\n")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(policyFile.Close()).To(Succeed())
+		})
+
+		AfterEach(func() {
+			os.Remove(policyPath)
+		})
+
+		It("succeeds when the app matches the policy", func() {
+			Expect(p.DiffPolicyWithError(buffer, dependencies, policyPath)).To(Succeed())
+			Expect(buffer.String()).To(BeEmpty())
+		})
+
+		It("reports drift from the policy", func() {
+			jsonClient.DoCalls[1].ResponseJSON = `{"min_instances": 2, "max_instances": 5, "cpu_min_threshold": 20, "cpu_max_threshold": 70, "enabled": true}`
+
+			err := p.DiffPolicyWithError(buffer, dependencies, policyPath)
+			Expect(err).To(MatchError("the autoscaling settings differ"))
+			Expect(buffer.String()).To(ContainSubstring("-cpu_max_threshold: 70\n+cpu_max_threshold: 80\n"))
+		})
+
+		It("fails when the policy can't be read", func() {
+			err := p.DiffPolicyWithError(buffer, dependencies, "/does/not/exist.yml")
+			Expect(err).To(MatchError(ContainSubstring("couldn't read policy file")))
+			Expect(jsonClient.DoCallCount).To(Equal(0))
+		})
+	})
+})
@@ -0,0 +1,60 @@
+package plugin
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"code.cloudfoundry.org/cli/plugin/models"
+)
+
+const (
+	serviceOfferingEnv               = "AUTOSCALING_SERVICE_OFFERING"
+	defaultAutoscalerServiceOffering = "app-autoscaler"
+)
+
+// autoscalerServiceOffering returns the label of the autoscaler's service
+// offering or plan, from AUTOSCALING_SERVICE_OFFERING if set.
+func autoscalerServiceOffering() string {
+	if label := os.Getenv(serviceOfferingEnv); label != "" {
+		return label
+	}
+
+	return defaultAutoscalerServiceOffering
+}
+
+// findAutoscalerServices returns the names of the services, as listed on the
+// app, that are autoscaler service instances of either backend.
+func findAutoscalerServices(cliConnection cliConnection, services []plugin_models.GetApp_ServiceSummary) ([]string, error) {
+	var names []string
+	for _, summary := range services {
+		service, err := cliConnection.GetService(summary.Name)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't get service named %s: %s", summary.Name, err)
+		}
+
+		if isAutoscalerServiceOffering(service.ServiceOffering.Name) || isAutoscalerServiceOffering(service.ServicePlan.Name) {
+			names = append(names, summary.Name)
+		}
+	}
+
+	return names, nil
+}
+
+// detectAutoscalerService returns the autoscaler service instance among the
+// app's services, failing unless there is exactly one.
+func detectAutoscalerService(cliConnection cliConnection, appName string, services []plugin_models.GetApp_ServiceSummary) (string, error) {
+	names, err := findAutoscalerServices(cliConnection, services)
+	if err != nil {
+		return "", err
+	}
+
+	switch len(names) {
+	case 0:
+		return "", fmt.Errorf("no %s service instances are bound to %s, provide SERVICE_INSTANCE on command line", strings.Join(autoscalerServiceOfferings(), " or "), appName)
+	case 1:
+		return names[0], nil
+	default:
+		return "", fmt.Errorf("several %s service instances are bound to %s, provide one of them as SERVICE_INSTANCE on command line: %s", strings.Join(autoscalerServiceOfferings(), " or "), appName, strings.Join(names, ", "))
+	}
+}
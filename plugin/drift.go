@@ -0,0 +1,517 @@
+package plugin
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const defaultDriftConcurrency = 4
+
+// DriftStatus is how an app's live settings compare with its policy.
+type DriftStatus string
+
+const (
+	DriftStatusMatch         DriftStatus = "match"
+	DriftStatusDrift         DriftStatus = "drift"
+	DriftStatusMissingPolicy DriftStatus = "missing-policy"
+	DriftStatusNoAutoscaling DriftStatus = "no-autoscaling"
+	DriftStatusError         DriftStatus = "error"
+)
+
+type DriftResult struct {
+	Space   string        `json:"space"`
+	App     string        `json:"app"`
+	Policy  string        `json:"policy,omitempty"`
+	Status  DriftStatus   `json:"status"`
+	Changes []FieldChange `json:"changes,omitempty"`
+	Error   string        `json:"error,omitempty"`
+}
+
+// Failed tells whether the app fails the drift check: its autoscaling
+// drifted from its policy, or it has a policy but no autoscaling at all.
+func (r DriftResult) Failed() bool {
+	return r.Status == DriftStatusDrift || (r.Status == DriftStatusNoAutoscaling && r.Policy != "")
+}
+
+// DriftReportError is returned after the report was written when apps
+// failed the drift check or couldn't be checked, so the command exits with
+// a non-zero status.
+type DriftReportError struct {
+	Failed  int
+	Errored int
+}
+
+func (e DriftReportError) Error() string {
+	return fmt.Sprintf("%d apps drifted from their policies and %d couldn't be checked", e.Failed, e.Errored)
+}
+
+type DriftReport struct {
+	Org     string              `json:"org"`
+	Summary map[DriftStatus]int `json:"summary"`
+	Apps    []DriftResult       `json:"apps"`
+}
+
+// ccV3Resource holds the parts of cloud controller v3 spaces and apps the
+// drift report needs.
+type ccV3Resource struct {
+	GUID     string `json:"guid"`
+	Name     string `json:"name"`
+	Metadata struct {
+		Labels map[string]string `json:"labels"`
+	} `json:"metadata"`
+}
+
+type ccV3Resources struct {
+	Pagination struct {
+		Next *struct {
+			Href string `json:"href"`
+		} `json:"next"`
+	} `json:"pagination"`
+	Resources []ccV3Resource `json:"resources"`
+}
+
+// getAllCCResources fetches every page of a cloud controller v2 list.
+func getAllCCResources(dependencies CLIDependencies, path string, query url.Values) ([]ccResource, error) {
+	pageURL, err := getCCURL(dependencies.APIEndpoint, path, query)
+	if err != nil {
+		return nil, err
+	}
+
+	var resources []ccResource
+	for pageURL != "" {
+		var page ccResources
+		err := dependencies.JSONClient.Do("GET", pageURL, nil, &page)
+		if err != nil {
+			return nil, err
+		}
+
+		resources = append(resources, page.Resources...)
+
+		pageURL = ""
+		if page.NextURL != "" {
+			next, err := url.Parse(page.NextURL)
+			if err != nil {
+				return nil, fmt.Errorf("invalid next page URL from cloud controller: %s", page.NextURL)
+			}
+
+			pageURL, err = getCCURL(dependencies.APIEndpoint, next.Path, next.Query())
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return resources, nil
+}
+
+// getAllCCV3Resources fetches every page of a cloud controller v3 list.
+func getAllCCV3Resources(dependencies CLIDependencies, path string, query url.Values) ([]ccV3Resource, error) {
+	pageURL, err := getCCURL(dependencies.APIEndpoint, path, query)
+	if err != nil {
+		return nil, err
+	}
+
+	var resources []ccV3Resource
+	for pageURL != "" {
+		var page ccV3Resources
+		err := dependencies.JSONClient.Do("GET", pageURL, nil, &page)
+		if err != nil {
+			return nil, err
+		}
+
+		resources = append(resources, page.Resources...)
+
+		pageURL = ""
+		if page.Pagination.Next != nil {
+			pageURL = page.Pagination.Next.Href
+		}
+	}
+
+	return resources, nil
+}
+
+// LoadPolicies loads every policy file in dir, keyed by file name without
+// the extension.
+func LoadPolicies(dir string) (map[string]Policy, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read policies directory: %s", err)
+	}
+
+	policies := map[string]Policy{}
+	for _, file := range files {
+		extension := filepath.Ext(file.Name())
+		if file.IsDir() || (extension != ".yml" && extension != ".yaml") {
+			continue
+		}
+
+		policy, err := LoadPolicy(filepath.Join(dir, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		policies[strings.TrimSuffix(file.Name(), extension)] = policy
+	}
+
+	return policies, nil
+}
+
+// DriftChecker compares the live autoscaling settings of every app in an org
+// with the policies declared for them.
+type DriftChecker struct {
+	Dependencies CLIDependencies
+
+	// Policies are keyed by app name or, for apps with the Label label, by
+	// the label's value
+	Policies map[string]Policy
+	Label    string
+
+	// Concurrency is how many apps are checked at once
+	Concurrency int
+}
+
+type driftJob struct {
+	index     int
+	space     string
+	app       ccV3Resource
+	instances map[string]ccResource
+
+	// offerings are the service offering labels of the plans
+	offerings map[string]string
+}
+
+// Check checks every app in the org. Apps that can't be checked are reported
+// with an error status rather than failing the whole report.
+func (c DriftChecker) Check(orgGUID, orgName string) (DriftReport, error) {
+	plans, err := findAutoscalerPlans(c.Dependencies)
+	if err != nil {
+		return DriftReport{}, err
+	}
+
+	var planGUIDs []string
+	offerings := map[string]string{}
+	for _, plan := range plans {
+		planGUIDs = append(planGUIDs, plan.GUID)
+		offerings[plan.GUID] = plan.Offering
+	}
+
+	spaces, err := getAllCCV3Resources(c.Dependencies, "/v3/spaces", url.Values{"organization_guids": []string{orgGUID}})
+	if err != nil {
+		return DriftReport{}, fmt.Errorf("couldn't list the spaces of org %s: %s", orgName, err)
+	}
+
+	var results []DriftResult
+	var jobs []driftJob
+	for _, space := range spaces {
+		instances, err := getAllCCResources(c.Dependencies, fmt.Sprintf("/v2/spaces/%s/service_instances", space.GUID), url.Values{
+			"q": []string{fmt.Sprintf("service_plan_guid IN %s", strings.Join(planGUIDs, ","))},
+		})
+		if err != nil {
+			results = append(results, DriftResult{Space: space.Name, Status: DriftStatusError, Error: fmt.Sprintf("couldn't list service instances: %s", err)})
+			continue
+		}
+
+		instancesByGUID := map[string]ccResource{}
+		for _, instance := range instances {
+			instancesByGUID[instance.Metadata.GUID] = instance
+		}
+
+		apps, err := getAllCCV3Resources(c.Dependencies, "/v3/apps", url.Values{"space_guids": []string{space.GUID}})
+		if err != nil {
+			results = append(results, DriftResult{Space: space.Name, Status: DriftStatusError, Error: fmt.Sprintf("couldn't list apps: %s", err)})
+			continue
+		}
+
+		for _, app := range apps {
+			jobs = append(jobs, driftJob{index: len(jobs), space: space.Name, app: app, instances: instancesByGUID, offerings: offerings})
+		}
+	}
+
+	concurrency := c.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	appResults := make([]DriftResult, len(jobs))
+	queue := make(chan driftJob)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range queue {
+				appResults[job.index] = c.checkApp(job)
+			}
+		}()
+	}
+
+	for _, job := range jobs {
+		queue <- job
+	}
+	close(queue)
+	wg.Wait()
+
+	results = append(results, appResults...)
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Space != results[j].Space {
+			return results[i].Space < results[j].Space
+		}
+		return results[i].App < results[j].App
+	})
+
+	report := DriftReport{Org: orgName, Summary: map[DriftStatus]int{}, Apps: results}
+	for _, result := range results {
+		report.Summary[result.Status]++
+	}
+
+	return report, nil
+}
+
+func (c DriftChecker) checkApp(job driftJob) DriftResult {
+	result := DriftResult{Space: job.space, App: job.app.Name}
+
+	policyName := job.app.Name
+	if c.Label != "" && job.app.Metadata.Labels[c.Label] != "" {
+		policyName = job.app.Metadata.Labels[c.Label]
+	}
+
+	policy, hasPolicy := c.Policies[policyName]
+	if hasPolicy {
+		result.Policy = policyName
+	}
+
+	bindings, err := getAllCCResources(c.Dependencies, "/v2/service_bindings", url.Values{
+		"q": []string{fmt.Sprintf("app_guid:%s", job.app.GUID)},
+	})
+	if err != nil {
+		result.Status = DriftStatusError
+		result.Error = fmt.Sprintf("couldn't retrieve service bindings: %s", err)
+		return result
+	}
+
+	var binding, instance ccResource
+	found := false
+	for _, candidate := range bindings {
+		if candidateInstance, ok := job.instances[candidate.Entity.ServiceInstanceGUID]; ok {
+			binding, instance, found = candidate, candidateInstance, true
+			break
+		}
+	}
+
+	switch {
+	case !found:
+		result.Status = DriftStatusNoAutoscaling
+		return result
+	case !hasPolicy:
+		result.Status = DriftStatusMissingPolicy
+		return result
+	}
+
+	dependencies := c.Dependencies
+	dependencies.App.Guid = job.app.GUID
+	dependencies.Service.DashboardUrl = instance.Entity.DashboardURL
+	dependencies.Service.ServiceOffering.Name = job.offerings[instance.Entity.ServicePlanGUID]
+
+	bindingURL, err := backendFor(dependencies).URL(dependencies, binding)
+	if err == nil {
+		var current remoteBinding
+		current, err = getBinding(dependencies, bindingURL)
+		if err == nil {
+			result.Changes = DiffBindings(current.Binding, policy.Binding())
+		}
+	}
+	if err != nil {
+		result.Status = DriftStatusError
+		result.Error = err.Error()
+		return result
+	}
+
+	result.Status = DriftStatusMatch
+	if len(result.Changes) > 0 {
+		result.Status = DriftStatusDrift
+	}
+
+	return result
+}
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Errors   int             `xml:"errors,attr"`
+	Skipped  int             `xml:"skipped,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	ClassName string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// RenderDriftReport writes the report as json or as a JUnit XML test suite
+// with a test case per app. Apps without a policy are skipped test cases,
+// and apps that have a policy but no autoscaling fail.
+func RenderDriftReport(w io.Writer, report DriftReport, format string) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	case "junit":
+		suite := junitTestSuite{Name: fmt.Sprintf("autoscaling drift in org %s", report.Org)}
+		for _, result := range report.Apps {
+			testCase := junitTestCase{ClassName: result.Space, Name: result.App}
+
+			switch result.Status {
+			case DriftStatusDrift:
+				var changes []string
+				for _, change := range result.Changes {
+					changes = append(changes, change.String())
+				}
+				testCase.Failure = &junitMessage{Message: fmt.Sprintf("drifted from policy %s", result.Policy), Text: strings.Join(changes, "\n")}
+				suite.Failures++
+			case DriftStatusNoAutoscaling:
+				if result.Policy != "" {
+					testCase.Failure = &junitMessage{Message: fmt.Sprintf("has policy %s but no autoscaling", result.Policy)}
+					suite.Failures++
+				} else {
+					testCase.Skipped = &junitMessage{Message: "no autoscaling and no policy"}
+					suite.Skipped++
+				}
+			case DriftStatusMissingPolicy:
+				testCase.Skipped = &junitMessage{Message: "no policy"}
+				suite.Skipped++
+			case DriftStatusError:
+				testCase.Error = &junitMessage{Message: result.Error}
+				suite.Errors++
+			}
+
+			suite.Cases = append(suite.Cases, testCase)
+		}
+		suite.Tests = len(suite.Cases)
+
+		output, err := xml.MarshalIndent(junitTestSuites{Suites: []junitTestSuite{suite}}, "", "  ")
+		if err != nil {
+			return err // not tested
+		}
+
+		fmt.Fprintf(w, "%s%s\n", xml.Header, output)
+		return nil
+	default:
+		return fmt.Errorf("unknown format %s, use json or junit", format)
+	}
+}
+
+func (p *Plugin) runDriftReport(cliConnection cliConnection, args []string) error {
+	var (
+		policiesDir string
+		orgName     string
+		label       string
+		format      string
+		concurrency int
+	)
+
+	flagSet := flag.NewFlagSet("autoscaling-drift-report", flag.ContinueOnError)
+	flagSet.StringVar(&policiesDir, "policies", "", "directory of policy files named after the apps")
+	flagSet.StringVar(&orgName, "org", "", "(optional) org to report on, defaults to the targeted org")
+	flagSet.StringVar(&label, "label", "", "(optional) app label naming the app's policy file, for apps named differently")
+	flagSet.StringVar(&format, "format", "json", "(optional) json or junit")
+	flagSet.IntVar(&concurrency, "concurrency", defaultDriftConcurrency, "(optional) how many apps to check at once")
+	err := flagSet.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if policiesDir == "" {
+		return fmt.Errorf("provide --policies on command line")
+	}
+
+	if flagSet.NArg() > 0 {
+		return fmt.Errorf("too many arguments provided")
+	}
+
+	if format != "json" && format != "junit" {
+		return fmt.Errorf("unknown format %s, use json or junit", format)
+	}
+
+	policies, err := LoadPolicies(policiesDir)
+	if err != nil {
+		return err
+	}
+
+	dependencies, err := p.fetchConnectionDependencies(cliConnection)
+	if err != nil {
+		return err
+	}
+
+	var orgGUID string
+	if orgName == "" {
+		org, err := cliConnection.GetCurrentOrg()
+		if err != nil {
+			return fmt.Errorf("couldn't get current org: %s", err)
+		}
+		orgGUID, orgName = org.Guid, org.Name
+	} else {
+		orgs, err := getAllCCResources(dependencies, "/v2/organizations", url.Values{"q": []string{fmt.Sprintf("name:%s", orgName)}})
+		if err != nil {
+			return fmt.Errorf("couldn't look up org %s: %s", orgName, err)
+		}
+		if len(orgs) == 0 {
+			return fmt.Errorf("couldn't find org %s", orgName)
+		}
+		orgGUID = orgs[0].Metadata.GUID
+	}
+
+	checker := DriftChecker{
+		Dependencies: dependencies,
+		Policies:     policies,
+		Label:        label,
+		Concurrency:  concurrency,
+	}
+
+	report, err := checker.Check(orgGUID, orgName)
+	if err != nil {
+		return err
+	}
+
+	if err := RenderDriftReport(os.Stdout, report, format); err != nil {
+		return err
+	}
+
+	var driftErr DriftReportError
+	for _, result := range report.Apps {
+		if result.Failed() {
+			driftErr.Failed++
+		} else if result.Status == DriftStatusError {
+			driftErr.Errored++
+		}
+	}
+	if driftErr.Failed > 0 || driftErr.Errored > 0 {
+		return driftErr
+	}
+
+	return nil
+}
@@ -0,0 +1,256 @@
+package plugin_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	"github.com/phopper-pivotal/autoscaling-cli-plugin/plugin"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Drift", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "policies")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	writePolicy := func(name, contents string) {
+		Expect(ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0600)).To(Succeed())
+	}
+
+	Describe("LoadPolicies", func() {
+		It("loads the policy files keyed by name", func() {
+			writePolicy("app-a.yml", "min_instances: 2\nmax_instances: 10\n")
+			writePolicy("app-b.yaml", "min_instances: 3\nmax_instances: 6\n")
+			writePolicy("README.md", "not a policy")
+
+			policies, err := plugin.LoadPolicies(dir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(policies).To(HaveLen(2))
+			Expect(policies["app-a"].MaxInstances).To(Equal(10))
+			Expect(policies["app-b"].MaxInstances).To(Equal(6))
+		})
+
+		Context("when a policy file is invalid", func() {
+			It("returns an error", func() {
+				writePolicy("app-a.yml", "min_instance: 2\n")
+
+				_, err := plugin.LoadPolicies(dir)
+				Expect(err).To(MatchError(ContainSubstring("couldn't parse policy file")))
+			})
+		})
+
+		Context("when the directory doesn't exist", func() {
+			It("returns an error", func() {
+				_, err := plugin.LoadPolicies(filepath.Join(dir, "missing"))
+				Expect(err).To(MatchError(ContainSubstring("couldn't read policies directory")))
+			})
+		})
+	})
+
+	Describe("DriftChecker", func() {
+		var (
+			server    *httptest.Server
+			responses map[string]string
+			checker   plugin.DriftChecker
+		)
+
+		BeforeEach(func() {
+			responses = map[string]string{}
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				response, ok := responses[r.URL.RequestURI()]
+				if !ok {
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+				w.Write([]byte(response))
+			}))
+
+			responses["/v2/services?q=label%3Aapp-autoscaler"] = `{"resources": [{"metadata": {"guid": "service-guid"}}]}`
+			responses["/v2/services/service-guid/service_plans"] = `{"resources": [{"metadata": {"guid": "plan-guid"}}]}`
+			responses["/v2/services?q=label%3Aautoscaler"] = `{"resources": [{"metadata": {"guid": "app-autoscaler-service-guid"}}]}`
+			responses["/v2/services/app-autoscaler-service-guid/service_plans"] = `{"resources": [{"metadata": {"guid": "app-autoscaler-plan-guid"}}]}`
+			responses["/v3/spaces?organization_guids=org-guid"] = `{
+				"pagination": {"next": {"href": "` + server.URL + `/v3/spaces?organization_guids=org-guid&page=2"}},
+				"resources": [{"guid": "dev-guid", "name": "dev"}]
+			}`
+			responses["/v3/spaces?organization_guids=org-guid&page=2"] = `{"resources": [{"guid": "broken-guid", "name": "broken"}]}`
+			responses["/v2/spaces/dev-guid/service_instances?q=service_plan_guid+IN+plan-guid%2Capp-autoscaler-plan-guid"] = `{
+				"resources": [
+					{"metadata": {"guid": "instance-guid"}, "entity": {"dashboard_url": "` + server.URL + `/dashboard", "service_plan_guid": "plan-guid"}},
+					{"metadata": {"guid": "app-autoscaler-instance-guid"}, "entity": {"service_plan_guid": "app-autoscaler-plan-guid"}}
+				]
+			}`
+			responses["/v3/apps?space_guids=dev-guid"] = `{"resources": [
+				{"guid": "match-guid", "name": "app-match"},
+				{"guid": "drift-guid", "name": "app-drift"},
+				{"guid": "unlisted-guid", "name": "app-unlisted"},
+				{"guid": "plain-guid", "name": "app-plain"},
+				{"guid": "labelled-guid", "name": "app-labelled", "metadata": {"labels": {"autoscaling-policy": "app-match"}}},
+				{"guid": "failing-guid", "name": "app-failing"},
+				{"guid": "app-autoscaler-guid", "name": "app-app-autoscaler"}
+			]}`
+
+			for _, app := range []string{"match", "drift", "unlisted", "labelled"} {
+				responses["/v2/service_bindings?q=app_guid%3A"+app+"-guid"] = `{"resources": [
+					{"metadata": {"guid": "other-binding-guid"}, "entity": {"service_instance_guid": "other-instance-guid"}},
+					{"metadata": {"guid": "` + app + `-binding-guid"}, "entity": {"service_instance_guid": "instance-guid"}}
+				]}`
+			}
+			responses["/v2/service_bindings?q=app_guid%3Aplain-guid"] = `{"resources": []}`
+			responses["/v2/service_bindings?q=app_guid%3Afailing-guid"] = `{"resources": [{"metadata": {"guid": "failing-binding-guid"}, "entity": {"service_instance_guid": "instance-guid"}}]}`
+
+			responses["/v2/service_bindings?q=app_guid%3Aapp-autoscaler-guid"] = `{"resources": [{
+				"metadata": {"guid": "app-autoscaler-binding-guid"},
+				"entity": {"service_instance_guid": "app-autoscaler-instance-guid", "credentials": {"api_url": "` + server.URL + `/app-autoscaler"}}
+			}]}`
+			responses["/app-autoscaler/v1/apps/app-autoscaler-guid/policy"] = `{"instance_min_count": 2, "instance_max_count": 10, "scaling_rules": [
+				{"metric_type": "cpu", "threshold": 20, "operator": "<", "adjustment": "-1"},
+				{"metric_type": "cpu", "threshold": 80, "operator": ">=", "adjustment": "+1"}
+			]}`
+
+			binding := `{"min_instances": 2, "max_instances": 10, "cpu_min_threshold": 20, "cpu_max_threshold": 80, "enabled": true}`
+			responses["/api/bindings/match-binding-guid"] = binding
+			responses["/api/bindings/labelled-binding-guid"] = binding
+			responses["/api/bindings/unlisted-binding-guid"] = binding
+			responses["/api/bindings/drift-binding-guid"] = `{"min_instances": 2, "max_instances": 4, "cpu_min_threshold": 20, "cpu_max_threshold": 80, "enabled": true}`
+
+			policy := plugin.Policy{MinInstances: 2, MaxInstances: 10, CPUMinThreshold: 20, CPUMaxThreshold: 80}
+			checker = plugin.DriftChecker{
+				Dependencies: plugin.CLIDependencies{
+					APIEndpoint: server.URL,
+					JSONClient:  plugin.JSONClient{HTTPClient: http.DefaultClient, AccessToken: "some-token"},
+				},
+				Policies: map[string]plugin.Policy{
+					"app-match":          policy,
+					"app-drift":          policy,
+					"app-plain":          policy,
+					"app-failing":        policy,
+					"app-app-autoscaler": policy,
+				},
+				Label:       "autoscaling-policy",
+				Concurrency: 3,
+			}
+		})
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		It("reports how every app in the org compares with its policy", func() {
+			report, err := checker.Check("org-guid", "some-org")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(report.Org).To(Equal("some-org"))
+			Expect(report.Apps).To(Equal([]plugin.DriftResult{
+				{Space: "broken", Status: plugin.DriftStatusError, Error: "couldn't list service instances: unexpected response code: 500 Internal Server Error"},
+				{Space: "dev", App: "app-app-autoscaler", Policy: "app-app-autoscaler", Status: plugin.DriftStatusMatch},
+				{Space: "dev", App: "app-drift", Policy: "app-drift", Status: plugin.DriftStatusDrift, Changes: []plugin.FieldChange{
+					{Field: "max_instances", From: "4", To: "10"},
+				}},
+				{Space: "dev", App: "app-failing", Policy: "app-failing", Status: plugin.DriftStatusError, Error: "autoscaling API: unexpected response code: 500 Internal Server Error"},
+				{Space: "dev", App: "app-labelled", Policy: "app-match", Status: plugin.DriftStatusMatch},
+				{Space: "dev", App: "app-match", Policy: "app-match", Status: plugin.DriftStatusMatch},
+				{Space: "dev", App: "app-plain", Policy: "app-plain", Status: plugin.DriftStatusNoAutoscaling},
+				{Space: "dev", App: "app-unlisted", Status: plugin.DriftStatusMissingPolicy},
+			}))
+			Expect(report.Summary).To(Equal(map[plugin.DriftStatus]int{
+				plugin.DriftStatusMatch:         3,
+				plugin.DriftStatusDrift:         1,
+				plugin.DriftStatusMissingPolicy: 1,
+				plugin.DriftStatusNoAutoscaling: 1,
+				plugin.DriftStatusError:         2,
+			}))
+		})
+
+		Context("when the autoscaler service offerings can't be found", func() {
+			It("returns an error", func() {
+				responses["/v2/services?q=label%3Aapp-autoscaler"] = `{"resources": []}`
+				responses["/v2/services?q=label%3Aautoscaler"] = `{"resources": []}`
+
+				_, err := checker.Check("org-guid", "some-org")
+				Expect(err).To(MatchError("couldn't find the app-autoscaler or autoscaler service offerings in the marketplace"))
+			})
+		})
+
+		Context("when the spaces can't be listed", func() {
+			It("returns an error", func() {
+				delete(responses, "/v3/spaces?organization_guids=org-guid")
+
+				_, err := checker.Check("org-guid", "some-org")
+				Expect(err).To(MatchError("couldn't list the spaces of org some-org: unexpected response code: 500 Internal Server Error"))
+			})
+		})
+	})
+
+	Describe("DriftResult", func() {
+		It("fails apps that drifted or have a policy but no autoscaling", func() {
+			Expect(plugin.DriftResult{Policy: "app", Status: plugin.DriftStatusDrift}.Failed()).To(BeTrue())
+			Expect(plugin.DriftResult{Policy: "app", Status: plugin.DriftStatusNoAutoscaling}.Failed()).To(BeTrue())
+			Expect(plugin.DriftResult{Status: plugin.DriftStatusNoAutoscaling}.Failed()).To(BeFalse())
+			Expect(plugin.DriftResult{Status: plugin.DriftStatusMissingPolicy}.Failed()).To(BeFalse())
+			Expect(plugin.DriftResult{Policy: "app", Status: plugin.DriftStatusMatch}.Failed()).To(BeFalse())
+		})
+	})
+
+	Describe("RenderDriftReport", func() {
+		var report plugin.DriftReport
+
+		BeforeEach(func() {
+			report = plugin.DriftReport{
+				Org:     "some-org",
+				Summary: map[plugin.DriftStatus]int{plugin.DriftStatusMatch: 1, plugin.DriftStatusDrift: 1, plugin.DriftStatusMissingPolicy: 1},
+				Apps: []plugin.DriftResult{
+					{Space: "dev", App: "app-drift", Policy: "app-drift", Status: plugin.DriftStatusDrift, Changes: []plugin.FieldChange{
+						{Field: "max_instances", From: "4", To: "10"},
+					}},
+					{Space: "dev", App: "app-match", Policy: "app-match", Status: plugin.DriftStatusMatch},
+					{Space: "dev", App: "app-unlisted", Status: plugin.DriftStatusMissingPolicy},
+				},
+			}
+		})
+
+		It("renders json", func() {
+			out := &bytes.Buffer{}
+			Expect(plugin.RenderDriftReport(out, report, "json")).To(Succeed())
+			Expect(out.String()).To(MatchJSON(`{
+				"org": "some-org",
+				"summary": {"match": 1, "drift": 1, "missing-policy": 1},
+				"apps": [
+					{"space": "dev", "app": "app-drift", "policy": "app-drift", "status": "drift", "changes": [{"field": "max_instances", "from": "4", "to": "10"}]},
+					{"space": "dev", "app": "app-match", "policy": "app-match", "status": "match"},
+					{"space": "dev", "app": "app-unlisted", "status": "missing-policy"}
+				]
+			}`))
+		})
+
+		It("renders a JUnit test suite", func() {
+			out := &bytes.Buffer{}
+			Expect(plugin.RenderDriftReport(out, report, "junit")).To(Succeed())
+			Expect(out.String()).To(ContainSubstring(`<testsuite name="autoscaling drift in org some-org" tests="3" failures="1" errors="0" skipped="1">`))
+			Expect(out.String()).To(ContainSubstring(`<failure message="drifted from policy app-drift">max_instances: 4 -&gt; 10</failure>`))
+			Expect(out.String()).To(ContainSubstring(`<testcase classname="dev" name="app-match"></testcase>`))
+			Expect(out.String()).To(ContainSubstring(`<skipped message="no policy"></skipped>`))
+		})
+
+		Context("when the format is unknown", func() {
+			It("returns an error", func() {
+				err := plugin.RenderDriftReport(&bytes.Buffer{}, report, "csv")
+				Expect(err).To(MatchError("unknown format csv, use json or junit"))
+			})
+		})
+	})
+})
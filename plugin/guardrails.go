@@ -0,0 +1,256 @@
+package plugin
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+const guardrailsFileEnv = "AUTOSCALING_GUARDRAILS_FILE"
+
+// GuardrailSubject is a change that guardrails are evaluated against.
+type GuardrailSubject struct {
+	AppName   string
+	SpaceName string
+	Labels    map[string]string
+	Binding   AutoscalingBinding
+}
+
+// GuardrailViolation is a guardrail that a change breaks. Violations that
+// don't reject the change are only warned about.
+type GuardrailViolation struct {
+	Rule    string
+	Message string
+	Reject  bool
+}
+
+func (v GuardrailViolation) String() string {
+	return fmt.Sprintf("%s: %s", v.Rule, v.Message)
+}
+
+// GuardrailError is returned when a change breaks guardrails that reject it.
+type GuardrailError struct {
+	Violations []GuardrailViolation
+}
+
+func (e GuardrailError) Error() string {
+	message := []string{"this change breaks guardrails:"}
+	for _, violation := range e.Violations {
+		message = append(message, fmt.Sprintf("  - %s", violation))
+	}
+
+	return strings.Join(message, "\n")
+}
+
+// GuardrailRule limits a setting of the apps it applies to, e.g.
+//
+//	name: prod-min-instances
+//	space: (?i)prod
+//	field: min_instances
+//	min: 2
+//
+// A rule applies to every app unless it's narrowed down by space or app name
+// patterns, and doesn't apply to apps with all of its unless_labels.
+type GuardrailRule struct {
+	Name         string            `yaml:"name"`
+	Space        string            `yaml:"space,omitempty"`
+	App          string            `yaml:"app,omitempty"`
+	UnlessLabels map[string]string `yaml:"unless_labels,omitempty"`
+	Field        string            `yaml:"field"`
+	Min          *int              `yaml:"min,omitempty"`
+	Max          *int              `yaml:"max,omitempty"`
+	Action       string            `yaml:"action,omitempty"`
+	Message      string            `yaml:"message,omitempty"`
+
+	space *regexp.Regexp
+	app   *regexp.Regexp
+}
+
+// Guardrails evaluates a file of rules, e.g.
+//
+//	rules:
+//	- name: prod-min-instances
+//	  space: (?i)prod
+//	  field: min_instances
+//	  min: 2
+//	- name: max-instances
+//	  field: max_instances
+//	  max: 20
+//	  unless_labels: {scaling-exception: "true"}
+//	  action: warn
+type Guardrails struct {
+	Rules []GuardrailRule `yaml:"rules"`
+}
+
+func guardrailField(binding AutoscalingBinding, field string) (int, bool) {
+	switch field {
+	case "min_instances":
+		return binding.MinInstances, true
+	case "max_instances":
+		return binding.MaxInstances, true
+	case "cpu_min_threshold":
+		return binding.CPUMinThreshold, true
+	case "cpu_max_threshold":
+		return binding.CPUMaxThreshold, true
+	}
+
+	return 0, false
+}
+
+func (r *GuardrailRule) compile() error {
+	if r.Name == "" {
+		return fmt.Errorf("rule has no name")
+	}
+
+	if _, ok := guardrailField(AutoscalingBinding{}, r.Field); !ok {
+		return fmt.Errorf("rule %s has unknown field %q, use min_instances, max_instances, cpu_min_threshold or cpu_max_threshold", r.Name, r.Field)
+	}
+
+	if r.Min == nil && r.Max == nil {
+		return fmt.Errorf("rule %s needs a min or max", r.Name)
+	}
+
+	if r.Action != "" && r.Action != "reject" && r.Action != "warn" {
+		return fmt.Errorf("rule %s has unknown action %q, use reject or warn", r.Name, r.Action)
+	}
+
+	var err error
+	if r.Space != "" {
+		if r.space, err = regexp.Compile(r.Space); err != nil {
+			return fmt.Errorf("rule %s has an invalid space pattern: %s", r.Name, err)
+		}
+	}
+
+	if r.App != "" {
+		if r.app, err = regexp.Compile(r.App); err != nil {
+			return fmt.Errorf("rule %s has an invalid app pattern: %s", r.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func (r GuardrailRule) appliesTo(subject GuardrailSubject) bool {
+	if r.space != nil && !r.space.MatchString(subject.SpaceName) {
+		return false
+	}
+
+	if r.app != nil && !r.app.MatchString(subject.AppName) {
+		return false
+	}
+
+	if len(r.UnlessLabels) > 0 {
+		for key, value := range r.UnlessLabels {
+			if subject.Labels[key] != value {
+				return true
+			}
+		}
+		return false
+	}
+
+	return true
+}
+
+// LoadGuardrails loads the guardrails in path.
+func LoadGuardrails(path string) (Guardrails, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Guardrails{}, fmt.Errorf("couldn't read guardrails file: %s", err)
+	}
+
+	var guardrails Guardrails
+	if err := yaml.UnmarshalStrict(contents, &guardrails); err != nil {
+		return Guardrails{}, fmt.Errorf("couldn't parse guardrails file %s: %s", path, err)
+	}
+
+	for i := range guardrails.Rules {
+		if err := guardrails.Rules[i].compile(); err != nil {
+			return Guardrails{}, fmt.Errorf("invalid guardrails file %s: %s", path, err)
+		}
+	}
+
+	return guardrails, nil
+}
+
+// guardrailsFromEnv loads the guardrails in AUTOSCALING_GUARDRAILS_FILE, if
+// it's set.
+func guardrailsFromEnv() (guardrails, error) {
+	path := os.Getenv(guardrailsFileEnv)
+	if path == "" {
+		return nil, nil
+	}
+
+	return LoadGuardrails(path)
+}
+
+// Evaluate returns the rules that the subject breaks.
+func (g Guardrails) Evaluate(subject GuardrailSubject) []GuardrailViolation {
+	var violations []GuardrailViolation
+	for _, rule := range g.Rules {
+		if !rule.appliesTo(subject) {
+			continue
+		}
+
+		value, _ := guardrailField(subject.Binding, rule.Field)
+
+		var message string
+		switch {
+		case rule.Min != nil && value < *rule.Min:
+			message = fmt.Sprintf("%s is %d, it must be at least %d", rule.Field, value, *rule.Min)
+		case rule.Max != nil && value > *rule.Max:
+			message = fmt.Sprintf("%s is %d, it must be at most %d", rule.Field, value, *rule.Max)
+		default:
+			continue
+		}
+
+		if rule.Message != "" {
+			message = rule.Message
+		}
+
+		violations = append(violations, GuardrailViolation{Rule: rule.Name, Message: message, Reject: rule.Action != "warn"})
+	}
+
+	return violations
+}
+
+// fetchAppLabels returns the app's labels from cloud controller.
+func fetchAppLabels(dependencies CLIDependencies) (map[string]string, error) {
+	var app ccV3Resource
+	err := getCCResource(dependencies, fmt.Sprintf("/v3/apps/%s", dependencies.App.Guid), &app)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get the labels of %s: %s", dependencies.AppName, err)
+	}
+
+	return app.Metadata.Labels, nil
+}
+
+// checkGuardrails warns about the guardrails the change breaks, and fails if
+// any of them reject it.
+func checkGuardrails(dependencies CLIDependencies, labels map[string]string, binding AutoscalingBinding) error {
+	violations := dependencies.Guardrails.Evaluate(GuardrailSubject{
+		AppName:   dependencies.AppName,
+		SpaceName: dependencies.SpaceName,
+		Labels:    labels,
+		Binding:   binding,
+	})
+
+	var rejections []GuardrailViolation
+	for _, violation := range violations {
+		if violation.Reject {
+			rejections = append(rejections, violation)
+			continue
+		}
+
+		dependencies.UI.Say("Warning: guardrail %s", violation)
+	}
+
+	if len(rejections) > 0 {
+		return GuardrailError{Violations: rejections}
+	}
+
+	return nil
+}
@@ -0,0 +1,144 @@
+package plugin_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/phopper-pivotal/autoscaling-cli-plugin/plugin"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Guardrails", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "guardrails")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	writeGuardrails := func(contents string) string {
+		path := filepath.Join(dir, "guardrails.yml")
+		Expect(ioutil.WriteFile(path, []byte(contents), 0600)).To(Succeed())
+		return path
+	}
+
+	Describe("LoadGuardrails", func() {
+		It("loads the rules", func() {
+			path := writeGuardrails("rules:\n- name: prod-min-instances\n  space: (?i)prod\n  field: min_instances\n  min: 2\n")
+
+			guardrails, err := plugin.LoadGuardrails(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(guardrails.Rules).To(HaveLen(1))
+			Expect(guardrails.Rules[0].Name).To(Equal("prod-min-instances"))
+			Expect(*guardrails.Rules[0].Min).To(Equal(2))
+		})
+
+		Context("when the file can't be read", func() {
+			It("returns an error", func() {
+				_, err := plugin.LoadGuardrails(filepath.Join(dir, "missing.yml"))
+				Expect(err).To(MatchError(ContainSubstring("couldn't read guardrails file")))
+			})
+		})
+
+		Context("when the file contains unknown fields", func() {
+			It("returns an error", func() {
+				path := writeGuardrails("rules:\n- name: some-rule\n  feild: min_instances\n")
+
+				_, err := plugin.LoadGuardrails(path)
+				Expect(err).To(MatchError(ContainSubstring("couldn't parse guardrails file")))
+			})
+		})
+
+		Context("when a rule is invalid", func() {
+			for _, invalid := range []struct{ description, rule, message string }{
+				{"has no name", "field: min_instances\n  min: 2\n", "rule has no name"},
+				{"has an unknown field", "name: some-rule\n  field: instances\n  min: 2\n", `rule some-rule has unknown field "instances"`},
+				{"has no limit", "name: some-rule\n  field: min_instances\n", "rule some-rule needs a min or max"},
+				{"has an unknown action", "name: some-rule\n  field: min_instances\n  min: 2\n  action: ignore\n", `rule some-rule has unknown action "ignore"`},
+				{"has an invalid space pattern", "name: some-rule\n  space: (prod\n  field: min_instances\n  min: 2\n", "rule some-rule has an invalid space pattern"},
+				{"has an invalid app pattern", "name: some-rule\n  app: (app\n  field: min_instances\n  min: 2\n", "rule some-rule has an invalid app pattern"},
+			} {
+				invalid := invalid
+				It("returns an error when it "+invalid.description, func() {
+					path := writeGuardrails("rules:\n- " + invalid.rule)
+
+					_, err := plugin.LoadGuardrails(path)
+					Expect(err).To(MatchError(ContainSubstring(invalid.message)))
+				})
+			}
+		})
+	})
+
+	Describe("Evaluate", func() {
+		var guardrails plugin.Guardrails
+
+		BeforeEach(func() {
+			path := writeGuardrails(`rules:
+- name: prod-min-instances
+  space: (?i)prod
+  field: min_instances
+  min: 2
+  message: prod apps must have at least 2 instances
+- name: max-instances
+  field: max_instances
+  max: 20
+  unless_labels: {scaling-exception: "true"}
+  action: warn
+- name: web-cpu
+  app: ^web-
+  field: cpu_max_threshold
+  min: 50
+  max: 90
+`)
+
+			var err error
+			guardrails, err = plugin.LoadGuardrails(path)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("passes settings that follow every rule", func() {
+			Expect(guardrails.Evaluate(plugin.GuardrailSubject{
+				AppName:   "web-app",
+				SpaceName: "production",
+				Binding:   plugin.AutoscalingBinding{MinInstances: 2, MaxInstances: 20, CPUMaxThreshold: 80},
+			})).To(BeEmpty())
+		})
+
+		It("returns the rules that are broken", func() {
+			Expect(guardrails.Evaluate(plugin.GuardrailSubject{
+				AppName:   "web-app",
+				SpaceName: "Production",
+				Binding:   plugin.AutoscalingBinding{MinInstances: 1, MaxInstances: 30, CPUMaxThreshold: 95},
+			})).To(Equal([]plugin.GuardrailViolation{
+				{Rule: "prod-min-instances", Message: "prod apps must have at least 2 instances", Reject: true},
+				{Rule: "max-instances", Message: "max_instances is 30, it must be at most 20"},
+				{Rule: "web-cpu", Message: "cpu_max_threshold is 95, it must be at most 90", Reject: true},
+			}))
+		})
+
+		It("only applies rules to the spaces and apps they match", func() {
+			Expect(guardrails.Evaluate(plugin.GuardrailSubject{
+				AppName:   "worker",
+				SpaceName: "dev",
+				Binding:   plugin.AutoscalingBinding{MinInstances: 1, MaxInstances: 10, CPUMaxThreshold: 20},
+			})).To(BeEmpty())
+		})
+
+		It("doesn't apply rules to apps with their exception labels", func() {
+			Expect(guardrails.Evaluate(plugin.GuardrailSubject{
+				AppName:   "worker",
+				SpaceName: "dev",
+				Labels:    map[string]string{"scaling-exception": "true", "team": "some-team"},
+				Binding:   plugin.AutoscalingBinding{MinInstances: 1, MaxInstances: 30},
+			})).To(BeEmpty())
+		})
+	})
+})
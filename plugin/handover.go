@@ -0,0 +1,181 @@
+package plugin
+
+import (
+	"fmt"
+	"strings"
+)
+
+// handoverStep is one step of a handover, along with how to undo it.
+// Steps that are undone by undoing an earlier step have no undo.
+type handoverStep struct {
+	Description string
+	Do          func() error
+	Undo        func() error
+}
+
+// setBinding posts binding to the app's binding through the same checks as
+// configure-autoscaling, returning the settings it replaced.
+func setBinding(dependencies CLIDependencies, binding AutoscalingBinding) (AutoscalingBinding, error) {
+	bindingURL, err := lookupBindingURL(dependencies)
+	if err != nil {
+		return AutoscalingBinding{}, err
+	}
+
+	binding.AppGuid = dependencies.App.Guid
+
+	for attempt := 1; ; attempt++ {
+		current, err := getBinding(dependencies, bindingURL)
+		if err != nil {
+			return AutoscalingBinding{}, err
+		}
+
+		// the settings don't build on the current ones, so they can be posted again
+		err = postBinding(dependencies, current, binding, nil)
+		if _, ok := err.(ConflictError); ok && attempt < maxConflictAttempts {
+			continue
+		}
+		if err != nil {
+			return AutoscalingBinding{}, err
+		}
+
+		return current.Binding, nil
+	}
+}
+
+// restoreBinding puts previous back on the app's binding exactly as it was,
+// without checking it, to undo setBinding.
+func restoreBinding(dependencies CLIDependencies, previous AutoscalingBinding) error {
+	bindingURL, err := lookupBindingURL(dependencies)
+	if err != nil {
+		return err
+	}
+
+	current, err := getBinding(dependencies, bindingURL)
+	if err != nil {
+		return err
+	}
+
+	previous.AppGuid = dependencies.App.Guid
+
+	return putBinding(dependencies, current, previous)
+}
+
+// HandoverWithError moves autoscaling from the old app of a blue/green
+// deployment to the new one. The new app gets the old app's settings and is
+// scaled to the old app's running instance count before autoscaling is
+// enabled for it, so it takes over at the same capacity. Then the old app's
+// autoscaling is disabled so it can drain. If a step fails, the steps before
+// it are undone.
+func (p *Plugin) HandoverWithError(oldApp, newApp CLIDependencies) error {
+	ui := newApp.UI
+
+	current, err := p.fetchBinding(oldApp)
+	if err != nil {
+		return err
+	}
+
+	settings := current.Binding
+	settings.Enabled = false
+
+	instances := oldApp.App.RunningInstances
+	if instances == 0 {
+		instances = oldApp.App.InstanceCount
+	}
+	instances = instancesWithinLimits(settings, instances)
+
+	var newAppPrevious AutoscalingBinding
+
+	steps := []handoverStep{
+		{
+			Description: fmt.Sprintf("copying the settings of %s to %s", oldApp.AppName, newApp.AppName),
+			Do: func() error {
+				newAppPrevious, err = setBinding(newApp, settings)
+				return err
+			},
+			Undo: func() error {
+				return restoreBinding(newApp, newAppPrevious)
+			},
+		},
+		{
+			Description: fmt.Sprintf("scaling %s to %d instances", newApp.AppName, instances),
+			Do: func() error {
+				return scaleApp(newApp, instances)
+			},
+			Undo: func() error {
+				// the instance count isn't known when the app wasn't looked up through the cli
+				if newApp.App.InstanceCount == 0 {
+					return nil
+				}
+				return scaleApp(newApp, newApp.App.InstanceCount)
+			},
+		},
+		{
+			Description: fmt.Sprintf("enabling autoscaling for %s", newApp.AppName),
+			Do: func() error {
+				enabled := settings
+				enabled.Enabled = true
+				_, err := setBinding(newApp, enabled)
+				return err
+			},
+		},
+		{
+			Description: fmt.Sprintf("disabling autoscaling for %s", oldApp.AppName),
+			Do: func() error {
+				_, err := setBinding(oldApp, settings)
+				return err
+			},
+		},
+	}
+
+	ui.Say("Handing over autoscaling from %s to %s", oldApp.AppName, newApp.AppName)
+
+	for i, step := range steps {
+		err := step.Do()
+		if err == nil {
+			ui.Say("  %d. %s: OK", i+1, step.Description)
+			continue
+		}
+
+		ui.Say("  %d. %s: FAILED", i+1, step.Description)
+
+		var rollbackErrors []string
+		for j := i - 1; j >= 0; j-- {
+			if steps[j].Undo == nil {
+				continue
+			}
+
+			if undoErr := steps[j].Undo(); undoErr != nil {
+				ui.Say("  undoing %d. %s: FAILED", j+1, steps[j].Description)
+				rollbackErrors = append(rollbackErrors, fmt.Sprintf("undoing %s: %s", steps[j].Description, undoErr))
+			} else {
+				ui.Say("  undoing %d. %s: OK", j+1, steps[j].Description)
+			}
+		}
+
+		if len(rollbackErrors) > 0 {
+			return fmt.Errorf("handover failed %s: %s\nrolling back also failed:\n  %s", step.Description, err, strings.Join(rollbackErrors, "\n  "))
+		}
+
+		return fmt.Errorf("handover failed %s, and was rolled back: %s", step.Description, err)
+	}
+
+	return nil
+}
+
+func (p *Plugin) runHandover(cliConnection cliConnection, args []string) error {
+	if len(args) != 3 {
+		return fmt.Errorf("provide OLD_APP, NEW_APP and SERVICE_INSTANCE on command line")
+	}
+
+	oldApp, err := p.FetchCLIDependencies(cliConnection, []string{args[0], args[2]})
+	if err != nil {
+		return err
+	}
+
+	newApp, err := p.FetchCLIDependencies(cliConnection, []string{args[1], args[2]})
+	if err != nil {
+		return err
+	}
+
+	return p.HandoverWithError(oldApp, newApp)
+}
@@ -0,0 +1,195 @@
+package plugin_test
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+
+	"code.cloudfoundry.org/cli/plugin/models"
+	"github.com/phopper-pivotal/autoscaling-cli-plugin/mocks"
+	"github.com/phopper-pivotal/autoscaling-cli-plugin/plugin"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("HandoverWithError", func() {
+	var (
+		p          *plugin.Plugin
+		jsonClient *mocks.JSONClient
+		oldApp     plugin.CLIDependencies
+		newApp     plugin.CLIDependencies
+		out        *bytes.Buffer
+	)
+
+	const (
+		oldBindings = `{"Resources": [{"Metadata": {"GUID": "old-binding-guid"}}]}`
+		newBindings = `{"Resources": [{"Metadata": {"GUID": "new-binding-guid"}}]}`
+		oldBinding  = `{"min_instances": 4, "max_instances": 20, "cpu_min_threshold": 30, "cpu_max_threshold": 70, "enabled": true}`
+		newBinding  = `{"min_instances": 2, "max_instances": 5, "cpu_min_threshold": 20, "cpu_max_threshold": 80, "enabled": false}`
+	)
+
+	versioned := func(call *mocks.DoCall, responseJSON string) {
+		call.ResponseJSON = responseJSON
+		call.Returns.Headers = http.Header{"Etag": []string{`"some-version"`}}
+	}
+
+	BeforeEach(func() {
+		p = plugin.NewPlugin()
+		jsonClient = mocks.NewJSONClient(16)
+		jsonClient.DoCalls[0].ResponseJSON = oldBindings
+		jsonClient.DoCalls[1].ResponseJSON = oldBinding
+		jsonClient.DoCalls[2].ResponseJSON = newBindings
+		versioned(jsonClient.DoCalls[3], newBinding)
+		jsonClient.DoCalls[6].ResponseJSON = newBindings
+		versioned(jsonClient.DoCalls[7], oldBinding)
+		jsonClient.DoCalls[9].ResponseJSON = oldBindings
+		versioned(jsonClient.DoCalls[10], oldBinding)
+
+		out = &bytes.Buffer{}
+		oldApp = plugin.CLIDependencies{
+			AppName:     "app-blue",
+			ServiceName: "service-name",
+			Service: plugin_models.GetService_Model{
+				Guid:         "some-service-guid",
+				DashboardUrl: "http://autoscaling.example.com/dashboard",
+			},
+			APIEndpoint: "https://cloudcontroller.example.com",
+			App:         plugin_models.GetAppModel{Guid: "blue-app-guid", InstanceCount: 9, RunningInstances: 8},
+			JSONClient:  jsonClient,
+		}
+		newApp = oldApp
+		newApp.AppName = "app-green"
+		newApp.App = plugin_models.GetAppModel{Guid: "green-app-guid", InstanceCount: 2, RunningInstances: 2}
+		newApp.UI = plugin.UI{Out: out}
+	})
+
+	It("copies the settings, pre-scales the new app, and moves autoscaling over", func() {
+		Expect(p.HandoverWithError(oldApp, newApp)).To(Succeed())
+
+		Expect(jsonClient.DoCalls[4].Receives.Method).To(Equal("POST"))
+		Expect(jsonClient.DoCalls[4].Receives.URL).To(Equal("http://autoscaling.example.com/api/bindings/new-binding-guid"))
+		Expect(jsonClient.DoCalls[4].Receives.RequestData).To(Equal(&plugin.AutoscalingBinding{
+			AppGuid:         "green-app-guid",
+			MinInstances:    4,
+			MaxInstances:    20,
+			CPUMinThreshold: 30,
+			CPUMaxThreshold: 70,
+			Enabled:         false,
+		}))
+
+		Expect(jsonClient.DoCalls[5].Receives.Method).To(Equal("PUT"))
+		Expect(jsonClient.DoCalls[5].Receives.URL).To(Equal("https://cloudcontroller.example.com/v2/apps/green-app-guid"))
+		Expect(jsonClient.DoCalls[5].Receives.RequestData).To(Equal(map[string]int{"instances": 8}))
+
+		Expect(jsonClient.DoCalls[8].Receives.URL).To(Equal("http://autoscaling.example.com/api/bindings/new-binding-guid"))
+		Expect(jsonClient.DoCalls[8].Receives.RequestData.(*plugin.AutoscalingBinding).Enabled).To(BeTrue())
+
+		Expect(jsonClient.DoCalls[11].Receives.URL).To(Equal("http://autoscaling.example.com/api/bindings/old-binding-guid"))
+		Expect(jsonClient.DoCalls[11].Receives.RequestData).To(Equal(&plugin.AutoscalingBinding{
+			AppGuid:         "blue-app-guid",
+			MinInstances:    4,
+			MaxInstances:    20,
+			CPUMinThreshold: 30,
+			CPUMaxThreshold: 70,
+			Enabled:         false,
+		}))
+		Expect(jsonClient.DoCallCount).To(Equal(12))
+
+		Expect(out.String()).To(Equal(`Handing over autoscaling from app-blue to app-green
+  1. copying the settings of app-blue to app-green: OK
+  2. scaling app-green to 8 instances: OK
+  3. enabling autoscaling for app-green: OK
+  4. disabling autoscaling for app-blue: OK
+`))
+	})
+
+	It("keeps the new app within the old app's limits", func() {
+		oldApp.App.RunningInstances = 30
+
+		Expect(p.HandoverWithError(oldApp, newApp)).To(Succeed())
+		Expect(jsonClient.DoCalls[5].Receives.RequestData).To(Equal(map[string]int{"instances": 20}))
+	})
+
+	Context("when the settings don't fit the new app's space quota", func() {
+		It("doesn't post them", func() {
+			newApp.App.SpaceGuid = "green-space-guid"
+			jsonClient.DoCalls[4].ResponseJSON = `{"entity": {"name": "green-space", "organization_guid": "some-org-guid", "space_quota_definition_guid": "some-space-quota-guid"}}`
+			jsonClient.DoCalls[5].ResponseJSON = `{"entity": {"name": "small", "app_instance_limit": 10}}`
+			jsonClient.DoCalls[6].ResponseJSON = `{"entity": {"name": "some-org", "quota_definition_guid": "some-quota-guid"}}`
+			jsonClient.DoCalls[7].ResponseJSON = `{"entity": {"name": "default", "app_instance_limit": 100}}`
+
+			err := p.HandoverWithError(oldApp, newApp)
+			Expect(err).To(MatchError("handover failed copying the settings of app-blue to app-green, and was rolled back: max instances (20) exceeds the app instance limit of 10 in space quota small of space green-space"))
+			Expect(jsonClient.DoCalls[4].Receives.URL).To(Equal("https://cloudcontroller.example.com/v2/spaces/green-space-guid"))
+			Expect(jsonClient.DoCallCount).To(Equal(8))
+		})
+	})
+
+	Context("when a guardrail rejects the new app's settings", func() {
+		It("doesn't post them", func() {
+			guardrails := &mocks.Guardrails{}
+			guardrails.EvaluateCall.Returns.Violations = []plugin.GuardrailViolation{
+				{Rule: "green-max-instances", Message: "max_instances is 20, it must be at most 10", Reject: true},
+			}
+			newApp.Guardrails = guardrails
+			jsonClient.DoCalls[4].ResponseJSON = `{"guid": "green-app-guid", "metadata": {"labels": {}}}`
+
+			err := p.HandoverWithError(oldApp, newApp)
+			Expect(err).To(MatchError("handover failed copying the settings of app-blue to app-green, and was rolled back: this change breaks guardrails:\n  - green-max-instances: max_instances is 20, it must be at most 10"))
+			Expect(jsonClient.DoCalls[4].Receives.URL).To(Equal("https://cloudcontroller.example.com/v3/apps/green-app-guid"))
+			Expect(guardrails.EvaluateCall.Receives.Subject.AppName).To(Equal("app-green"))
+			Expect(jsonClient.DoCallCount).To(Equal(5))
+		})
+	})
+
+	Context("when a step fails", func() {
+		BeforeEach(func() {
+			jsonClient.DoCalls[11].Returns.Error = errors.New("some error")
+			jsonClient.DoCalls[13].ResponseJSON = newBindings
+			versioned(jsonClient.DoCalls[14], oldBinding)
+		})
+
+		It("undoes the steps before it", func() {
+			err := p.HandoverWithError(oldApp, newApp)
+			Expect(err).To(MatchError("handover failed disabling autoscaling for app-blue, and was rolled back: autoscaling API: some error"))
+
+			Expect(jsonClient.DoCalls[12].Receives.Method).To(Equal("PUT"))
+			Expect(jsonClient.DoCalls[12].Receives.RequestData).To(Equal(map[string]int{"instances": 2}))
+
+			Expect(jsonClient.DoCalls[15].Receives.Method).To(Equal("POST"))
+			Expect(jsonClient.DoCalls[15].Receives.URL).To(Equal("http://autoscaling.example.com/api/bindings/new-binding-guid"))
+			Expect(jsonClient.DoCalls[15].Receives.RequestData).To(Equal(&plugin.AutoscalingBinding{
+				AppGuid:         "green-app-guid",
+				MinInstances:    2,
+				MaxInstances:    5,
+				CPUMinThreshold: 20,
+				CPUMaxThreshold: 80,
+				Enabled:         false,
+			}))
+
+			Expect(out.String()).To(HaveSuffix(`  4. disabling autoscaling for app-blue: FAILED
+  undoing 2. scaling app-green to 8 instances: OK
+  undoing 1. copying the settings of app-blue to app-green: OK
+`))
+		})
+
+		It("restores the new app's previous settings even when they were never configured", func() {
+			versioned(jsonClient.DoCalls[3], `{"enabled": false}`)
+
+			err := p.HandoverWithError(oldApp, newApp)
+			Expect(err).To(MatchError("handover failed disabling autoscaling for app-blue, and was rolled back: autoscaling API: some error"))
+			Expect(jsonClient.DoCalls[15].Receives.Method).To(Equal("POST"))
+			Expect(jsonClient.DoCalls[15].Receives.RequestData).To(Equal(&plugin.AutoscalingBinding{AppGuid: "green-app-guid"}))
+		})
+
+		It("reports undo steps that fail too", func() {
+			jsonClient.DoCalls[12].Returns.Error = errors.New("some other error")
+
+			err := p.HandoverWithError(oldApp, newApp)
+			Expect(err).To(MatchError(`handover failed disabling autoscaling for app-blue: autoscaling API: some error
+rolling back also failed:
+  undoing scaling app-green to 8 instances: app-green couldn't be scaled to 2 instances: some other error`))
+		})
+	})
+})
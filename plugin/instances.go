@@ -0,0 +1,72 @@
+package plugin
+
+import "fmt"
+
+// instancesWithinLimits returns the instance count the autoscaler brings an
+// app running instances to under binding.
+func instancesWithinLimits(binding AutoscalingBinding, instances int) int {
+	if instances < binding.MinInstances {
+		return binding.MinInstances
+	}
+
+	if instances > binding.MaxInstances {
+		return binding.MaxInstances
+	}
+
+	return instances
+}
+
+func scaleDirection(from, to int) string {
+	if to < from {
+		return "down"
+	}
+
+	return "up"
+}
+
+// scaleIntoLimits tells the user how the app will be scaled when its instance
+// count is outside the limits of binding or, with scaleNow, scales it through
+// cloud controller straight away.
+func scaleIntoLimits(dependencies CLIDependencies, binding AutoscalingBinding, scaleNow bool) error {
+	appName := dependencies.AppName
+	current := dependencies.App.InstanceCount
+	target := instancesWithinLimits(binding, current)
+
+	// the instance count isn't known when the app wasn't looked up through the cli
+	if current == 0 || target == current {
+		return nil
+	}
+
+	if !scaleNow {
+		if !binding.Enabled {
+			dependencies.UI.Say("%s has %d instances, outside the new limits, but won't be scaled as autoscaling is disabled", appName, current)
+			return nil
+		}
+
+		dependencies.UI.Say("%s will be scaled from %d %s to %d instances", appName, current, scaleDirection(current, target), target)
+		return nil
+	}
+
+	err := scaleApp(dependencies, target)
+	if err != nil {
+		return fmt.Errorf("the settings were applied but %s", err)
+	}
+
+	dependencies.UI.Say("%s scaled from %d %s to %d instances", appName, current, scaleDirection(current, target), target)
+	return nil
+}
+
+// scaleApp sets the app's instance count through cloud controller.
+func scaleApp(dependencies CLIDependencies, instances int) error {
+	appURL, err := getCCURL(dependencies.APIEndpoint, fmt.Sprintf("/v2/apps/%s", dependencies.App.Guid), nil)
+	if err != nil {
+		return err
+	}
+
+	err = dependencies.JSONClient.Do("PUT", appURL, map[string]int{"instances": instances}, nil)
+	if err != nil {
+		return fmt.Errorf("%s couldn't be scaled to %d instances: %s", dependencies.AppName, instances, err)
+	}
+
+	return nil
+}
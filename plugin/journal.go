@@ -0,0 +1,262 @@
+package plugin
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// JournalEntry records a change made to a binding. The binding is identified
+// by the app and service instance GUIDs, as apps and service instances in
+// different spaces can share names.
+type JournalEntry struct {
+	Timestamp   time.Time          `json:"timestamp"`
+	Foundation  string             `json:"foundation"`
+	SpaceName   string             `json:"space_name,omitempty"`
+	AppName     string             `json:"app_name"`
+	AppGUID     string             `json:"app_guid"`
+	ServiceName string             `json:"service_name"`
+	ServiceGUID string             `json:"service_guid,omitempty"`
+	Before      AutoscalingBinding `json:"before"`
+	After       AutoscalingBinding `json:"after"`
+}
+
+// Journal keeps the history of binding changes in a file with one JSON entry
+// per line.
+type Journal struct {
+	Path string
+}
+
+// cfConfigDir returns the directory the cf cli keeps its configuration in.
+func cfConfigDir() string {
+	home := os.Getenv("CF_HOME")
+	if home == "" {
+		home = os.Getenv("HOME")
+	}
+	if home == "" {
+		home = os.Getenv("USERPROFILE")
+	}
+
+	return filepath.Join(home, ".cf")
+}
+
+func pluginConfigDir() string {
+	return filepath.Join(cfConfigDir(), "plugins", "autoscaling")
+}
+
+func DefaultJournalPath() string {
+	return filepath.Join(pluginConfigDir(), "history.jsonl")
+}
+
+func (j Journal) Record(entry JournalEntry) error {
+	if entry.Timestamp.IsZero() {
+		entry.Timestamp = time.Now().UTC()
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err // not tested
+	}
+
+	if err := os.MkdirAll(filepath.Dir(j.Path), 0700); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(j.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// Entries returns every entry in the journal, oldest first.
+func (j Journal) Entries() ([]JournalEntry, error) {
+	file, err := os.Open(j.Path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []JournalEntry
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+
+		var entry JournalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("%s line %d is corrupt: %s", j.Path, line, err)
+		}
+
+		entries = append(entries, entry)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// filterJournalEntries returns the entries for foundation and, if given, the
+// binding of the app to the service instance with those GUIDs.
+func filterJournalEntries(entries []JournalEntry, foundation, appGUID, serviceGUID string) []JournalEntry {
+	var filtered []JournalEntry
+	for _, entry := range entries {
+		if entry.Foundation != foundation {
+			continue
+		}
+
+		if appGUID != "" && (entry.AppGUID != appGUID || entry.ServiceGUID != serviceGUID) {
+			continue
+		}
+
+		filtered = append(filtered, entry)
+	}
+
+	return filtered
+}
+
+// UndoWithError restores the binding to the settings it had before the last
+// recorded change or, if to is given, after the to'th recorded change. The
+// settings go through the same validation and checks as any other change,
+// including confirmation of risky changes unless force is set.
+func (p *Plugin) UndoWithError(dependencies CLIDependencies, to int, force bool) error {
+	if dependencies.Journal == nil {
+		return fmt.Errorf("no autoscaling history is kept")
+	}
+
+	entries, err := dependencies.Journal.Entries()
+	if err != nil {
+		return fmt.Errorf("couldn't read autoscaling history: %s", err)
+	}
+
+	entries = filterJournalEntries(entries, dependencies.APIEndpoint, dependencies.App.Guid, dependencies.Service.Guid)
+	if len(entries) == 0 {
+		return fmt.Errorf("no autoscaling history for %s to %s", dependencies.AppName, dependencies.ServiceName)
+	}
+
+	target := entries[len(entries)-1].Before
+	if to != 0 {
+		if to < 1 || to > len(entries) {
+			return fmt.Errorf("there is no change %d in the autoscaling history for %s to %s", to, dependencies.AppName, dependencies.ServiceName)
+		}
+
+		target = entries[to-1].After
+	}
+
+	flags := flagsFor(target)
+	flags.Force = force
+
+	return p.RunWithError(dependencies, flags)
+}
+
+func (p *Plugin) runUndo(cliConnection cliConnection, args []string) error {
+	var (
+		to    int
+		force bool
+	)
+	flagSet := flag.NewFlagSet("undo-autoscaling", flag.ContinueOnError)
+	flagSet.IntVar(&to, "to", 0, "(optional) restore the settings as they were after this change in the history")
+	flagSet.BoolVar(&force, "f", false, "(optional) apply risky changes without asking for confirmation")
+	flagSet.BoolVar(&force, "force", false, "(optional) apply risky changes without asking for confirmation")
+	err := flagSet.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	dependencies, err := p.FetchCLIDependencies(cliConnection, flagSet.Args())
+	if err != nil {
+		return err
+	}
+
+	return p.UndoWithError(dependencies, to, force)
+}
+
+// RenderHistory lists the entries as a table. Each binding's changes are
+// numbered on their own, so the numbers are the ones undo-autoscaling --to
+// takes even when several apps are listed, including same-named apps in
+// different spaces.
+func RenderHistory(out io.Writer, entries []JournalEntry) {
+	numbers := map[[2]string]int{}
+
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "#\tTIME\tSPACE\tAPP\tSERVICE\tCHANGES\n")
+	for _, entry := range entries {
+		binding := [2]string{entry.AppGUID, entry.ServiceGUID}
+		numbers[binding]++
+
+		var changes []string
+		for _, change := range DiffBindings(entry.Before, entry.After) {
+			changes = append(changes, change.String())
+		}
+		if len(changes) == 0 {
+			changes = []string{"none"}
+		}
+
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\n",
+			numbers[binding], entry.Timestamp.Format(time.RFC3339), entry.SpaceName, entry.AppName, entry.ServiceName, strings.Join(changes, ", "))
+	}
+	w.Flush()
+}
+
+func (p *Plugin) runHistory(cliConnection cliConnection, args []string) error {
+	if len(args) != 0 && len(args) != 2 {
+		return fmt.Errorf("provide both APP_NAME and SERVICE_NAME, or neither, on command line")
+	}
+
+	apiEndpoint, err := cliConnection.ApiEndpoint()
+	if err != nil {
+		return fmt.Errorf("couldn't get API end-point: %s", err)
+	}
+
+	entries, err := Journal{Path: DefaultJournalPath()}.Entries()
+	if err != nil {
+		return fmt.Errorf("couldn't read autoscaling history: %s", err)
+	}
+
+	// the names are looked up in the targeted space, as apps and service
+	// instances in other spaces can share them
+	var appGUID, serviceGUID string
+	if len(args) == 2 {
+		app, err := cliConnection.GetApp(args[0])
+		if err != nil {
+			return fmt.Errorf("couldn't get app %s: %s", args[0], err)
+		}
+
+		service, err := cliConnection.GetService(args[1])
+		if err != nil {
+			return fmt.Errorf("couldn't get service named %s: %s", args[1], err)
+		}
+
+		appGUID, serviceGUID = app.Guid, service.Guid
+	}
+
+	ui := NewUI()
+
+	entries = filterJournalEntries(entries, apiEndpoint, appGUID, serviceGUID)
+	if len(entries) == 0 {
+		ui.Say("No autoscaling changes recorded.")
+		return nil
+	}
+
+	RenderHistory(ui.Out, entries)
+	return nil
+}
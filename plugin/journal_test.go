@@ -0,0 +1,286 @@
+package plugin_test
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"code.cloudfoundry.org/cli/plugin/models"
+	"github.com/phopper-pivotal/autoscaling-cli-plugin/mocks"
+	"github.com/phopper-pivotal/autoscaling-cli-plugin/plugin"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Journal", func() {
+	Describe("Record and Entries", func() {
+		var (
+			dir     string
+			journal plugin.Journal
+		)
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "journal")
+			Expect(err).NotTo(HaveOccurred())
+
+			journal = plugin.Journal{Path: filepath.Join(dir, "some", "dir", "history.jsonl")}
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		It("appends entries and reads them back oldest first", func() {
+			first := plugin.JournalEntry{
+				Timestamp:  time.Date(2016, 6, 8, 16, 0, 0, 0, time.UTC),
+				Foundation: "https://api.example.com",
+				AppName:    "app-name",
+				Before:     plugin.AutoscalingBinding{MaxInstances: 5},
+				After:      plugin.AutoscalingBinding{MaxInstances: 8},
+			}
+			second := first
+			second.Timestamp = first.Timestamp.Add(time.Hour)
+
+			Expect(journal.Record(first)).To(Succeed())
+			Expect(journal.Record(second)).To(Succeed())
+
+			entries, err := journal.Entries()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(entries).To(Equal([]plugin.JournalEntry{first, second}))
+		})
+
+		It("timestamps entries that don't have one", func() {
+			Expect(journal.Record(plugin.JournalEntry{AppName: "app-name"})).To(Succeed())
+
+			entries, err := journal.Entries()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(entries[0].Timestamp).To(BeTemporally("~", time.Now(), time.Minute))
+		})
+
+		It("has no entries before anything was recorded", func() {
+			entries, err := journal.Entries()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(entries).To(BeEmpty())
+		})
+
+		It("reports corrupt entries", func() {
+			Expect(os.MkdirAll(filepath.Dir(journal.Path), 0700)).To(Succeed())
+			Expect(ioutil.WriteFile(journal.Path, []byte("{{{\n"), 0600)).To(Succeed())
+
+			_, err := journal.Entries()
+			Expect(err).To(MatchError(ContainSubstring("line 1 is corrupt")))
+		})
+	})
+
+	Describe("UndoWithError", func() {
+		var (
+			p            *plugin.Plugin
+			jsonClient   *mocks.JSONClient
+			journal      *mocks.Journal
+			dependencies plugin.CLIDependencies
+		)
+
+		BeforeEach(func() {
+			p = plugin.NewPlugin()
+			jsonClient = mocks.NewJSONClient(4)
+			jsonClient.DoCalls[0].ResponseJSON = `{"Resources": [{"Metadata": {"GUID": "some-service-binding-guid"}}]}`
+			jsonClient.DoCalls[1].ResponseJSON = `{"min_instances": 2, "max_instances": 3, "cpu_min_threshold": 20, "cpu_max_threshold": 80, "enabled": true}`
+			jsonClient.DoCalls[2].ResponseJSON = jsonClient.DoCalls[1].ResponseJSON
+
+			journal = &mocks.Journal{}
+			journal.EntriesCall.Returns.Entries = []plugin.JournalEntry{
+				{
+					Foundation:  "https://cloudcontroller.example.com",
+					AppName:     "app-name",
+					AppGUID:     "some-app-guid",
+					ServiceName: "service-name",
+					ServiceGUID: "some-service-instance-guid",
+					Before:      plugin.AutoscalingBinding{MinInstances: 2, MaxInstances: 5, CPUMinThreshold: 20, CPUMaxThreshold: 80, Enabled: false},
+					After:       plugin.AutoscalingBinding{MinInstances: 2, MaxInstances: 50, CPUMinThreshold: 20, CPUMaxThreshold: 80, Enabled: true},
+				},
+				{
+					Foundation:  "https://cloudcontroller.example.com",
+					AppName:     "other-app",
+					AppGUID:     "other-app-guid",
+					ServiceName: "service-name",
+					ServiceGUID: "some-service-instance-guid",
+				},
+				{
+					Foundation:  "https://other-foundation.example.com",
+					AppName:     "app-name",
+					AppGUID:     "some-app-guid",
+					ServiceName: "service-name",
+					ServiceGUID: "some-service-instance-guid",
+				},
+				{
+					Foundation:  "https://cloudcontroller.example.com",
+					AppName:     "app-name",
+					AppGUID:     "some-app-guid",
+					ServiceName: "service-name",
+					ServiceGUID: "some-service-instance-guid",
+					Before:      plugin.AutoscalingBinding{MinInstances: 2, MaxInstances: 50, CPUMinThreshold: 20, CPUMaxThreshold: 80, Enabled: true},
+					After:       plugin.AutoscalingBinding{MinInstances: 2, MaxInstances: 3, CPUMinThreshold: 20, CPUMaxThreshold: 80, Enabled: true},
+				},
+			}
+
+			dependencies = plugin.CLIDependencies{
+				AppName:     "app-name",
+				ServiceName: "service-name",
+				Service: plugin_models.GetService_Model{
+					Guid:         "some-service-instance-guid",
+					DashboardUrl: "http://autoscaling.example.com/something-that-doesnot-matter",
+				},
+				APIEndpoint: "https://cloudcontroller.example.com",
+				App: plugin_models.GetAppModel{
+					Guid: "some-app-guid",
+				},
+				JSONClient: jsonClient,
+				Journal:    journal,
+			}
+		})
+
+		It("restores the settings from before the last change", func() {
+			Expect(p.UndoWithError(dependencies, 0, false)).To(Succeed())
+			Expect(jsonClient.DoCalls[3].Receives.Method).To(Equal("POST"))
+			Expect(jsonClient.DoCalls[3].Receives.RequestData).To(Equal(&plugin.AutoscalingBinding{
+				AppGuid:         "some-app-guid",
+				MinInstances:    2,
+				MaxInstances:    50,
+				CPUMinThreshold: 20,
+				CPUMaxThreshold: 80,
+				Enabled:         true,
+			}))
+		})
+
+		It("records the undo in the journal", func() {
+			Expect(p.UndoWithError(dependencies, 0, false)).To(Succeed())
+			Expect(journal.RecordCall.Receives.Entries).To(HaveLen(1))
+			Expect(journal.RecordCall.Receives.Entries[0].Before.MaxInstances).To(Equal(3))
+			Expect(journal.RecordCall.Receives.Entries[0].After.MaxInstances).To(Equal(50))
+		})
+
+		It("restores the settings from after an earlier change", func() {
+			Expect(p.UndoWithError(dependencies, 1, false)).To(Succeed())
+			Expect(jsonClient.DoCalls[3].Receives.RequestData).To(Equal(&plugin.AutoscalingBinding{
+				AppGuid:         "some-app-guid",
+				MinInstances:    2,
+				MaxInstances:    50,
+				CPUMinThreshold: 20,
+				CPUMaxThreshold: 80,
+				Enabled:         true,
+			}))
+		})
+
+		It("restores disabled bindings as disabled when forced", func() {
+			journal.EntriesCall.Returns.Entries = journal.EntriesCall.Returns.Entries[:1]
+
+			Expect(p.UndoWithError(dependencies, 0, true)).To(Succeed())
+			Expect(jsonClient.DoCalls[3].Receives.RequestData).To(Equal(&plugin.AutoscalingBinding{
+				AppGuid:         "some-app-guid",
+				MinInstances:    2,
+				MaxInstances:    5,
+				CPUMinThreshold: 20,
+				CPUMaxThreshold: 80,
+				Enabled:         false,
+			}))
+		})
+
+		It("ignores the history of a same-named app in another space", func() {
+			prod := plugin.JournalEntry{
+				Foundation:  "https://cloudcontroller.example.com",
+				SpaceName:   "prod",
+				AppName:     "app-name",
+				AppGUID:     "prod-app-guid",
+				ServiceName: "service-name",
+				ServiceGUID: "prod-service-instance-guid",
+				Before:      plugin.AutoscalingBinding{MinInstances: 10, MaxInstances: 100, CPUMinThreshold: 20, CPUMaxThreshold: 80, Enabled: true},
+				After:       plugin.AutoscalingBinding{MinInstances: 10, MaxInstances: 90, CPUMinThreshold: 20, CPUMaxThreshold: 80, Enabled: true},
+			}
+			journal.EntriesCall.Returns.Entries = append(journal.EntriesCall.Returns.Entries, prod, prod)
+
+			Expect(p.UndoWithError(dependencies, 0, false)).To(Succeed())
+			Expect(jsonClient.DoCalls[3].Receives.RequestData.(*plugin.AutoscalingBinding).MaxInstances).To(Equal(50))
+
+			Expect(p.UndoWithError(dependencies, 3, false)).To(MatchError("there is no change 3 in the autoscaling history for app-name to service-name"))
+		})
+
+		Context("failure cases", func() {
+			It("asks for confirmation of risky changes", func() {
+				journal.EntriesCall.Returns.Entries = journal.EntriesCall.Returns.Entries[:1]
+
+				err := p.UndoWithError(dependencies, 0, false)
+				Expect(err).To(MatchError("this change is risky:\n  - autoscaling will be disabled\nre-run with -f to apply it anyway"))
+				Expect(jsonClient.DoCalls[3].Receives.Method).To(BeEmpty())
+			})
+
+			It("fails when there is no such change", func() {
+				Expect(p.UndoWithError(dependencies, 3, false)).To(MatchError("there is no change 3 in the autoscaling history for app-name to service-name"))
+			})
+
+			It("fails when there is no history for the binding", func() {
+				dependencies.AppName = "unknown-app"
+				dependencies.App.Guid = "unknown-app-guid"
+
+				Expect(p.UndoWithError(dependencies, 0, false)).To(MatchError("no autoscaling history for unknown-app to service-name"))
+			})
+
+			It("fails when the history can't be read", func() {
+				journal.EntriesCall.Returns.Error = errors.New("some error")
+
+				Expect(p.UndoWithError(dependencies, 0, false)).To(MatchError("couldn't read autoscaling history: some error"))
+			})
+		})
+	})
+
+	Describe("RenderHistory", func() {
+		It("numbers the changes and lists what changed", func() {
+			buffer := &bytes.Buffer{}
+			plugin.RenderHistory(buffer, []plugin.JournalEntry{
+				{
+					Timestamp:   time.Date(2016, 6, 8, 16, 0, 0, 0, time.UTC),
+					SpaceName:   "dev",
+					AppName:     "app-name",
+					ServiceName: "service-name",
+					Before:      plugin.AutoscalingBinding{MaxInstances: 5, CPUMaxThreshold: 80},
+					After:       plugin.AutoscalingBinding{MaxInstances: 8, CPUMaxThreshold: 70},
+				},
+				{
+					Timestamp:   time.Date(2016, 6, 8, 17, 0, 0, 0, time.UTC),
+					SpaceName:   "dev",
+					AppName:     "app-name",
+					ServiceName: "service-name",
+				},
+			})
+			Expect(buffer.String()).To(Equal(`#  TIME                  SPACE  APP       SERVICE       CHANGES
+1  2016-06-08T16:00:00Z  dev    app-name  service-name  max_instances: 5 -> 8, cpu_max_threshold: 80 -> 70
+2  2016-06-08T17:00:00Z  dev    app-name  service-name  none
+`))
+		})
+
+		It("numbers each binding's changes on their own, like undo-autoscaling --to", func() {
+			staging := plugin.JournalEntry{SpaceName: "staging", AppName: "app-name", AppGUID: "staging-app-guid", ServiceName: "service-name", ServiceGUID: "staging-service-guid"}
+			prod := plugin.JournalEntry{SpaceName: "prod", AppName: "app-name", AppGUID: "prod-app-guid", ServiceName: "service-name", ServiceGUID: "prod-service-guid"}
+			other := plugin.JournalEntry{SpaceName: "prod", AppName: "other-app", AppGUID: "other-app-guid", ServiceName: "service-name", ServiceGUID: "prod-service-guid"}
+
+			var entries []plugin.JournalEntry
+			for i, entry := range []plugin.JournalEntry{staging, prod, other, staging} {
+				entry.Timestamp = time.Date(2016, 6, 8, 16+i, 0, 0, 0, time.UTC)
+				entries = append(entries, entry)
+			}
+
+			buffer := &bytes.Buffer{}
+			plugin.RenderHistory(buffer, entries)
+			Expect(buffer.String()).To(Equal(`#  TIME                  SPACE    APP        SERVICE       CHANGES
+1  2016-06-08T16:00:00Z  staging  app-name   service-name  none
+1  2016-06-08T17:00:00Z  prod     app-name   service-name  none
+1  2016-06-08T18:00:00Z  prod     other-app  service-name  none
+2  2016-06-08T19:00:00Z  staging  app-name   service-name  none
+`))
+		})
+	})
+})
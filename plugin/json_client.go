@@ -8,17 +8,63 @@ import (
 	"net/http"
 )
 
+// newHTTPClient returns a client with the TLS and proxy settings, which adds
+// headers to every request.
+func newHTTPClient(tlsOptions TLSOptions, proxyOptions ProxyOptions, headers http.Header) (*http.Client, error) {
+	tlsConfig, err := tlsOptions.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	proxy, err := proxyOptions.ProxyFunc()
+	if err != nil {
+		return nil, err
+	}
+
+	var transport http.RoundTripper = &http.Transport{
+		Proxy:           proxy,
+		TLSClientConfig: tlsConfig,
+	}
+	if len(headers) > 0 {
+		transport = &HeaderTransport{Headers: headers, Transport: transport}
+	}
+
+	return &http.Client{Transport: transport}, nil
+}
+
 type JSONClient struct {
 	HTTPClient  httpClient
 	AccessToken string
+
+	// TokenSource replaces AccessToken with tokens that are refreshed as
+	// they expire
+	TokenSource tokenSource
+}
+
+// UnexpectedResponseError is returned when the server doesn't respond with a
+// 2xx status.
+type UnexpectedResponseError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e UnexpectedResponseError) Error() string {
+	return fmt.Sprintf("unexpected response code: %s", e.Status)
 }
 
 func (c JSONClient) Do(method string, url string, requestData interface{}, responseData interface{}) error {
+	_, err := c.DoWithHeaders(method, url, nil, requestData, responseData)
+	return err
+}
+
+// DoWithHeaders is Do with extra request headers, returning the response
+// headers.
+func (c JSONClient) DoWithHeaders(method string, url string, headers http.Header, requestData interface{}, responseData interface{}) (http.Header, error) {
 	var requestBodyReader io.Reader
 	if requestData != nil {
 		requestBytes, err := json.Marshal(requestData)
 		if err != nil {
-			return err // not tested
+			return nil, err // not tested
 		}
 
 		requestBodyReader = bytes.NewReader(requestBytes)
@@ -26,29 +72,44 @@ func (c JSONClient) Do(method string, url string, requestData interface{}, respo
 
 	request, err := http.NewRequest(method, url, requestBodyReader)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	for name, values := range headers {
+		request.Header[name] = values
 	}
 
 	if requestData != nil {
 		request.Header.Set("Content-Type", "application/json")
 	}
 
-	request.Header.Set("Authorization", c.AccessToken)
+	authorization := c.AccessToken
+	if c.TokenSource != nil {
+		authorization, err = c.TokenSource.Token()
+		if err != nil {
+			return nil, err
+		}
+	}
+	request.Header.Set("Authorization", authorization)
 
 	response, err := c.HTTPClient.Do(request)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer response.Body.Close()
 
-	if response.StatusCode != http.StatusOK {
-		return fmt.Errorf("unexpected response code: %s", response.Status)
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return response.Header, UnexpectedResponseError{
+			StatusCode: response.StatusCode,
+			Status:     response.Status,
+		}
 	}
 
-	if responseData != nil {
+	if responseData != nil && response.StatusCode != http.StatusNoContent {
 		if err = json.NewDecoder(response.Body).Decode(&responseData); err != nil {
-			return fmt.Errorf("couldn't parse response: %s", err)
+			return response.Header, fmt.Errorf("couldn't parse response: %s", err)
 		}
 	}
 
-	return nil
+	return response.Header, nil
 }
@@ -35,8 +35,8 @@ var _ = Describe("JSON Client", func() {
 			}
 
 			jsonClient = plugin.JSONClient{
-				httpClient,
-				"some-token",
+				HTTPClient:  httpClient,
+				AccessToken: "some-token",
 			}
 		})
 
@@ -51,6 +51,44 @@ var _ = Describe("JSON Client", func() {
 			Expect(responseData).To(HaveKeyWithValue("some-key", "some-value"))
 		})
 
+		It("sends extra request headers and returns the response headers", func() {
+			httpClient.DoCall.Returns.Responses[0].Header = http.Header{"Etag": []string{`"some-version"`}}
+
+			headers, err := jsonClient.DoWithHeaders("GET", "http://example.com/some/url", http.Header{"If-Match": []string{`"some-version"`}}, nil, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(httpClient.DoCall.Receives.Request.Header.Get("If-Match")).To(Equal(`"some-version"`))
+			Expect(httpClient.DoCall.Receives.Request.Header.Get("Authorization")).To(Equal("some-token"))
+			Expect(headers.Get("ETag")).To(Equal(`"some-version"`))
+		})
+
+		It("takes the token from the token source when there is one", func() {
+			tokenSource := &mocks.TokenSource{}
+			tokenSource.TokenCall.Returns.Token = "bearer refreshed-token"
+			jsonClient.TokenSource = tokenSource
+
+			err := jsonClient.Do("GET", "http://example.com/some/url", nil, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(httpClient.DoCall.Receives.Request.Header.Get("Authorization")).To(Equal("bearer refreshed-token"))
+		})
+
+		It("accepts any successful response", func() {
+			httpClient.DoCall.Returns.Responses[0].StatusCode = http.StatusCreated
+			httpClient.DoCall.Returns.Responses[0].Status = "201 Created"
+
+			err := jsonClient.Do("PUT", "http://example.com/some/url", nil, &responseData)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(responseData).To(HaveKeyWithValue("some-key", "some-value"))
+		})
+
+		It("doesn't expect a body with 204 No Content", func() {
+			httpClient.DoCall.Returns.Responses[0].StatusCode = http.StatusNoContent
+			httpClient.DoCall.Returns.Responses[0].Status = "204 No Content"
+			httpClient.DoCall.Returns.Responses[0].Body = ioutil.NopCloser(strings.NewReader(""))
+
+			err := jsonClient.Do("DELETE", "http://example.com/some/url", nil, &responseData)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
 		Context("when a requestData variable is not provided", func() {
 			It("should not attempt to marshal the request", func() {
 				err := jsonClient.Do("GET", "http://example.com/some/url", nil, &responseData)
@@ -77,6 +115,18 @@ var _ = Describe("JSON Client", func() {
 				})
 			})
 
+			Context("when the token source errors", func() {
+				It("returns an error without making the request", func() {
+					tokenSource := &mocks.TokenSource{}
+					tokenSource.TokenCall.Returns.Error = errors.New("some error")
+					jsonClient.TokenSource = tokenSource
+
+					err := jsonClient.Do("GET", "some-url", nil, nil)
+					Expect(err).To(MatchError("some error"))
+					Expect(httpClient.DoCall.Receives.Request).To(BeNil())
+				})
+			})
+
 			Context("when the http client errors", func() {
 				It("returns an error", func() {
 					httpClient.DoCall.Returns.Errors = []error{errors.New("some error")}
@@ -93,6 +143,7 @@ var _ = Describe("JSON Client", func() {
 
 					err := jsonClient.Do("GET", "some-url", nil, nil)
 					Expect(err).To(MatchError("unexpected response code: 418 TEAPOT!!"))
+					Expect(err).To(Equal(plugin.UnexpectedResponseError{StatusCode: http.StatusTeapot, Status: "418 TEAPOT!!"}))
 				})
 			})
 
@@ -0,0 +1,111 @@
+package plugin
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type MetricSample struct {
+	Time  time.Time
+	Value float64
+
+	// Instances is the instance count when the sample was recorded, or 0 if
+	// the series doesn't say.
+	Instances int
+}
+
+type metricSamples []MetricSample
+
+func (s metricSamples) Len() int           { return len(s) }
+func (s metricSamples) Less(i, j int) bool { return s[i].Time.Before(s[j].Time) }
+func (s metricSamples) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// ReadMetrics parses a CSV time series with a header row naming its columns.
+// A "timestamp" column holds RFC 3339 times or seconds since the start of the
+// series, the column named by metric holds the values, and an optional
+// "instances" column holds the instance count at the time. Samples are
+// returned in time order.
+func ReadMetrics(r io.Reader, metric string) ([]MetricSample, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("metrics file is empty")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read metrics: %s", err)
+	}
+
+	timeColumn, valueColumn, instancesColumn := -1, -1, -1
+	for i, name := range header {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "timestamp", "time":
+			timeColumn = i
+		case strings.ToLower(metric):
+			valueColumn = i
+		case "instances":
+			instancesColumn = i
+		}
+	}
+
+	if timeColumn == -1 {
+		return nil, fmt.Errorf("metrics file has no timestamp column")
+	}
+
+	if valueColumn == -1 {
+		return nil, fmt.Errorf("metrics file has no %s column", metric)
+	}
+
+	var samples []MetricSample
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("couldn't read metrics: %s", err)
+		}
+
+		sampleTime, err := parseSampleTime(record[timeColumn])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid timestamp %q", line, record[timeColumn])
+		}
+
+		value, err := strconv.ParseFloat(record[valueColumn], 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid %s value %q", line, metric, record[valueColumn])
+		}
+
+		sample := MetricSample{Time: sampleTime, Value: value}
+
+		if instancesColumn != -1 && record[instancesColumn] != "" {
+			sample.Instances, err = strconv.Atoi(record[instancesColumn])
+			if err != nil || sample.Instances < 1 {
+				return nil, fmt.Errorf("line %d: invalid instance count %q", line, record[instancesColumn])
+			}
+		}
+
+		samples = append(samples, sample)
+	}
+
+	if len(samples) == 0 {
+		return nil, fmt.Errorf("metrics file has no samples")
+	}
+
+	sort.Stable(metricSamples(samples))
+	return samples, nil
+}
+
+func parseSampleTime(value string) (time.Time, error) {
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		return time.Unix(0, 0).UTC().Add(time.Duration(seconds * float64(time.Second))), nil
+	}
+
+	return time.Parse(time.RFC3339, value)
+}
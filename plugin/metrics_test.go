@@ -0,0 +1,66 @@
+package plugin_test
+
+import (
+	"strings"
+	"time"
+
+	"github.com/phopper-pivotal/autoscaling-cli-plugin/plugin"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Metrics", func() {
+	Describe("ReadMetrics", func() {
+		It("reads RFC 3339 timestamps and values in time order", func() {
+			samples, err := plugin.ReadMetrics(strings.NewReader(`timestamp,cpu,instances
+2016-06-08T16:05:00Z,80.5,3
+2016-06-08T16:00:00Z,45,2
+`), "cpu")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(samples).To(Equal([]plugin.MetricSample{
+				{Time: time.Date(2016, 6, 8, 16, 0, 0, 0, time.UTC), Value: 45, Instances: 2},
+				{Time: time.Date(2016, 6, 8, 16, 5, 0, 0, time.UTC), Value: 80.5, Instances: 3},
+			}))
+		})
+
+		It("reads timestamps given as seconds and ignores unrelated columns", func() {
+			samples, err := plugin.ReadMetrics(strings.NewReader(`memory, cpu, time
+100,10,0
+200,20,60
+`), "cpu")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(samples).To(HaveLen(2))
+			Expect(samples[1].Time.Sub(samples[0].Time)).To(Equal(time.Minute))
+			Expect(samples[1].Value).To(Equal(20.0))
+			Expect(samples[1].Instances).To(Equal(0))
+		})
+
+		Context("failure cases", func() {
+			It("requires a timestamp column", func() {
+				_, err := plugin.ReadMetrics(strings.NewReader("cpu\n10\n"), "cpu")
+				Expect(err).To(MatchError("metrics file has no timestamp column"))
+			})
+
+			It("requires the metric column", func() {
+				_, err := plugin.ReadMetrics(strings.NewReader("timestamp,memory\n0,10\n"), "cpu")
+				Expect(err).To(MatchError("metrics file has no cpu column"))
+			})
+
+			It("requires samples", func() {
+				_, err := plugin.ReadMetrics(strings.NewReader("timestamp,cpu\n"), "cpu")
+				Expect(err).To(MatchError("metrics file has no samples"))
+			})
+
+			It("reports the line of an invalid value", func() {
+				_, err := plugin.ReadMetrics(strings.NewReader("timestamp,cpu\n0,10\n60,lots\n"), "cpu")
+				Expect(err).To(MatchError(`line 3: invalid cpu value "lots"`))
+			})
+
+			It("reports the line of an invalid timestamp", func() {
+				_, err := plugin.ReadMetrics(strings.NewReader("timestamp,cpu\nyesterday,10\n"), "cpu")
+				Expect(err).To(MatchError(`line 2: invalid timestamp "yesterday"`))
+			})
+		})
+	})
+})
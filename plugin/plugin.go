@@ -1,22 +1,45 @@
 package plugin
 
 import (
-	"crypto/tls"
+	"code.cloudfoundry.org/cli/plugin"
+	"code.cloudfoundry.org/cli/plugin/models"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"net/url"
 	"os"
-	"code.cloudfoundry.org/cli/plugin"
-	"code.cloudfoundry.org/cli/plugin/models"
 )
 
 func NewPlugin() *Plugin {
-	return &Plugin{}
+	return &Plugin{Warnings: os.Stderr, Provisioner: NewServiceProvisioner()}
 }
 
-type Plugin struct{}
+type Plugin struct {
+	// TLS is the TLS settings for every connection, on top of the cf cli's
+	// ssl verification setting
+	TLS TLSOptions
+
+	// Proxy is the proxy for every connection when the environment doesn't
+	// give one
+	Proxy ProxyOptions
+
+	// UserAgent and RequestID are sent with every request, to tell the
+	// plugin's requests apart and correlate those of a command
+	UserAgent string
+	RequestID string
+
+	// AutoscalerAPI overrides the autoscaling API URL of every binding
+	AutoscalerAPI string
+
+	// Warnings is where warnings are written, if anywhere
+	Warnings io.Writer
+
+	// Provisioner waits for the broker when service instances and bindings
+	// are created or removed
+	Provisioner ServiceProvisioner
+}
 
 type AutoscalingBinding struct {
 	AppGuid         string `json:"app_guid"`
@@ -34,6 +57,8 @@ type cliConnection interface {
 	GetService(name string) (plugin_models.GetService_Model, error)
 	GetApp(name string) (plugin_models.GetAppModel, error)
 	IsSSLDisabled() (bool, error)
+	GetCurrentSpace() (plugin_models.Space, error)
+	GetCurrentOrg() (plugin_models.Organization, error)
 }
 
 type httpClient interface {
@@ -42,41 +67,67 @@ type httpClient interface {
 
 type jsonClient interface {
 	Do(method string, url string, requestData interface{}, responseData interface{}) error
+	DoWithHeaders(method string, url string, headers http.Header, requestData interface{}, responseData interface{}) (http.Header, error)
+}
+
+type tokenSource interface {
+	Token() (string, error)
+}
+
+type journal interface {
+	Record(entry JournalEntry) error
+	Entries() ([]JournalEntry, error)
+}
+
+// guardrails decides which changes are allowed.
+type guardrails interface {
+	Evaluate(subject GuardrailSubject) []GuardrailViolation
 }
 
 type CLIDependencies struct {
 	AccessToken string
 	AppName     string
 	ServiceName string
+
+	// AutoscalerAPI overrides the autoscaling API URL the service binding gives
+	AutoscalerAPI string
+
+	// Unbinding says the app is about to be unbound, which drops whatever
+	// disabling its autoscaling would lose
+	Unbinding bool
+
 	Service     plugin_models.GetService_Model
 	APIEndpoint string
 	App         plugin_models.GetAppModel
+	SpaceName   string
 	JSONClient  jsonClient
+	Journal     journal
+	Guardrails  guardrails
+	UI          UI
 }
 
-func (p *Plugin) FetchCLIDependencies(cliConnection plugin.CliConnection, args []string) (CLIDependencies, error) {
-	if len(args) < 2 {
-		return CLIDependencies{}, fmt.Errorf("provide APP_NAME and SERVICE_NAME on command line")
+func (p *Plugin) FetchCLIDependencies(cliConnection cliConnection, args []string) (CLIDependencies, error) {
+	if len(args) < 1 {
+		return CLIDependencies{}, fmt.Errorf("provide APP_NAME on command line")
 	}
 
 	if len(args) > 2 {
 		return CLIDependencies{}, fmt.Errorf("too many arguments provided")
 	}
 
-	appName := args[0]
-	serviceName := args[1]
-
-	isLoggedIn, err := cliConnection.IsLoggedIn()
+	dependencies, err := p.fetchAppDependencies(cliConnection, args[0])
 	if err != nil {
 		return CLIDependencies{}, err
 	}
-	if !isLoggedIn {
-		return CLIDependencies{}, fmt.Errorf("you need to log in")
-	}
 
-	accessToken, err := cliConnection.AccessToken()
-	if err != nil {
-		return CLIDependencies{}, fmt.Errorf("couldn't get access token: %s", err)
+	serviceName := ""
+	if len(args) == 2 {
+		serviceName = args[1]
+	} else {
+		serviceName, err = detectAutoscalerService(cliConnection, dependencies.AppName, dependencies.App.Services)
+		if err != nil {
+			return CLIDependencies{}, err
+		}
 	}
 
 	service, err := cliConnection.GetService(serviceName)
@@ -84,9 +135,18 @@ func (p *Plugin) FetchCLIDependencies(cliConnection plugin.CliConnection, args [
 		return CLIDependencies{}, fmt.Errorf("couldn't get service named %s: %s", serviceName, err)
 	}
 
-	apiEndpoint, err := cliConnection.ApiEndpoint()
+	dependencies.ServiceName = serviceName
+	dependencies.Service = service
+
+	return dependencies, nil
+}
+
+// fetchAppDependencies returns everything FetchCLIDependencies does except
+// the service instance, for when it doesn't exist yet.
+func (p *Plugin) fetchAppDependencies(cliConnection cliConnection, appName string) (CLIDependencies, error) {
+	dependencies, err := p.fetchConnectionDependencies(cliConnection)
 	if err != nil {
-		return CLIDependencies{}, fmt.Errorf("couldn't get API end-point: %s", err)
+		return CLIDependencies{}, err
 	}
 
 	app, err := cliConnection.GetApp(appName)
@@ -94,171 +154,496 @@ func (p *Plugin) FetchCLIDependencies(cliConnection plugin.CliConnection, args [
 		return CLIDependencies{}, fmt.Errorf("couldn't get app %s: %s", appName, err)
 	}
 
+	space, err := cliConnection.GetCurrentSpace()
+	if err != nil {
+		return CLIDependencies{}, fmt.Errorf("couldn't get current space: %s", err)
+	}
+
+	guardrails, err := guardrailsFromEnv()
+	if err != nil {
+		return CLIDependencies{}, err
+	}
+
+	dependencies.AppName = appName
+	dependencies.App = app
+	dependencies.SpaceName = space.Name
+	dependencies.Guardrails = guardrails
+
+	return dependencies, nil
+}
+
+// fetchConnectionDependencies returns what's needed to talk to cloud
+// controller, for commands that aren't about a single app.
+func (p *Plugin) fetchConnectionDependencies(cliConnection cliConnection) (CLIDependencies, error) {
+	isLoggedIn, err := cliConnection.IsLoggedIn()
+	if err != nil {
+		return CLIDependencies{}, err
+	}
+	if !isLoggedIn {
+		return CLIDependencies{}, fmt.Errorf("you need to log in")
+	}
+
+	accessToken, err := cliConnection.AccessToken()
+	if err != nil {
+		return CLIDependencies{}, fmt.Errorf("couldn't get access token: %s", err)
+	}
+
+	apiEndpoint, err := cliConnection.ApiEndpoint()
+	if err != nil {
+		return CLIDependencies{}, fmt.Errorf("couldn't get API end-point: %s", err)
+	}
+
 	skipVerifySSL, err := cliConnection.IsSSLDisabled()
 	if err != nil {
 		return CLIDependencies{}, fmt.Errorf("couldn't check if ssl verification is disabled: %s", err)
 	}
 
-	httpClient := &http.Client{
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{
-				InsecureSkipVerify: skipVerifySSL,
-			},
-		},
+	options := p.TLS
+	options.SkipVerify = options.SkipVerify || skipVerifySSL
+	if options.skipsVerification() && p.Warnings != nil {
+		fmt.Fprintf(p.Warnings, "Warning: not verifying the SSL certificates of %s, trust its CA with --ca-cert, SSL_CERT_FILE or the plugin config file instead\n", apiEndpoint)
+	}
+
+	client, err := newHTTPClient(options, p.Proxy, p.requestHeaders())
+	if err != nil {
+		return CLIDependencies{}, err
 	}
 
 	jsonClient := &JSONClient{
-		HTTPClient:  httpClient,
+		HTTPClient:  client,
 		AccessToken: accessToken,
 	}
 
+	// targets refresh their tokens as they expire, where the cf cli's would
+	// have to be fetched again
+	if target, ok := cliConnection.(*TargetConnection); ok {
+		jsonClient.TokenSource = target.tokens
+	}
+
 	return CLIDependencies{
-		AccessToken: accessToken,
-		AppName:     appName,
-		ServiceName: serviceName,
-		Service:     service,
-		APIEndpoint: apiEndpoint,
-		App:         app,
-		JSONClient:  jsonClient,
+		AccessToken:   accessToken,
+		APIEndpoint:   apiEndpoint,
+		AutoscalerAPI: p.AutoscalerAPI,
+		JSONClient:    jsonClient,
+		Journal:       Journal{Path: DefaultJournalPath()},
+		UI:            NewUI(),
 	}, nil
 }
 
-func getCCQueryURL(apiEndpoint, appGUID, serviceInstanceGUID string) (string, error) {
-	serviceBindingsURL, err := url.Parse(apiEndpoint)
+func getCCURL(apiEndpoint, path string, query url.Values) (string, error) {
+	ccURL, err := url.Parse(apiEndpoint)
 	if err != nil {
 		return "", fmt.Errorf("invalid API URL from cli: %s", apiEndpoint)
 	}
 
-	serviceBindingsURL.Path = "/v2/service_bindings"
-	serviceBindingsURL.RawQuery = url.Values{
+	ccURL.Path = path
+	ccURL.RawQuery = query.Encode()
+
+	return ccURL.String(), nil
+}
+
+func getCCResource(dependencies CLIDependencies, path string, resource interface{}) error {
+	resourceURL, err := getCCURL(dependencies.APIEndpoint, path, nil)
+	if err != nil {
+		return err
+	}
+
+	return dependencies.JSONClient.Do("GET", resourceURL, nil, resource)
+}
+
+func getCCQueryURL(apiEndpoint, appGUID, serviceInstanceGUID string) (string, error) {
+	return getCCURL(apiEndpoint, "/v2/service_bindings", url.Values{
 		"q": []string{
 			fmt.Sprintf("app_guid:%s", appGUID),
 			fmt.Sprintf("service_instance_guid:%s", serviceInstanceGUID),
 		},
-	}.Encode()
+	})
+}
 
-	return serviceBindingsURL.String(), nil
+// DefaultBinding holds the settings the broker gives a new binding.
+var DefaultBinding = AutoscalingBinding{
+	MinInstances:    2,
+	MaxInstances:    5,
+	CPUMinThreshold: 20,
+	CPUMaxThreshold: 80,
 }
 
-func getBindingURL(fullDashboardURL, bindingGUID string) (string, error) {
-	dashboardURL, err := url.Parse(fullDashboardURL)
-	if err != nil {
-		return "", fmt.Errorf("invalid dashboard URL from service instance: %s", fullDashboardURL)
+// Flags holds the settings given on the command line. Settings that weren't
+// given are nil and leave the binding's current value alone.
+type Flags struct {
+	MinInstances    *int
+	MaxInstances    *int
+	CPUMinThreshold *int
+	CPUMaxThreshold *int
+
+	// Reset restores DefaultBinding before applying any other settings
+	Reset bool
+
+	// Enabled defaults to true, as configuring a binding enables it
+	Enabled *bool
+
+	// RetryOnConflict re-applies the settings to a fresh copy of the binding
+	// when someone else changed it in the meantime
+	RetryOnConflict bool
+
+	// Force applies risky changes without asking for confirmation
+	Force bool
+
+	// ScaleNow scales the app into the new limits straight away instead of
+	// leaving it to the autoscaler
+	ScaleNow bool
+
+	// Interactive asks for each setting instead of taking them from flags
+	Interactive bool
+
+	// CreateIfMissing creates the service instance with Plan and binds it to
+	// the app if that hasn't been done already
+	CreateIfMissing bool
+	Plan            string
+
+	// GuardrailsFile replaces the guardrails from the environment
+	GuardrailsFile string
+}
+
+func (f Flags) Apply(binding AutoscalingBinding) AutoscalingBinding {
+	if f.Reset {
+		binding.MinInstances = DefaultBinding.MinInstances
+		binding.MaxInstances = DefaultBinding.MaxInstances
+		binding.CPUMinThreshold = DefaultBinding.CPUMinThreshold
+		binding.CPUMaxThreshold = DefaultBinding.CPUMaxThreshold
+	}
+
+	if f.MinInstances != nil {
+		binding.MinInstances = *f.MinInstances
+	}
+
+	if f.MaxInstances != nil {
+		binding.MaxInstances = *f.MaxInstances
+	}
+
+	if f.CPUMinThreshold != nil {
+		binding.CPUMinThreshold = *f.CPUMinThreshold
+	}
+
+	if f.CPUMaxThreshold != nil {
+		binding.CPUMaxThreshold = *f.CPUMaxThreshold
+	}
+
+	binding.Enabled = true
+	if f.Enabled != nil {
+		binding.Enabled = *f.Enabled
 	}
 
-	baseURL := fmt.Sprintf("%s://%s", dashboardURL.Scheme, dashboardURL.Host)
-	return fmt.Sprintf("%s/api/bindings/%s", baseURL, bindingGUID), nil
+	return binding
 }
 
-type Flags struct {
-	MinInstances    int
-	MaxInstances    int
-	CPUMinThreshold int
-	CPUMaxThreshold int
+// flagsFor returns flags that set every setting of binding.
+func flagsFor(binding AutoscalingBinding) Flags {
+	minInstances, maxInstances := binding.MinInstances, binding.MaxInstances
+	cpuMinThreshold, cpuMaxThreshold := binding.CPUMinThreshold, binding.CPUMaxThreshold
+	enabled := binding.Enabled
+
+	return Flags{
+		MinInstances:    &minInstances,
+		MaxInstances:    &maxInstances,
+		CPUMinThreshold: &cpuMinThreshold,
+		CPUMaxThreshold: &cpuMaxThreshold,
+		Enabled:         &enabled,
+	}
 }
 
-func (p *Plugin) RunWithError(dependencies CLIDependencies, flags Flags) error {
-	appGUID := dependencies.App.Guid
+func addConfigureFlags(flagSet *flag.FlagSet, flags *Flags) func() {
+	var minInstances, maxInstances, cpuMinThreshold, cpuMaxThreshold int
+	flagSet.IntVar(&minInstances, "min-instances", 0, "(optional) set the minimum instance count")
+	flagSet.IntVar(&maxInstances, "max-instances", 0, "(optional) set the maximum instance count")
+	flagSet.IntVar(&cpuMinThreshold, "min-threshold", 0, "(optional) set the minimum cpu threshold percentage")
+	flagSet.IntVar(&cpuMaxThreshold, "max-threshold", 0, "(optional) set the maximum cpu threshold percentage")
+	flagSet.BoolVar(&flags.Reset, "reset", false, "(optional) restore the broker's default settings before applying any others")
+	flagSet.BoolVar(&flags.RetryOnConflict, "retry-on-conflict", false, "(optional) re-apply the settings if someone else changed the binding in the meantime")
+	flagSet.BoolVar(&flags.Force, "f", false, "(optional) apply risky changes without asking for confirmation")
+	flagSet.BoolVar(&flags.Force, "force", false, "(optional) apply risky changes without asking for confirmation")
+	flagSet.BoolVar(&flags.ScaleNow, "scale-now", false, "(optional) scale the app into the new instance limits straight away")
+	flagSet.BoolVar(&flags.Interactive, "interactive", false, "(optional) ask for each setting, showing the current values")
+	flagSet.BoolVar(&flags.CreateIfMissing, "create-if-missing", false, "(optional) create the service instance and bind it to the app if needed")
+	flagSet.StringVar(&flags.Plan, "plan", "", "(optional) service plan to create the service instance with")
+	flagSet.StringVar(&flags.GuardrailsFile, "guardrails-file", "", "(optional) file of guardrail rules the settings must follow")
+
+	// only the flags that were given end up in flags, so they can be set to 0
+	return func() {
+		flagSet.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "min-instances":
+				flags.MinInstances = &minInstances
+			case "max-instances":
+				flags.MaxInstances = &maxInstances
+			case "min-threshold":
+				flags.CPUMinThreshold = &cpuMinThreshold
+			case "max-threshold":
+				flags.CPUMaxThreshold = &cpuMaxThreshold
+			}
+		})
+	}
+}
+
+// remoteBinding is a binding as it was fetched from the autoscaling API,
+// along with whatever the API told us about its version.
+type remoteBinding struct {
+	URL          string
+	Binding      AutoscalingBinding
+	ETag         string
+	LastModified string
+
+	// Policy is the App Autoscaler policy the binding came from, if any
+	Policy *AppAutoscalerPolicy
+}
 
+// lookupServiceBinding returns cloud controller's binding of the app to the
+// service instance.
+func lookupServiceBinding(dependencies CLIDependencies) (ccResource, error) {
 	// get from cloud controller
-	serviceBindingsURL, err := getCCQueryURL(dependencies.APIEndpoint, appGUID, dependencies.Service.Guid)
+	serviceBindingsURL, err := getCCQueryURL(dependencies.APIEndpoint, dependencies.App.Guid, dependencies.Service.Guid)
 	if err != nil {
-		return err
-	}
-
-	var ccResponse struct {
-		Resources []struct {
-			Metadata struct {
-				GUID string
-			}
-		}
+		return ccResource{}, err
 	}
 
+	var ccResponse ccResources
 	err = dependencies.JSONClient.Do("GET", serviceBindingsURL, nil, &ccResponse)
 	if err != nil {
-		return fmt.Errorf("couldn't retrieve service binding: %s", err)
+		return ccResource{}, fmt.Errorf("couldn't retrieve service binding: %s", err)
 	}
 
 	if len(ccResponse.Resources) != 1 {
-		return fmt.Errorf("couldn't find service binding for %s to %s", dependencies.AppName, dependencies.ServiceName)
+		return ccResource{}, fmt.Errorf("couldn't find service binding for %s to %s", dependencies.AppName, dependencies.ServiceName)
+	}
+
+	return ccResponse.Resources[0], nil
+}
+
+// lookupServiceBindingGUID returns the GUID of cloud controller's binding of
+// the app to the service instance.
+func lookupServiceBindingGUID(dependencies CLIDependencies) (string, error) {
+	binding, err := lookupServiceBinding(dependencies)
+	if err != nil {
+		return "", err
+	}
+
+	return binding.Metadata.GUID, nil
+}
+
+func lookupBindingURL(dependencies CLIDependencies) (string, error) {
+	binding, err := lookupServiceBinding(dependencies)
+	if err != nil {
+		return "", err
+	}
+
+	return backendFor(dependencies).URL(dependencies, binding)
+}
+
+func getBinding(dependencies CLIDependencies, bindingURL string) (remoteBinding, error) {
+	return backendFor(dependencies).Get(dependencies, bindingURL)
+}
+
+func (p *Plugin) fetchBinding(dependencies CLIDependencies) (remoteBinding, error) {
+	bindingURL, err := lookupBindingURL(dependencies)
+	if err != nil {
+		return remoteBinding{}, err
 	}
 
 	// get from autoscaling
-	fullURL, err := getBindingURL(dependencies.Service.DashboardUrl, ccResponse.Resources[0].Metadata.GUID)
+	return getBinding(dependencies, bindingURL)
+}
+
+func (p *Plugin) RunWithError(dependencies CLIDependencies, flags Flags) error {
+	bindingURL, err := lookupBindingURL(dependencies)
 	if err != nil {
 		return err
 	}
 
-	var autoscalingBinding AutoscalingBinding
+	if flags.GuardrailsFile != "" {
+		guardrails, err := LoadGuardrails(flags.GuardrailsFile)
+		if err != nil {
+			return err
+		}
+		dependencies.Guardrails = guardrails
+	}
+
+	confirm, err := riskConfirmation(dependencies, flags.Force)
+	if err != nil {
+		return err
+	}
+
+	for attempt := 1; ; attempt++ {
+		current, err := getBinding(dependencies, bindingURL)
+		if err != nil {
+			return err
+		}
+
+		autoscalingBinding := flags.Apply(current.Binding)
+
+		// autoscaling response does not include the app guid, so we have to set it
+		autoscalingBinding.AppGuid = dependencies.App.Guid
+
+		// post to autoscaling
+		err = postBinding(dependencies, current, autoscalingBinding, confirm)
+		if _, ok := err.(ConflictError); ok && flags.RetryOnConflict && attempt < maxConflictAttempts {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		return scaleIntoLimits(dependencies, autoscalingBinding, flags.ScaleNow)
+	}
+}
+
+// ParseConfigureFlags parses the configure-autoscaling command line and
+// returns the flags along with the remaining arguments.
+func ParseConfigureFlags(args []string) (Flags, []string, error) {
+	var flags Flags
+	flagSet := flag.NewFlagSet("configure-autoscaling", flag.ContinueOnError)
+	collectFlags := addConfigureFlags(flagSet, &flags)
+	err := flagSet.Parse(args)
+	if err != nil {
+		return Flags{}, nil, err
+	}
+	collectFlags()
+
+	return flags, flagSet.Args(), nil
+}
 
-	err = dependencies.JSONClient.Do("GET", fullURL, nil, &autoscalingBinding)
+func (p *Plugin) runConfigure(cliConnection cliConnection, args []string) error {
+	flags, args, err := ParseConfigureFlags(args)
 	if err != nil {
-		return fmt.Errorf("autoscaling API: %s", err)
+		return err
 	}
 
-	if flags.MinInstances > 0 {
-		autoscalingBinding.MinInstances = flags.MinInstances
+	if flags.Interactive {
+		return p.runWizard(cliConnection, flags, args)
 	}
 
-	if flags.MaxInstances > 0 {
-		autoscalingBinding.MaxInstances = flags.MaxInstances
+	if flags.CreateIfMissing {
+		return p.runCreateIfMissing(cliConnection, flags, args)
 	}
 
-	if flags.CPUMinThreshold > 0 {
-		autoscalingBinding.CPUMinThreshold = flags.CPUMinThreshold
+	dependencies, err := p.FetchCLIDependencies(cliConnection, args)
+	if err != nil {
+		return err
 	}
 
-	if flags.CPUMaxThreshold > 0 {
-		autoscalingBinding.CPUMaxThreshold = flags.CPUMaxThreshold
+	return p.RunWithError(dependencies, flags)
+}
+
+// requestHeaders returns the headers sent with every request.
+func (p *Plugin) requestHeaders() http.Header {
+	headers := http.Header{}
+	if p.UserAgent != "" {
+		headers.Set("User-Agent", p.UserAgent)
+	}
+	if p.RequestID != "" {
+		headers.Set(requestIDHeader, p.RequestID)
 	}
 
-	if autoscalingBinding.MinInstances > autoscalingBinding.MaxInstances {
-		return fmt.Errorf("min instances must be <= max instances")
+	return headers
+}
+
+func (p *Plugin) pluginVersion() string {
+	version := p.GetMetadata().Version
+	return fmt.Sprintf("%d.%d.%d", version.Major, version.Minor, version.Build)
+}
+
+// applyGlobalFlags takes the global flags out of args and applies them, along
+// with the plugin config file, returning the connection to run the command
+// with.
+func (p *Plugin) applyGlobalFlags(cliConnection cliConnection, args []string) (cliConnection, []string, error) {
+	flags, args, err := ParseGlobalFlags(args)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	if autoscalingBinding.CPUMinThreshold > autoscalingBinding.CPUMaxThreshold {
-		return fmt.Errorf("CPU min threshold must be <= CPU max threshold")
+	config, err := LoadConfig(DefaultConfigPath())
+	if err != nil {
+		return nil, nil, err
 	}
 
-	// autoscaling response does not include the app guid, so we have to set it
-	autoscalingBinding.AppGuid = appGUID
-	autoscalingBinding.Enabled = true
+	p.TLS = ResolveTLSOptions(config.TLS, flags)
+	p.Proxy = config.Proxy
+	p.UserAgent = UserAgent(p.pluginVersion(), cfVersion(cliConnection))
+	p.AutoscalerAPI = flags.AutoscalerAPI
 
-	// post to autoscaling
-	err = dependencies.JSONClient.Do("POST", fullURL, &autoscalingBinding, nil)
+	connection, err := p.selectTarget(cliConnection, config, flags.Target)
 	if err != nil {
-		return fmt.Errorf("autoscaling API: %s", err)
+		return nil, nil, err
+	}
+
+	if p.AutoscalerAPI == "" {
+		p.AutoscalerAPI = config.AutoscalerAPI
 	}
 
-	return nil
+	return connection, args, nil
 }
 
 func (p *Plugin) Run(cliConnection plugin.CliConnection, args []string) {
 	logger := log.New(os.Stdout, "", 0)
 
-	var flags Flags
-	flagSet := flag.NewFlagSet("configure-autoscaling", flag.ContinueOnError)
-	flagSet.IntVar(&flags.MinInstances, "min-instances", 0, "(optional) set the minimum instance count")
-	flagSet.IntVar(&flags.MaxInstances, "max-instances", 0, "(optional) set the maximum instance count")
-	flagSet.IntVar(&flags.CPUMinThreshold, "min-threshold", 0, "(optional) set the minimum cpu threshold percentage")
-	flagSet.IntVar(&flags.CPUMaxThreshold, "max-threshold", 0, "(optional) set the maximum cpu threshold percentage")
-	err := flagSet.Parse(args[1:])
+	if args[0] == "CLI-MESSAGE-UNINSTALL" {
+		return
+	}
+
+	p.RequestID = NewRequestID()
+
+	err := p.RunCommand(cliConnection, args)
+	switch err.(type) {
+	case DriftError, DriftReportError:
+		// the diff or report is already on stdout, keep it parseable
+		logger.SetOutput(os.Stderr)
+	}
 	if err != nil {
-		logger.Fatalf("%s", err)
+		logger.Fatalf("%s\nrequest id for support: %s", err, p.RequestID)
+	}
+}
+
+// offlineCommands never talk to cloud foundry, so they run without the
+// global flags, the plugin config file or a target.
+var offlineCommands = map[string]func(*Plugin, []string) error{
+	"simulate-autoscaling":  (*Plugin).runSimulate,
+	"recommend-autoscaling": (*Plugin).runRecommend,
+}
+
+// RunCommand runs the command in args.
+func (p *Plugin) RunCommand(cliConnection cliConnection, args []string) error {
+	if run, ok := offlineCommands[args[0]]; ok {
+		return run(p, args[1:])
 	}
 
-	dependencies, err := p.FetchCLIDependencies(cliConnection, flagSet.Args())
+	connection, args, err := p.applyGlobalFlags(cliConnection, args)
 	if err != nil {
-		logger.Fatalf("%s", err)
+		return err
 	}
 
-	if err := p.RunWithError(dependencies, flags); err != nil {
-		logger.Fatalf("%s", err)
+	switch args[0] {
+	case "autoscaling-status":
+		return p.runStatus(connection, args[1:])
+	case "autoscaling-history":
+		return p.runHistory(connection, args[1:])
+	case "undo-autoscaling":
+		return p.runUndo(connection, args[1:])
+	case "remove-autoscaling":
+		return p.runRemove(connection, args[1:])
+	case "copy-autoscaling":
+		return p.runCopy(connection, args[1:])
+	case "handover-autoscaling":
+		return p.runHandover(connection, args[1:])
+	case "diff-autoscaling":
+		return p.runDiff(connection, args[1:])
+	case "autoscaling-drift-report":
+		return p.runDriftReport(connection, args[1:])
+	default:
+		return p.runConfigure(connection, args[1:])
 	}
 }
 
 func (c *Plugin) GetMetadata() plugin.PluginMetadata {
-	return plugin.PluginMetadata{
+	metadata := plugin.PluginMetadata{
 		Name: "Autoscaling",
 		Version: plugin.VersionType{
 			Major: 0,
@@ -278,15 +663,153 @@ func (c *Plugin) GetMetadata() plugin.PluginMetadata {
 				// UsageDetails is optional
 				// It is used to show help of usage of each command
 				UsageDetails: plugin.Usage{
-					Usage: "configure-autoscaling\n   cf configure-autoscaling APP_NAME SERVICE_INSTANCE",
+					Usage: "configure-autoscaling\n   cf configure-autoscaling APP_NAME [SERVICE_INSTANCE]\n   cf configure-autoscaling --interactive APP_NAME [SERVICE_INSTANCE]\n   cf configure-autoscaling --create-if-missing --plan PLAN APP_NAME SERVICE_INSTANCE",
+					Options: map[string]string{
+						"min-instances":     "(optional) set the minimum instance count",
+						"max-instances":     "(optional) set the maximum instance count",
+						"min-threshold":     "(optional) set the minimum cpu threshold percentage",
+						"max-threshold":     "(optional) set the maximum cpu threshold percentage",
+						"reset":             "(optional) restore the broker's default settings before applying any others",
+						"retry-on-conflict": "(optional) re-apply the settings if someone else changed the binding in the meantime",
+						"f":                 "(optional) apply risky changes without asking for confirmation",
+						"scale-now":         "(optional) scale the app into the new instance limits straight away",
+						"interactive":       "(optional) ask for each setting, showing the current values",
+						"create-if-missing": "(optional) create the service instance and bind it to the app if needed",
+						"plan":              "(optional) service plan to create the service instance with",
+						"guardrails-file":   "(optional) file of guardrail rules the settings must follow, defaults to $AUTOSCALING_GUARDRAILS_FILE",
+					},
+				},
+			},
+			plugin.Command{
+				Name:     "autoscaling-status",
+				HelpText: "Show the autoscaling state of an app",
+				UsageDetails: plugin.Usage{
+					Usage: "autoscaling-status\n   cf autoscaling-status [--watch [--interval 5s]] APP_NAME [SERVICE_INSTANCE]",
+					Options: map[string]string{
+						"watch":    "(optional) keep polling and redraw the status until interrupted",
+						"interval": "(optional) time between polls when watching, defaults to 5s",
+					},
+				},
+			},
+			plugin.Command{
+				Name:     "autoscaling-history",
+				HelpText: "List the autoscaling changes made from this machine",
+				UsageDetails: plugin.Usage{
+					Usage: "autoscaling-history\n   cf autoscaling-history [APP_NAME SERVICE_INSTANCE]",
+				},
+			},
+			plugin.Command{
+				Name:     "undo-autoscaling",
+				HelpText: "Undo the last autoscaling change, or go back to an earlier one",
+				UsageDetails: plugin.Usage{
+					Usage: "undo-autoscaling\n   cf undo-autoscaling [--to N] [-f] APP_NAME [SERVICE_INSTANCE]",
+					Options: map[string]string{
+						"to": "(optional) restore the settings as they were after change N in autoscaling-history",
+						"f":  "(optional) apply risky changes without asking for confirmation",
+					},
+				},
+			},
+			plugin.Command{
+				Name:     "remove-autoscaling",
+				HelpText: "Disable autoscaling for an app and unbind it from the service instance",
+				UsageDetails: plugin.Usage{
+					Usage: "remove-autoscaling\n   cf remove-autoscaling [--backup POLICY_FILE] [--keep-binding | --delete-service] [-f] APP_NAME [SERVICE_INSTANCE]",
+					Options: map[string]string{
+						"backup":         "(optional) save the settings to this policy file first",
+						"keep-binding":   "(optional) only disable autoscaling, leaving the app bound to the service instance",
+						"delete-service": "(optional) delete the service instance if no other apps are bound to it",
+						"f":              "(optional) remove without asking for confirmation",
+					},
+				},
+			},
+			plugin.Command{
+				Name:     "copy-autoscaling",
+				HelpText: "Copy the autoscaling settings of one app to another",
+				UsageDetails: plugin.Usage{
+					Usage: "copy-autoscaling\n   cf copy-autoscaling [--source-space SPACE] [--dest-service SERVICE_INSTANCE] [-f] SOURCE_APP DEST_APP SERVICE_INSTANCE",
+					Options: map[string]string{
+						"source-space": "(optional) space of the source app and service instance, defaults to the targeted space",
+						"dest-service": "(optional) service instance of the destination app, defaults to SERVICE_INSTANCE",
+						"f":            "(optional) apply risky changes without asking for confirmation",
+					},
+				},
+			},
+			plugin.Command{
+				Name:     "handover-autoscaling",
+				HelpText: "Hand autoscaling over from the old to the new app of a blue/green deployment",
+				UsageDetails: plugin.Usage{
+					Usage: "handover-autoscaling\n   cf handover-autoscaling OLD_APP NEW_APP SERVICE_INSTANCE",
+				},
+			},
+			plugin.Command{
+				Name:     "diff-autoscaling",
+				HelpText: "Compare the autoscaling settings of two apps, or of an app and a policy file",
+				UsageDetails: plugin.Usage{
+					Usage: "diff-autoscaling\n   cf diff-autoscaling [--other-space SPACE] [--other-service SERVICE_INSTANCE] APP_NAME OTHER_APP SERVICE_INSTANCE\n   cf diff-autoscaling --policy POLICY_FILE APP_NAME [SERVICE_INSTANCE]",
 					Options: map[string]string{
-						"min-instances": "(optional) set the minimum instance count",
-						"max-instances": "(optional) set the maximum instance count",
-						"min-threshold": "(optional) set the minimum cpu threshold percentage",
-						"max-threshold": "(optional) set the maximum cpu threshold percentage",
+						"policy":        "(optional) policy file to compare the app with",
+						"other-space":   "(optional) space of the other app, defaults to the targeted space",
+						"other-service": "(optional) service instance of the other app, defaults to SERVICE_INSTANCE",
+					},
+				},
+			},
+			plugin.Command{
+				Name:     "autoscaling-drift-report",
+				HelpText: "Report the apps of an org whose autoscaling settings drifted from their policy files",
+				UsageDetails: plugin.Usage{
+					Usage: "autoscaling-drift-report\n   cf autoscaling-drift-report --policies DIR [--org ORG] [--label LABEL] [--format json|junit] [--concurrency N]",
+					Options: map[string]string{
+						"policies":    "directory of policy files named after the apps",
+						"org":         "(optional) org to report on, defaults to the targeted org",
+						"label":       "(optional) app label naming the app's policy file, for apps named differently",
+						"format":      "(optional) json or junit, defaults to json",
+						"concurrency": "(optional) how many apps to check at once, defaults to 4",
+					},
+				},
+			},
+			plugin.Command{
+				Name:     "simulate-autoscaling",
+				HelpText: "Replay a metrics time series against an autoscaling policy, offline",
+				UsageDetails: plugin.Usage{
+					Usage: "simulate-autoscaling\n   cf simulate-autoscaling --policy POLICY_FILE --metrics CSV_FILE",
+					Options: map[string]string{
+						"policy":            "policy file with the limits and thresholds to simulate",
+						"metrics":           "CSV file with timestamp and cpu columns, and optionally the instances recorded",
+						"metric":            "(optional) metrics column to replay, defaults to cpu",
+						"interval":          "(optional) time between scaling decisions, defaults to 5m",
+						"initial-instances": "(optional) instance count at the start, defaults to the policy's min instances",
+					},
+				},
+			},
+			plugin.Command{
+				Name:     "recommend-autoscaling",
+				HelpText: "Recommend autoscaling settings from historical CPU utilisation",
+				UsageDetails: plugin.Usage{
+					Usage: "recommend-autoscaling\n   cf recommend-autoscaling --metrics FILE [APP_NAME SERVICE_INSTANCE]",
+					Options: map[string]string{
+						"metrics": "CSV time series, or JSON responses from /v3/processes/:guid/stats, with per-instance CPU",
+						"format":  "(optional) format of the metrics file, csv or json, defaults to the file extension",
+						"output":  "(optional) text, flags or policy, defaults to text",
 					},
 				},
 			},
 		},
 	}
+
+	// the global flags work with every command that talks to cloud foundry
+	for i := range metadata.Commands {
+		if _, ok := offlineCommands[metadata.Commands[i].Name]; ok {
+			continue
+		}
+		if metadata.Commands[i].UsageDetails.Options == nil {
+			metadata.Commands[i].UsageDetails.Options = map[string]string{}
+		}
+		metadata.Commands[i].UsageDetails.Options["target"] = "(optional) run against a foundation from the plugin config file instead of the logged in one, defaults to $AUTOSCALING_TARGET"
+		metadata.Commands[i].UsageDetails.Options["ca-cert"] = "(optional) PEM file of CAs to trust besides the system's, can be repeated, also $SSL_CERT_FILE"
+		metadata.Commands[i].UsageDetails.Options["client-cert"] = "(optional) PEM client certificate for servers that ask for one, defaults to $AUTOSCALING_CLIENT_CERT_FILE"
+		metadata.Commands[i].UsageDetails.Options["client-key"] = "(optional) PEM key of the client certificate, defaults to $AUTOSCALING_CLIENT_KEY_FILE"
+		metadata.Commands[i].UsageDetails.Options["autoscaler-api"] = "(optional) URL of the autoscaling API, for when the service binding doesn't give it and it isn't on the dashboard's host"
+	}
+
+	return metadata
 }
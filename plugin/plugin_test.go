@@ -1,10 +1,15 @@
 package plugin_test
 
 import (
+	"bytes"
 	"crypto/tls"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
 
 	"code.cloudfoundry.org/cli/plugin/models"
 	"github.com/phopper-pivotal/autoscaling-cli-plugin/mocks"
@@ -23,16 +28,23 @@ type autoscalingBinding struct {
 	Enabled         bool   `json:"enabled"`
 }
 
+func intPtr(i int) *int {
+	return &i
+}
+
 var _ = Describe("Plugin", func() {
 	Describe("FetchCLIDependencies", func() {
 		var (
 			p             *plugin.Plugin
 			cliConnection *mocks.CLIConnection
 			args          []string
+			warnings      *bytes.Buffer
 		)
 
 		BeforeEach(func() {
+			warnings = &bytes.Buffer{}
 			p = plugin.NewPlugin()
+			p.Warnings = warnings
 			cliConnection = &mocks.CLIConnection{}
 			args = []string{"app-name", "service-name"}
 
@@ -43,11 +55,21 @@ var _ = Describe("Plugin", func() {
 			cliConnection.ApiEndpointCall.Returns.ApiEndpoint = "api.example.com"
 			cliConnection.AccessTokenCall.Returns.Token = "bearer some-token"
 			cliConnection.IsSSLDisabledCall.Returns.Disabled = true
+			cliConnection.GetCurrentSpaceCall.Returns.Space.Name = "some-space"
 		})
 
 		It("returns all CLI dependency values", func() {
 			dependencies, err := p.FetchCLIDependencies(cliConnection, args)
 			Expect(err).NotTo(HaveOccurred())
+
+			// the transport's proxy is a func, which can't be compared
+			jsonClient := dependencies.JSONClient.(*plugin.JSONClient)
+			Expect(jsonClient.AccessToken).To(Equal("bearer some-token"))
+			transport := jsonClient.HTTPClient.(*http.Client).Transport.(*http.Transport)
+			Expect(transport.TLSClientConfig).To(Equal(&tls.Config{InsecureSkipVerify: true}))
+			Expect(transport.Proxy).NotTo(BeNil())
+
+			dependencies.JSONClient = nil
 			Expect(dependencies).To(Equal(plugin.CLIDependencies{
 				AccessToken: "bearer some-token",
 				AppName:     "app-name",
@@ -60,27 +82,139 @@ var _ = Describe("Plugin", func() {
 				App: plugin_models.GetAppModel{
 					Guid: "some-app-guid",
 				},
-				JSONClient: &plugin.JSONClient{
-					HTTPClient: &http.Client{
-						Transport: &http.Transport{
-							TLSClientConfig: &tls.Config{
-								InsecureSkipVerify: true,
-							},
-						},
-					},
-					AccessToken: "bearer some-token",
-				},
+				SpaceName: "some-space",
+				Journal:   plugin.Journal{Path: plugin.DefaultJournalPath()},
+				UI:        plugin.NewUI(),
 			}))
 
 			Expect(cliConnection.GetServiceCall.Receives.ServiceName).To(Equal("service-name"))
 			Expect(cliConnection.GetAppCall.Receives.AppName).To(Equal("app-name"))
 		})
 
+		It("warns that ssl verification is skipped", func() {
+			_, err := p.FetchCLIDependencies(cliConnection, args)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(warnings.String()).To(Equal("Warning: not verifying the SSL certificates of api.example.com, trust its CA with --ca-cert, SSL_CERT_FILE or the plugin config file instead\n"))
+		})
+
+		Context("when CAs are given", func() {
+			It("verifies ssl certificates with them", func() {
+				p.TLS.CACertFiles = []string{"/does/not/exist.pem"}
+
+				_, err := p.FetchCLIDependencies(cliConnection, args)
+				Expect(err).To(MatchError(ContainSubstring("couldn't read CA certificate file")))
+				Expect(warnings.String()).To(BeEmpty())
+			})
+		})
+
+		Context("when the service instance isn't given", func() {
+			BeforeEach(func() {
+				args = []string{"app-name"}
+				cliConnection.GetAppCall.Returns.App.Services = []plugin_models.GetApp_ServiceSummary{
+					{Name: "some-database"},
+					{Name: "service-name"},
+				}
+
+				database := plugin_models.GetService_Model{}
+				database.ServiceOffering.Name = "p-mysql"
+				autoscaler := cliConnection.GetServiceCall.Returns.Service
+				autoscaler.ServiceOffering.Name = "app-autoscaler"
+
+				cliConnection.GetServiceCall.Returns.ServicesByName = map[string]plugin_models.GetService_Model{
+					"some-database": database,
+					"service-name":  autoscaler,
+					"other-service": autoscaler,
+				}
+			})
+
+			It("uses the autoscaler bound to the app", func() {
+				dependencies, err := p.FetchCLIDependencies(cliConnection, args)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(dependencies.ServiceName).To(Equal("service-name"))
+				Expect(dependencies.Service.Guid).To(Equal("some-service-instance-guid"))
+			})
+
+			Context("when the autoscaler's offering has a different name", func() {
+				var previous string
+
+				BeforeEach(func() {
+					previous = os.Getenv("AUTOSCALING_SERVICE_OFFERING")
+					os.Setenv("AUTOSCALING_SERVICE_OFFERING", "p-mysql")
+				})
+
+				AfterEach(func() {
+					os.Setenv("AUTOSCALING_SERVICE_OFFERING", previous)
+				})
+
+				It("uses the service with that offering", func() {
+					dependencies, err := p.FetchCLIDependencies(cliConnection, args)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(dependencies.ServiceName).To(Equal("some-database"))
+				})
+			})
+
+			It("finds App Autoscaler service instances too", func() {
+				appAutoscaler := cliConnection.GetServiceCall.Returns.ServicesByName["service-name"]
+				appAutoscaler.ServiceOffering.Name = "autoscaler"
+				cliConnection.GetServiceCall.Returns.ServicesByName["service-name"] = appAutoscaler
+
+				dependencies, err := p.FetchCLIDependencies(cliConnection, args)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(dependencies.ServiceName).To(Equal("service-name"))
+			})
+
+			It("fails when no autoscaler is bound to the app", func() {
+				cliConnection.GetAppCall.Returns.App.Services = cliConnection.GetAppCall.Returns.App.Services[:1]
+
+				_, err := p.FetchCLIDependencies(cliConnection, args)
+				Expect(err).To(MatchError("no app-autoscaler or autoscaler service instances are bound to app-name, provide SERVICE_INSTANCE on command line"))
+			})
+
+			It("fails when several autoscalers are bound to the app", func() {
+				cliConnection.GetAppCall.Returns.App.Services = append(cliConnection.GetAppCall.Returns.App.Services, plugin_models.GetApp_ServiceSummary{Name: "other-service"})
+
+				_, err := p.FetchCLIDependencies(cliConnection, args)
+				Expect(err).To(MatchError("several app-autoscaler or autoscaler service instances are bound to app-name, provide one of them as SERVICE_INSTANCE on command line: service-name, other-service"))
+			})
+		})
+
+		Context("when AUTOSCALING_GUARDRAILS_FILE is set", func() {
+			var previous string
+
+			BeforeEach(func() {
+				previous = os.Getenv("AUTOSCALING_GUARDRAILS_FILE")
+			})
+
+			AfterEach(func() {
+				os.Setenv("AUTOSCALING_GUARDRAILS_FILE", previous)
+			})
+
+			It("loads the guardrails from it", func() {
+				file, err := ioutil.TempFile("", "guardrails")
+				Expect(err).NotTo(HaveOccurred())
+				defer os.Remove(file.Name())
+				file.WriteString("rules:\n- name: some-rule\n  field: min_instances\n  min: 2\n")
+				file.Close()
+				os.Setenv("AUTOSCALING_GUARDRAILS_FILE", file.Name())
+
+				dependencies, err := p.FetchCLIDependencies(cliConnection, args)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(dependencies.Guardrails).To(BeAssignableToTypeOf(plugin.Guardrails{}))
+			})
+
+			It("fails when they can't be loaded", func() {
+				os.Setenv("AUTOSCALING_GUARDRAILS_FILE", "/does/not/exist.yml")
+
+				_, err := p.FetchCLIDependencies(cliConnection, args)
+				Expect(err).To(MatchError(ContainSubstring("couldn't read guardrails file")))
+			})
+		})
+
 		Context("failure cases", func() {
 			Context("when the user does not provide an app name or service instance name", func() {
 				It("returns an error", func() {
-					_, err := p.FetchCLIDependencies(cliConnection, []string{"app-name"})
-					Expect(err).To(MatchError("provide APP_NAME and SERVICE_NAME on command line"))
+					_, err := p.FetchCLIDependencies(cliConnection, []string{})
+					Expect(err).To(MatchError("provide APP_NAME on command line"))
 
 					_, err = p.FetchCLIDependencies(cliConnection, []string{"app-name", "service-name", "another-arg"})
 					Expect(err).To(MatchError("too many arguments provided"))
@@ -141,6 +275,15 @@ var _ = Describe("Plugin", func() {
 				})
 			})
 
+			Context("when the current space cannot be retrieved", func() {
+				It("returns an error", func() {
+					cliConnection.GetCurrentSpaceCall.Returns.Error = errors.New("failed to get space")
+
+					_, err := p.FetchCLIDependencies(cliConnection, args)
+					Expect(err).To(MatchError("couldn't get current space: failed to get space"))
+				})
+			})
+
 			Context("when checking if ssl verification is disabled fails", func() {
 				It("returns an error", func() {
 					cliConnection.IsSSLDisabledCall.Returns.Error = errors.New("something failed")
@@ -152,6 +295,77 @@ var _ = Describe("Plugin", func() {
 		})
 	})
 
+	Describe("RunCommand", func() {
+		var (
+			p             *plugin.Plugin
+			cliConnection *mocks.CLIConnection
+			cfHome        string
+			previous      map[string]string
+		)
+
+		BeforeEach(func() {
+			p = plugin.NewPlugin()
+			cliConnection = &mocks.CLIConnection{}
+
+			var err error
+			cfHome, err = ioutil.TempDir("", "cf-home")
+			Expect(err).NotTo(HaveOccurred())
+			configDir := filepath.Join(cfHome, ".cf", "plugins", "autoscaling")
+			Expect(os.MkdirAll(configDir, 0700)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(configDir, "config.yml"), []byte("not: [valid"), 0600)).To(Succeed())
+
+			previous = map[string]string{}
+			for name, value := range map[string]string{"CF_HOME": cfHome, "AUTOSCALING_TARGET": "east"} {
+				previous[name] = os.Getenv(name)
+				os.Setenv(name, value)
+			}
+		})
+
+		AfterEach(func() {
+			for name, value := range previous {
+				os.Setenv(name, value)
+			}
+			os.RemoveAll(cfHome)
+		})
+
+		It("runs the offline commands without the config file or a target", func() {
+			for _, command := range []string{"simulate-autoscaling", "recommend-autoscaling"} {
+				err := p.RunCommand(cliConnection, []string{command})
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).NotTo(ContainSubstring("config"))
+				Expect(err.Error()).To(ContainSubstring("provide --"))
+			}
+		})
+
+		It("loads the config file for the commands that talk to cloud foundry", func() {
+			err := p.RunCommand(cliConnection, []string{"autoscaling-status", "app-name"})
+			Expect(err).To(MatchError(ContainSubstring("couldn't parse plugin config file")))
+		})
+	})
+
+	Describe("ParseConfigureFlags", func() {
+		It("only sets the flags that were given, including zeros", func() {
+			flags, args, err := plugin.ParseConfigureFlags([]string{"--min-instances", "0", "--max-threshold", "90", "app-name", "service-name"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(flags).To(Equal(plugin.Flags{
+				MinInstances:    intPtr(0),
+				CPUMaxThreshold: intPtr(90),
+			}))
+			Expect(args).To(Equal([]string{"app-name", "service-name"}))
+		})
+
+		It("parses --reset", func() {
+			flags, _, err := plugin.ParseConfigureFlags([]string{"--reset", "app-name", "service-name"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(flags.Reset).To(BeTrue())
+		})
+
+		It("returns an error for unknown flags", func() {
+			_, _, err := plugin.ParseConfigureFlags([]string{"--bananas", "app-name", "service-name"})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
 	Describe("RunWithError", func() {
 		var (
 			p            *plugin.Plugin
@@ -181,6 +395,7 @@ var _ = Describe("Plugin", func() {
 				"cpu_max_threshold": 80,
 				"enabled": false
 			}`
+			jsonClient.DoCalls[1].Returns.Headers = http.Header{"Etag": []string{`"some-version"`}}
 
 			dependencies = plugin.CLIDependencies{
 				AccessToken: "bearer some-token",
@@ -198,10 +413,10 @@ var _ = Describe("Plugin", func() {
 			}
 
 			flags = plugin.Flags{
-				MinInstances:    9,
-				MaxInstances:    30,
-				CPUMinThreshold: 10,
-				CPUMaxThreshold: 90,
+				MinInstances:    intPtr(9),
+				MaxInstances:    intPtr(30),
+				CPUMinThreshold: intPtr(10),
+				CPUMaxThreshold: intPtr(90),
 			}
 		})
 
@@ -219,6 +434,41 @@ var _ = Describe("Plugin", func() {
 			Expect(jsonClient.DoCalls[1].Receives.RequestData).To(BeNil())
 		})
 
+		Context("when the service binding's credentials give the autoscaling API URL", func() {
+			BeforeEach(func() {
+				jsonClient.DoCalls[0].ResponseJSON = `{
+					"resources": [
+						{
+							"metadata": {"guid": "some-service-binding-guid"},
+							"entity": {"credentials": {"api_url": "https://apps.example.com/autoscaler/"}}
+						}
+					]
+				}`
+			})
+
+			It("uses it instead of the dashboard's host", func() {
+				Expect(p.RunWithError(dependencies, flags)).To(Succeed())
+				Expect(jsonClient.DoCalls[1].Receives.URL).To(Equal("https://apps.example.com/autoscaler/api/bindings/some-service-binding-guid"))
+				Expect(jsonClient.DoCalls[2].Receives.URL).To(Equal("https://apps.example.com/autoscaler/api/bindings/some-service-binding-guid"))
+			})
+
+			It("is overridden by the dependencies' autoscaling API URL", func() {
+				dependencies.AutoscalerAPI = "https://router.example.com/autoscaling"
+
+				Expect(p.RunWithError(dependencies, flags)).To(Succeed())
+				Expect(jsonClient.DoCalls[1].Receives.URL).To(Equal("https://router.example.com/autoscaling/api/bindings/some-service-binding-guid"))
+			})
+		})
+
+		Context("when the autoscaling API URL is invalid", func() {
+			It("should return an error", func() {
+				dependencies.AutoscalerAPI = "autoscaler"
+
+				err := p.RunWithError(dependencies, flags)
+				Expect(err).To(MatchError("invalid autoscaling API URL: autoscaler"))
+			})
+		})
+
 		It("enables the autoscaling service binding", func() {
 			Expect(p.RunWithError(dependencies, flags)).To(Succeed())
 			Expect(jsonClient.DoCalls[2].Receives.Method).To(Equal("POST"))
@@ -233,6 +483,227 @@ var _ = Describe("Plugin", func() {
 			}))
 		})
 
+		Context("when the change is risky", func() {
+			BeforeEach(func() {
+				dependencies.App.RunningInstances = 40
+			})
+
+			It("fails without posting when nobody can confirm it", func() {
+				err := p.RunWithError(dependencies, flags)
+				Expect(err).To(MatchError("this change is risky:\n  - max instances (30) is below the 40 instances currently running\nre-run with -f to apply it anyway"))
+				Expect(jsonClient.DoCalls[2].Receives.Method).To(BeEmpty())
+			})
+
+			It("posts when forced", func() {
+				flags.Force = true
+
+				Expect(p.RunWithError(dependencies, flags)).To(Succeed())
+				Expect(jsonClient.DoCalls[2].Receives.Method).To(Equal("POST"))
+			})
+
+			It("posts when the user confirms it", func() {
+				out := &bytes.Buffer{}
+				dependencies.UI = plugin.UI{In: strings.NewReader("y\n"), Out: out, Interactive: true}
+
+				Expect(p.RunWithError(dependencies, flags)).To(Succeed())
+				Expect(out.String()).To(Equal("this change is risky:\n  - max instances (30) is below the 40 instances currently running\nApply these settings? [y/N]: "))
+				Expect(jsonClient.DoCalls[2].Receives.Method).To(Equal("POST"))
+			})
+
+			It("doesn't post when the user declines", func() {
+				dependencies.UI = plugin.UI{In: strings.NewReader("\n"), Out: &bytes.Buffer{}, Interactive: true}
+
+				err := p.RunWithError(dependencies, flags)
+				Expect(err).To(MatchError("cancelled, the settings weren't changed"))
+				Expect(jsonClient.DoCalls[2].Receives.Method).To(BeEmpty())
+			})
+		})
+
+		Context("when the app has more instances than the new limits allow", func() {
+			var out *bytes.Buffer
+
+			BeforeEach(func() {
+				jsonClient.DoCalls[3] = &mocks.DoCall{}
+				dependencies.App.InstanceCount = 40
+				dependencies.App.RunningInstances = 40
+				out = &bytes.Buffer{}
+				dependencies.UI = plugin.UI{Out: out}
+				flags.Force = true
+			})
+
+			It("says how the autoscaler will scale it", func() {
+				Expect(p.RunWithError(dependencies, flags)).To(Succeed())
+				Expect(out.String()).To(Equal("app-name will be scaled from 40 down to 30 instances\n"))
+				Expect(jsonClient.DoCalls[3].Receives.Method).To(BeEmpty())
+			})
+
+			It("scales the app straight away with --scale-now", func() {
+				flags.ScaleNow = true
+
+				Expect(p.RunWithError(dependencies, flags)).To(Succeed())
+				Expect(jsonClient.DoCalls[3].Receives.Method).To(Equal("PUT"))
+				Expect(jsonClient.DoCalls[3].Receives.URL).To(Equal("https://cloudcontroller.example.com/v2/apps/some-app-guid"))
+				Expect(jsonClient.DoCalls[3].Receives.RequestData).To(Equal(map[string]int{"instances": 30}))
+				Expect(out.String()).To(Equal("app-name scaled from 40 down to 30 instances\n"))
+			})
+
+			It("says the app won't be scaled when autoscaling is disabled", func() {
+				enabled := false
+				flags.Enabled = &enabled
+
+				Expect(p.RunWithError(dependencies, flags)).To(Succeed())
+				Expect(out.String()).To(Equal("app-name has 40 instances, outside the new limits, but won't be scaled as autoscaling is disabled\n"))
+			})
+
+			Context("when scaling the app fails", func() {
+				It("returns an error", func() {
+					flags.ScaleNow = true
+					jsonClient.DoCalls[3].Returns.Error = errors.New("some error")
+
+					err := p.RunWithError(dependencies, flags)
+					Expect(err).To(MatchError("the settings were applied but app-name couldn't be scaled to 30 instances: some error"))
+				})
+			})
+		})
+
+		Context("when the app has fewer instances than the new limits allow", func() {
+			It("says how the autoscaler will scale it", func() {
+				out := &bytes.Buffer{}
+				dependencies.UI = plugin.UI{Out: out}
+				dependencies.App.InstanceCount = 1
+
+				Expect(p.RunWithError(dependencies, flags)).To(Succeed())
+				Expect(out.String()).To(Equal("app-name will be scaled from 1 up to 9 instances\n"))
+			})
+		})
+
+		Context("when the app is within the new limits", func() {
+			It("says nothing", func() {
+				out := &bytes.Buffer{}
+				dependencies.UI = plugin.UI{Out: out}
+				dependencies.App.InstanceCount = 12
+
+				Expect(p.RunWithError(dependencies, flags)).To(Succeed())
+				Expect(out.String()).To(BeEmpty())
+			})
+		})
+
+		It("records the change in the journal", func() {
+			journal := &mocks.Journal{}
+			dependencies.Journal = journal
+			dependencies.SpaceName = "some-space"
+
+			Expect(p.RunWithError(dependencies, flags)).To(Succeed())
+			Expect(journal.RecordCall.Receives.Entries).To(Equal([]plugin.JournalEntry{{
+				Foundation:  "https://cloudcontroller.example.com",
+				SpaceName:   "some-space",
+				AppName:     "app-name",
+				AppGUID:     "some-app-guid",
+				ServiceName: "service-name",
+				ServiceGUID: "some-service-instance-guid",
+				Before: plugin.AutoscalingBinding{
+					MinInstances:    3,
+					MaxInstances:    7,
+					CPUMinThreshold: 20,
+					CPUMaxThreshold: 80,
+				},
+				After: plugin.AutoscalingBinding{
+					AppGuid:         "some-app-guid",
+					MinInstances:    9,
+					MaxInstances:    30,
+					CPUMinThreshold: 10,
+					CPUMaxThreshold: 90,
+					Enabled:         true,
+				},
+			}}))
+		})
+
+		Context("when the change can't be recorded", func() {
+			It("returns an error", func() {
+				journal := &mocks.Journal{}
+				journal.RecordCall.Returns.Error = errors.New("disk full")
+				dependencies.Journal = journal
+
+				err := p.RunWithError(dependencies, flags)
+				Expect(err).To(MatchError("the settings were applied but couldn't be recorded in the autoscaling history: disk full"))
+			})
+		})
+
+		It("only posts if the binding hasn't changed since it was fetched", func() {
+			Expect(p.RunWithError(dependencies, flags)).To(Succeed())
+			Expect(jsonClient.DoCalls[2].Receives.Headers).To(Equal(http.Header{"If-Match": []string{`"some-version"`}}))
+		})
+
+		Context("when the binding changed after it was fetched", func() {
+			BeforeEach(func() {
+				jsonClient = mocks.NewJSONClient(6)
+				jsonClient.DoCalls[0].ResponseJSON = `{"Resources": [{"Metadata": {"GUID": "some-service-binding-guid"}}]}`
+				jsonClient.DoCalls[1].ResponseJSON = `{"min_instances": 3, "max_instances": 7, "cpu_min_threshold": 20, "cpu_max_threshold": 80}`
+				jsonClient.DoCalls[1].Returns.Headers = http.Header{"Etag": []string{`"some-version"`}}
+				jsonClient.DoCalls[2].Returns.Error = plugin.UnexpectedResponseError{StatusCode: http.StatusPreconditionFailed, Status: "412 Precondition Failed"}
+				jsonClient.DoCalls[3].ResponseJSON = `{"min_instances": 3, "max_instances": 12, "cpu_min_threshold": 20, "cpu_max_threshold": 80}`
+				jsonClient.DoCalls[3].Returns.Headers = http.Header{"Etag": []string{`"some-other-version"`}}
+				dependencies.JSONClient = jsonClient
+			})
+
+			It("fails with the concurrent change", func() {
+				err := p.RunWithError(dependencies, flags)
+				Expect(err).To(MatchError(`the autoscaling binding for app-name to service-name was changed by someone else in the meantime:
+  max_instances: 7 -> 12
+re-run the command to apply your settings on top of theirs, or use --retry-on-conflict`))
+				Expect(jsonClient.DoCallCount).To(Equal(4))
+			})
+
+			Context("when retrying on conflict", func() {
+				It("applies the settings to the latest binding", func() {
+					flags.MinInstances = nil
+					flags.MaxInstances = nil
+					flags.RetryOnConflict = true
+					jsonClient.DoCalls[4].ResponseJSON = jsonClient.DoCalls[3].ResponseJSON
+					jsonClient.DoCalls[4].Returns.Headers = jsonClient.DoCalls[3].Returns.Headers
+
+					Expect(p.RunWithError(dependencies, flags)).To(Succeed())
+					Expect(jsonClient.DoCalls[4].Receives.Method).To(Equal("GET"))
+					Expect(jsonClient.DoCalls[5].Receives.Method).To(Equal("POST"))
+					Expect(jsonClient.DoCalls[5].Receives.Headers).To(Equal(http.Header{"If-Match": []string{`"some-other-version"`}}))
+					Expect(jsonClient.DoCalls[5].Receives.RequestData).To(Equal(&plugin.AutoscalingBinding{
+						AppGuid:         "some-app-guid",
+						MinInstances:    3,
+						MaxInstances:    12,
+						CPUMinThreshold: 10,
+						CPUMaxThreshold: 90,
+						Enabled:         true,
+					}))
+				})
+			})
+		})
+
+		Context("when the autoscaling API doesn't version bindings", func() {
+			BeforeEach(func() {
+				jsonClient = mocks.NewJSONClient(4)
+				jsonClient.DoCalls[0].ResponseJSON = `{"Resources": [{"Metadata": {"GUID": "some-service-binding-guid"}}]}`
+				jsonClient.DoCalls[1].ResponseJSON = `{"min_instances": 3, "max_instances": 7, "cpu_min_threshold": 20, "cpu_max_threshold": 80}`
+				jsonClient.DoCalls[2].ResponseJSON = `{"min_instances": 3, "max_instances": 7, "cpu_min_threshold": 20, "cpu_max_threshold": 80}`
+				dependencies.JSONClient = jsonClient
+			})
+
+			It("compares it with a fresh copy before posting", func() {
+				Expect(p.RunWithError(dependencies, flags)).To(Succeed())
+				Expect(jsonClient.DoCalls[2].Receives.Method).To(Equal("GET"))
+				Expect(jsonClient.DoCalls[2].Receives.URL).To(Equal("http://autoscaling.example.com/api/bindings/some-service-binding-guid"))
+				Expect(jsonClient.DoCalls[3].Receives.Method).To(Equal("POST"))
+				Expect(jsonClient.DoCalls[3].Receives.Headers).To(BeEmpty())
+			})
+
+			It("fails when the fresh copy differs", func() {
+				jsonClient.DoCalls[2].ResponseJSON = `{"min_instances": 1, "max_instances": 7, "cpu_min_threshold": 20, "cpu_max_threshold": 80}`
+
+				err := p.RunWithError(dependencies, flags)
+				Expect(err).To(MatchError(ContainSubstring("min_instances: 3 -> 1")))
+				Expect(jsonClient.DoCallCount).To(Equal(3))
+			})
+		})
+
 		Context("when no arguements are specified on the cli", func() {
 			BeforeEach(func() {
 				flags = plugin.Flags{}
@@ -254,8 +725,8 @@ var _ = Describe("Plugin", func() {
 
 			Context("when MinInstances > MaxInstances", func() {
 				It("should return an error", func() {
-					flags.MinInstances = 35
-					flags.MaxInstances = 34
+					flags.MinInstances = intPtr(35)
+					flags.MaxInstances = intPtr(34)
 
 					Expect(p.RunWithError(dependencies, flags)).To(MatchError("min instances must be <= max instances"))
 				})
@@ -263,14 +734,177 @@ var _ = Describe("Plugin", func() {
 
 			Context("when CPUMinThreshold > CPUMaxThreshold", func() {
 				It("should return an error", func() {
-					flags.CPUMinThreshold = 75
-					flags.CPUMaxThreshold = 24
+					flags.CPUMinThreshold = intPtr(75)
+					flags.CPUMaxThreshold = intPtr(24)
 
 					Expect(p.RunWithError(dependencies, flags)).To(MatchError("CPU min threshold must be <= CPU max threshold"))
 				})
 			})
 		})
 
+		Context("when settings are explicitly set to zero", func() {
+			It("applies them rather than ignoring them, so a CPU min threshold of zero is rejected", func() {
+				flags.CPUMinThreshold = intPtr(0)
+
+				Expect(p.RunWithError(dependencies, flags)).To(MatchError("CPU min threshold must be between 1 and 100"))
+				Expect(jsonClient.DoCalls[2].Receives.Method).To(BeEmpty())
+			})
+
+			It("rejects a min instance count of zero", func() {
+				flags.MinInstances = intPtr(0)
+
+				Expect(p.RunWithError(dependencies, flags)).To(MatchError("min instances must be >= 1"))
+			})
+		})
+
+		Context("when resetting the binding", func() {
+			It("restores the broker defaults before applying the other settings", func() {
+				flags = plugin.Flags{
+					MaxInstances: intPtr(8),
+					Reset:        true,
+				}
+
+				Expect(p.RunWithError(dependencies, flags)).To(Succeed())
+				Expect(jsonClient.DoCalls[2].Receives.RequestData).To(Equal(&plugin.AutoscalingBinding{
+					AppGuid:         "some-app-guid",
+					MinInstances:    2,
+					MaxInstances:    8,
+					CPUMinThreshold: 20,
+					CPUMaxThreshold: 80,
+					Enabled:         true,
+				}))
+			})
+		})
+
+		Context("when the app's space is known", func() {
+			BeforeEach(func() {
+				jsonClient = mocks.NewJSONClient(7)
+				jsonClient.DoCalls[0].ResponseJSON = `{"Resources": [{"Metadata": {"GUID": "some-service-binding-guid"}}]}`
+				jsonClient.DoCalls[1].ResponseJSON = `{"min_instances": 3, "max_instances": 7, "cpu_min_threshold": 20, "cpu_max_threshold": 80}`
+				jsonClient.DoCalls[1].Returns.Headers = http.Header{"Etag": []string{`"some-version"`}}
+				jsonClient.DoCalls[2].ResponseJSON = `{"entity": {"name": "some-space", "organization_guid": "some-org-guid", "space_quota_definition_guid": "some-space-quota-guid"}}`
+				jsonClient.DoCalls[3].ResponseJSON = `{"entity": {"name": "small", "app_instance_limit": 25}}`
+				jsonClient.DoCalls[4].ResponseJSON = `{"entity": {"name": "some-org", "quota_definition_guid": "some-quota-guid"}}`
+				jsonClient.DoCalls[5].ResponseJSON = `{"entity": {"name": "default", "app_instance_limit": -1}}`
+
+				dependencies.JSONClient = jsonClient
+				dependencies.App.SpaceGuid = "some-space-guid"
+			})
+
+			It("checks max instances against the space and org quotas", func() {
+				err := p.RunWithError(dependencies, flags)
+				Expect(err).To(MatchError("max instances (30) exceeds the app instance limit of 25 in space quota small of space some-space"))
+
+				Expect(jsonClient.DoCalls[2].Receives.URL).To(Equal("https://cloudcontroller.example.com/v2/spaces/some-space-guid"))
+				Expect(jsonClient.DoCalls[3].Receives.URL).To(Equal("https://cloudcontroller.example.com/v2/space_quota_definitions/some-space-quota-guid"))
+				Expect(jsonClient.DoCalls[4].Receives.URL).To(Equal("https://cloudcontroller.example.com/v2/organizations/some-org-guid"))
+				Expect(jsonClient.DoCalls[5].Receives.URL).To(Equal("https://cloudcontroller.example.com/v2/quota_definitions/some-quota-guid"))
+				Expect(jsonClient.DoCallCount).To(Equal(6))
+			})
+
+			It("posts the binding when it fits the quotas", func() {
+				flags.MaxInstances = intPtr(25)
+
+				Expect(p.RunWithError(dependencies, flags)).To(Succeed())
+				Expect(jsonClient.DoCalls[6].Receives.Method).To(Equal("POST"))
+			})
+
+			Context("when the space cannot be retrieved", func() {
+				It("returns an error", func() {
+					jsonClient.DoCalls[2].Returns.Error = errors.New("some error")
+
+					err := p.RunWithError(dependencies, flags)
+					Expect(err).To(MatchError("couldn't retrieve space: some error"))
+				})
+			})
+		})
+
+		Context("when guardrails are set", func() {
+			var guardrails *mocks.Guardrails
+
+			BeforeEach(func() {
+				guardrails = &mocks.Guardrails{}
+				dependencies.Guardrails = guardrails
+				dependencies.SpaceName = "some-space"
+
+				jsonClient.DoCalls[3] = jsonClient.DoCalls[2]
+				jsonClient.DoCalls[2] = &mocks.DoCall{ResponseJSON: `{"guid": "some-app-guid", "metadata": {"labels": {"scaling-exception": "true"}}}`}
+			})
+
+			It("evaluates them against the new settings and the app's labels", func() {
+				Expect(p.RunWithError(dependencies, flags)).To(Succeed())
+				Expect(jsonClient.DoCalls[2].Receives.URL).To(Equal("https://cloudcontroller.example.com/v3/apps/some-app-guid"))
+				Expect(guardrails.EvaluateCall.Receives.Subject).To(Equal(plugin.GuardrailSubject{
+					AppName:   "app-name",
+					SpaceName: "some-space",
+					Labels:    map[string]string{"scaling-exception": "true"},
+					Binding: plugin.AutoscalingBinding{
+						AppGuid:         "some-app-guid",
+						MinInstances:    9,
+						MaxInstances:    30,
+						CPUMinThreshold: 10,
+						CPUMaxThreshold: 90,
+						Enabled:         true,
+					},
+				}))
+				Expect(jsonClient.DoCalls[3].Receives.Method).To(Equal("POST"))
+			})
+
+			It("posts with a warning when a guardrail only warns", func() {
+				out := &bytes.Buffer{}
+				dependencies.UI = plugin.UI{Out: out}
+				guardrails.EvaluateCall.Returns.Violations = []plugin.GuardrailViolation{
+					{Rule: "max-instances", Message: "max_instances is 30, it must be at most 20"},
+				}
+
+				Expect(p.RunWithError(dependencies, flags)).To(Succeed())
+				Expect(out.String()).To(Equal("Warning: guardrail max-instances: max_instances is 30, it must be at most 20\n"))
+				Expect(jsonClient.DoCalls[3].Receives.Method).To(Equal("POST"))
+			})
+
+			It("doesn't post when a guardrail rejects the change, even when forced", func() {
+				flags.Force = true
+				guardrails.EvaluateCall.Returns.Violations = []plugin.GuardrailViolation{
+					{Rule: "prod-min-instances", Message: "prod apps need at least 10 instances", Reject: true},
+				}
+
+				err := p.RunWithError(dependencies, flags)
+				Expect(err).To(MatchError("this change breaks guardrails:\n  - prod-min-instances: prod apps need at least 10 instances"))
+				Expect(jsonClient.DoCalls[3].Receives.Method).To(BeEmpty())
+			})
+
+			Context("when the app's labels can't be retrieved", func() {
+				It("returns an error", func() {
+					jsonClient.DoCalls[2].Returns.Error = errors.New("some error")
+
+					err := p.RunWithError(dependencies, flags)
+					Expect(err).To(MatchError("couldn't get the labels of app-name: some error"))
+				})
+			})
+		})
+
+		Context("when a guardrails file is given", func() {
+			It("fails if it can't be loaded", func() {
+				flags.GuardrailsFile = "/does/not/exist.yml"
+
+				err := p.RunWithError(dependencies, flags)
+				Expect(err).To(MatchError(ContainSubstring("couldn't read guardrails file")))
+				Expect(jsonClient.DoCallCount).To(Equal(1))
+			})
+		})
+
+		Context("when the new settings are invalid", func() {
+			It("returns every violation", func() {
+				flags.MaxInstances = intPtr(5)
+				flags.CPUMaxThreshold = intPtr(500)
+
+				err := p.RunWithError(dependencies, flags)
+				Expect(err).To(MatchError(ContainSubstring("min instances must be <= max instances")))
+				Expect(err).To(MatchError(ContainSubstring("CPU max threshold must be between 1 and 100")))
+				Expect(jsonClient.DoCallCount).To(Equal(2))
+			})
+		})
+
 		Context("error cases", func() {
 			Context("when we can't construct a url to query cloud controller", func() {
 				It("should return the error", func() {
@@ -0,0 +1,79 @@
+package plugin
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Policy is the file representation of an AutoscalingBinding, e.g.
+//
+//	min_instances: 2
+//	max_instances: 10
+//	cpu_min_threshold: 20
+//	cpu_max_threshold: 80
+type Policy struct {
+	MinInstances    int   `yaml:"min_instances"`
+	MaxInstances    int   `yaml:"max_instances"`
+	CPUMinThreshold int   `yaml:"cpu_min_threshold"`
+	CPUMaxThreshold int   `yaml:"cpu_max_threshold"`
+	Enabled         *bool `yaml:"enabled,omitempty"`
+}
+
+func LoadPolicy(path string) (Policy, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Policy{}, fmt.Errorf("couldn't read policy file: %s", err)
+	}
+
+	var policy Policy
+	if err := yaml.UnmarshalStrict(contents, &policy); err != nil {
+		return Policy{}, fmt.Errorf("couldn't parse policy file %s: %s", path, err)
+	}
+
+	return policy, nil
+}
+
+// PolicyFor returns the policy describing binding.
+func PolicyFor(binding AutoscalingBinding) Policy {
+	enabled := binding.Enabled
+
+	return Policy{
+		MinInstances:    binding.MinInstances,
+		MaxInstances:    binding.MaxInstances,
+		CPUMinThreshold: binding.CPUMinThreshold,
+		CPUMaxThreshold: binding.CPUMaxThreshold,
+		Enabled:         &enabled,
+	}
+}
+
+func SavePolicy(path string, policy Policy) error {
+	contents, err := yaml.Marshal(policy)
+	if err != nil {
+		return err // not tested
+	}
+
+	if err := ioutil.WriteFile(path, contents, 0644); err != nil {
+		return fmt.Errorf("couldn't write policy file: %s", err)
+	}
+
+	return nil
+}
+
+// Binding returns the binding the policy describes. Policies are enabled
+// unless they say otherwise.
+func (p Policy) Binding() AutoscalingBinding {
+	enabled := true
+	if p.Enabled != nil {
+		enabled = *p.Enabled
+	}
+
+	return AutoscalingBinding{
+		MinInstances:    p.MinInstances,
+		MaxInstances:    p.MaxInstances,
+		CPUMinThreshold: p.CPUMinThreshold,
+		CPUMaxThreshold: p.CPUMaxThreshold,
+		Enabled:         enabled,
+	}
+}
@@ -0,0 +1,72 @@
+package plugin_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/phopper-pivotal/autoscaling-cli-plugin/plugin"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Policy", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "policy")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	writePolicy := func(contents string) string {
+		path := filepath.Join(dir, "policy.yml")
+		Expect(ioutil.WriteFile(path, []byte(contents), 0600)).To(Succeed())
+		return path
+	}
+
+	Describe("LoadPolicy", func() {
+		It("loads the limits and thresholds", func() {
+			path := writePolicy("min_instances: 2\nmax_instances: 10\ncpu_min_threshold: 20\ncpu_max_threshold: 80\n")
+
+			policy, err := plugin.LoadPolicy(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(policy.Binding()).To(Equal(plugin.AutoscalingBinding{
+				MinInstances:    2,
+				MaxInstances:    10,
+				CPUMinThreshold: 20,
+				CPUMaxThreshold: 80,
+				Enabled:         true,
+			}))
+		})
+
+		It("respects an explicitly disabled policy", func() {
+			path := writePolicy("min_instances: 2\nmax_instances: 10\nenabled: false\n")
+
+			policy, err := plugin.LoadPolicy(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(policy.Binding().Enabled).To(BeFalse())
+		})
+
+		Context("when the file contains unknown fields", func() {
+			It("returns an error", func() {
+				path := writePolicy("min_instance: 2\n")
+
+				_, err := plugin.LoadPolicy(path)
+				Expect(err).To(MatchError(ContainSubstring("couldn't parse policy file " + path)))
+			})
+		})
+
+		Context("when the file doesn't exist", func() {
+			It("returns an error", func() {
+				_, err := plugin.LoadPolicy(filepath.Join(dir, "missing.yml"))
+				Expect(err).To(MatchError(ContainSubstring("couldn't read policy file")))
+			})
+		})
+	})
+})
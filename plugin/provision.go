@@ -0,0 +1,359 @@
+package plugin
+
+import (
+	"code.cloudfoundry.org/cli/plugin/models"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	lastOperationInProgress = "in progress"
+	lastOperationFailed     = "failed"
+)
+
+// ccResource holds the parts of cloud controller service instances, bindings,
+// offerings and plans that provisioning needs.
+type ccResource struct {
+	Metadata struct {
+		GUID string `json:"guid"`
+	} `json:"metadata"`
+	Entity struct {
+		Name                string `json:"name"`
+		DashboardURL        string `json:"dashboard_url"`
+		ServiceInstanceGUID string `json:"service_instance_guid"`
+		ServicePlanGUID     string `json:"service_plan_guid"`
+		ServiceGUID         string `json:"service_guid"`
+		Label               string `json:"label"`
+
+		// Credentials are a service binding's
+		Credentials map[string]interface{} `json:"credentials"`
+
+		LastOperation struct {
+			Type        string `json:"type"`
+			State       string `json:"state"`
+			Description string `json:"description"`
+		} `json:"last_operation"`
+	} `json:"entity"`
+}
+
+type ccResources struct {
+	NextURL   string       `json:"next_url"`
+	Resources []ccResource `json:"resources"`
+}
+
+// ServiceProvisioner creates the autoscaler service instance and binds it to
+// the app where that hasn't been done yet, waiting for the broker to finish.
+type ServiceProvisioner struct {
+	PollInterval time.Duration
+	Timeout      time.Duration
+	Sleep        func(time.Duration)
+}
+
+func NewServiceProvisioner() ServiceProvisioner {
+	return ServiceProvisioner{
+		PollInterval: 5 * time.Second,
+		Timeout:      10 * time.Minute,
+		Sleep:        time.Sleep,
+	}
+}
+
+// EnsureBound makes sure a service instance named dependencies.ServiceName
+// exists in the app's space and is bound to the app, creating it with plan
+// if it doesn't. An existing instance must be of one of the autoscaler
+// service offerings, and plan isn't needed for it. Running it again once
+// everything exists changes nothing.
+func (s ServiceProvisioner) EnsureBound(dependencies CLIDependencies, plan string) (plugin_models.GetService_Model, error) {
+	if dependencies.App.SpaceGuid == "" {
+		return plugin_models.GetService_Model{}, fmt.Errorf("couldn't find the space of app %s", dependencies.AppName)
+	}
+
+	instance, offering, err := s.ensureInstance(dependencies, plan)
+	if err != nil {
+		return plugin_models.GetService_Model{}, err
+	}
+
+	err = s.ensureBinding(dependencies, instance.Metadata.GUID)
+	if err != nil {
+		return plugin_models.GetService_Model{}, err
+	}
+
+	service := plugin_models.GetService_Model{
+		Guid:         instance.Metadata.GUID,
+		Name:         instance.Entity.Name,
+		DashboardUrl: instance.Entity.DashboardURL,
+	}
+	service.ServiceOffering.Name = offering
+
+	return service, nil
+}
+
+// ensureInstance returns the service instance, creating it if need be, along
+// with the label of its service offering.
+func (s ServiceProvisioner) ensureInstance(dependencies CLIDependencies, plan string) (ccResource, string, error) {
+	serviceName := dependencies.ServiceName
+
+	instancesURL, err := getCCURL(dependencies.APIEndpoint, fmt.Sprintf("/v2/spaces/%s/service_instances", dependencies.App.SpaceGuid), url.Values{
+		"q": []string{fmt.Sprintf("name:%s", serviceName)},
+	})
+	if err != nil {
+		return ccResource{}, "", err
+	}
+
+	var instances ccResources
+	err = dependencies.JSONClient.Do("GET", instancesURL, nil, &instances)
+	if err != nil {
+		return ccResource{}, "", fmt.Errorf("couldn't look up service instance %s: %s", serviceName, err)
+	}
+
+	description := fmt.Sprintf("creating service instance %s", serviceName)
+
+	if len(instances.Resources) > 0 {
+		instance := instances.Resources[0]
+
+		offering, err := serviceOfferingLabel(dependencies, instance.Entity.ServicePlanGUID)
+		if err != nil {
+			return ccResource{}, "", err
+		}
+
+		if !isAutoscalerServiceOffering(offering) {
+			return ccResource{}, "", fmt.Errorf("service instance %s is a %s service instance, not %s", serviceName, offering, strings.Join(autoscalerServiceOfferings(), " or "))
+		}
+
+		// a previous run may have left it being created
+		if instance.Entity.LastOperation.Type != "create" {
+			return instance, offering, nil
+		}
+
+		instance, err = s.waitFor(dependencies, description, fmt.Sprintf("/v2/service_instances/%s", instance.Metadata.GUID), instance)
+		return instance, offering, err
+	}
+
+	if plan == "" {
+		return ccResource{}, "", fmt.Errorf("service instance %s doesn't exist, provide --plan to create it", serviceName)
+	}
+
+	offeringPlan, err := findServicePlan(dependencies, plan)
+	if err != nil {
+		return ccResource{}, "", err
+	}
+
+	createURL, err := getCCURL(dependencies.APIEndpoint, "/v2/service_instances", url.Values{"accepts_incomplete": []string{"true"}})
+	if err != nil {
+		return ccResource{}, "", err
+	}
+
+	request := struct {
+		Name            string `json:"name"`
+		SpaceGUID       string `json:"space_guid"`
+		ServicePlanGUID string `json:"service_plan_guid"`
+	}{serviceName, dependencies.App.SpaceGuid, offeringPlan.GUID}
+
+	dependencies.UI.Say("Creating service instance %s (%s, plan %s)...", serviceName, offeringPlan.Offering, plan)
+
+	var instance ccResource
+	err = dependencies.JSONClient.Do("POST", createURL, &request, &instance)
+	if err != nil {
+		return ccResource{}, "", fmt.Errorf("couldn't create service instance %s: %s", serviceName, err)
+	}
+
+	instance, err = s.waitFor(dependencies, description, fmt.Sprintf("/v2/service_instances/%s", instance.Metadata.GUID), instance)
+	return instance, offeringPlan.Offering, err
+}
+
+func (s ServiceProvisioner) ensureBinding(dependencies CLIDependencies, serviceInstanceGUID string) error {
+	bindingsURL, err := getCCQueryURL(dependencies.APIEndpoint, dependencies.App.Guid, serviceInstanceGUID)
+	if err != nil {
+		return err
+	}
+
+	var bindings ccResources
+	err = dependencies.JSONClient.Do("GET", bindingsURL, nil, &bindings)
+	if err != nil {
+		return fmt.Errorf("couldn't retrieve service binding: %s", err)
+	}
+
+	description := fmt.Sprintf("binding %s to %s", dependencies.ServiceName, dependencies.AppName)
+
+	if len(bindings.Resources) > 0 {
+		binding := bindings.Resources[0]
+		_, err := s.waitFor(dependencies, description, fmt.Sprintf("/v2/service_bindings/%s", binding.Metadata.GUID), binding)
+		return err
+	}
+
+	bindURL, err := getCCURL(dependencies.APIEndpoint, "/v2/service_bindings", url.Values{"accepts_incomplete": []string{"true"}})
+	if err != nil {
+		return err
+	}
+
+	request := struct {
+		AppGUID             string `json:"app_guid"`
+		ServiceInstanceGUID string `json:"service_instance_guid"`
+	}{dependencies.App.Guid, serviceInstanceGUID}
+
+	dependencies.UI.Say("Binding %s to %s...", dependencies.ServiceName, dependencies.AppName)
+
+	var binding ccResource
+	err = dependencies.JSONClient.Do("POST", bindURL, &request, &binding)
+	if err != nil {
+		return fmt.Errorf("couldn't bind %s to %s: %s", dependencies.ServiceName, dependencies.AppName, err)
+	}
+
+	_, err = s.waitFor(dependencies, description, fmt.Sprintf("/v2/service_bindings/%s", binding.Metadata.GUID), binding)
+	return err
+}
+
+// waitFor polls the resource at path until the broker has finished with it.
+func (s ServiceProvisioner) waitFor(dependencies CLIDependencies, description, path string, resource ccResource) (ccResource, error) {
+	var waited time.Duration
+	for resource.Entity.LastOperation.State == lastOperationInProgress {
+		if waited >= s.Timeout {
+			return ccResource{}, fmt.Errorf("timed out after %s %s", s.Timeout, description)
+		}
+
+		s.Sleep(s.PollInterval)
+		waited += s.PollInterval
+
+		resource = ccResource{}
+		err := getCCResource(dependencies, path, &resource)
+		if err != nil {
+			return ccResource{}, fmt.Errorf("%s: %s", description, err)
+		}
+	}
+
+	if resource.Entity.LastOperation.State == lastOperationFailed {
+		return ccResource{}, fmt.Errorf("%s failed: %s", description, resource.Entity.LastOperation.Description)
+	}
+
+	return resource, nil
+}
+
+// waitForDeletion polls the resource at path until the broker has finished
+// deleting it, which cloud controller shows by no longer finding it.
+func (s ServiceProvisioner) waitForDeletion(dependencies CLIDependencies, description, path string, resource ccResource) error {
+	var waited time.Duration
+	for resource.Entity.LastOperation.State == lastOperationInProgress {
+		if waited >= s.Timeout {
+			return fmt.Errorf("timed out after %s %s", s.Timeout, description)
+		}
+
+		s.Sleep(s.PollInterval)
+		waited += s.PollInterval
+
+		resource = ccResource{}
+		err := getCCResource(dependencies, path, &resource)
+		if responseErr, ok := err.(UnexpectedResponseError); ok && responseErr.StatusCode == http.StatusNotFound {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %s", description, err)
+		}
+	}
+
+	if resource.Entity.LastOperation.State == lastOperationFailed {
+		return fmt.Errorf("%s failed: %s", description, resource.Entity.LastOperation.Description)
+	}
+
+	return nil
+}
+
+// findOfferingPlans returns the plans of the service offering labelled
+// offering, if it's in the marketplace.
+func findOfferingPlans(dependencies CLIDependencies, offering string) ([]ccResource, bool, error) {
+	servicesURL, err := getCCURL(dependencies.APIEndpoint, "/v2/services", url.Values{
+		"q": []string{fmt.Sprintf("label:%s", offering)},
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	var services ccResources
+	err = dependencies.JSONClient.Do("GET", servicesURL, nil, &services)
+	if err != nil {
+		return nil, false, fmt.Errorf("couldn't look up the %s service offering: %s", offering, err)
+	}
+
+	if len(services.Resources) == 0 {
+		return nil, false, nil
+	}
+
+	var plans ccResources
+	err = getCCResource(dependencies, fmt.Sprintf("/v2/services/%s/service_plans", services.Resources[0].Metadata.GUID), &plans)
+	if err != nil {
+		return nil, false, fmt.Errorf("couldn't look up the plans of the %s service offering: %s", offering, err)
+	}
+
+	return plans.Resources, true, nil
+}
+
+// servicePlan is a plan of one of the autoscaler service offerings.
+type servicePlan struct {
+	GUID     string
+	Name     string
+	Offering string
+}
+
+// findAutoscalerPlans returns the plans of the service offerings of every
+// backend that's in the marketplace.
+func findAutoscalerPlans(dependencies CLIDependencies) ([]servicePlan, error) {
+	var plans []servicePlan
+	offerings := autoscalerServiceOfferings()
+	for _, offering := range offerings {
+		offeringPlans, _, err := findOfferingPlans(dependencies, offering)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, plan := range offeringPlans {
+			plans = append(plans, servicePlan{GUID: plan.Metadata.GUID, Name: plan.Entity.Name, Offering: offering})
+		}
+	}
+
+	if len(plans) == 0 {
+		return nil, fmt.Errorf("couldn't find the %s service offerings in the marketplace", strings.Join(offerings, " or "))
+	}
+
+	return plans, nil
+}
+
+// findServicePlan returns the plan with the given name of the autoscaler
+// service offerings in the marketplace, preferring the offering listed first
+// by autoscalerServiceOfferings when both have it.
+func findServicePlan(dependencies CLIDependencies, plan string) (servicePlan, error) {
+	plans, err := findAutoscalerPlans(dependencies)
+	if err != nil {
+		return servicePlan{}, err
+	}
+
+	var names []string
+	for _, candidate := range plans {
+		if candidate.Name == plan {
+			return candidate, nil
+		}
+
+		names = append(names, candidate.Name)
+	}
+
+	return servicePlan{}, fmt.Errorf("the %s service offerings have no plan named %s, choose one of: %s", strings.Join(autoscalerServiceOfferings(), " or "), plan, strings.Join(names, ", "))
+}
+
+func (p *Plugin) runCreateIfMissing(cliConnection cliConnection, flags Flags, args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("provide APP_NAME and SERVICE_INSTANCE on command line to create the service instance")
+	}
+
+	dependencies, err := p.fetchAppDependencies(cliConnection, args[0])
+	if err != nil {
+		return err
+	}
+	dependencies.ServiceName = args[1]
+
+	dependencies.Service, err = p.Provisioner.EnsureBound(dependencies, flags.Plan)
+	if err != nil {
+		return err
+	}
+
+	return p.RunWithError(dependencies, flags)
+}
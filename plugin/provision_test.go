@@ -0,0 +1,238 @@
+package plugin_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+
+	"code.cloudfoundry.org/cli/plugin/models"
+	"github.com/phopper-pivotal/autoscaling-cli-plugin/mocks"
+	"github.com/phopper-pivotal/autoscaling-cli-plugin/plugin"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ServiceProvisioner", func() {
+	var (
+		provisioner  plugin.ServiceProvisioner
+		sleeps       []time.Duration
+		jsonClient   *mocks.JSONClient
+		dependencies plugin.CLIDependencies
+		out          *bytes.Buffer
+	)
+
+	BeforeEach(func() {
+		sleeps = nil
+		provisioner = plugin.ServiceProvisioner{
+			PollInterval: time.Second,
+			Timeout:      time.Minute,
+			Sleep: func(d time.Duration) {
+				sleeps = append(sleeps, d)
+			},
+		}
+
+		out = &bytes.Buffer{}
+		dependencies = plugin.CLIDependencies{
+			AppName:     "app-name",
+			ServiceName: "service-name",
+			APIEndpoint: "https://cloudcontroller.example.com",
+			App: plugin_models.GetAppModel{
+				Guid:      "some-app-guid",
+				SpaceGuid: "some-space-guid",
+			},
+			UI: plugin.UI{Out: out},
+		}
+	})
+
+	Context("when the service instance doesn't exist", func() {
+		BeforeEach(func() {
+			jsonClient = mocks.NewJSONClient(9)
+			jsonClient.DoCalls[0].ResponseJSON = `{"resources": []}`
+			jsonClient.DoCalls[1].ResponseJSON = `{"resources": [{"metadata": {"guid": "some-service-guid"}}]}`
+			jsonClient.DoCalls[2].ResponseJSON = `{"resources": [
+				{"metadata": {"guid": "small-plan-guid"}, "entity": {"name": "small"}},
+				{"metadata": {"guid": "standard-plan-guid"}, "entity": {"name": "standard"}}
+			]}`
+			jsonClient.DoCalls[3].ResponseJSON = `{"resources": []}`
+			jsonClient.DoCalls[4].ResponseJSON = `{
+				"metadata": {"guid": "some-service-instance-guid"},
+				"entity": {"name": "service-name", "last_operation": {"type": "create", "state": "in progress"}}
+			}`
+			jsonClient.DoCalls[5].ResponseJSON = jsonClient.DoCalls[4].ResponseJSON
+			jsonClient.DoCalls[6].ResponseJSON = `{
+				"metadata": {"guid": "some-service-instance-guid"},
+				"entity": {
+					"name": "service-name",
+					"dashboard_url": "http://autoscaling.example.com/dashboard",
+					"last_operation": {"type": "create", "state": "succeeded"}
+				}
+			}`
+			jsonClient.DoCalls[7].ResponseJSON = `{"resources": []}`
+			jsonClient.DoCalls[8].ResponseJSON = `{"metadata": {"guid": "some-binding-guid"}}`
+			dependencies.JSONClient = jsonClient
+		})
+
+		It("creates it, waits for the broker and binds it to the app", func() {
+			service, err := provisioner.EnsureBound(dependencies, "standard")
+			Expect(err).NotTo(HaveOccurred())
+			expected := plugin_models.GetService_Model{
+				Guid:         "some-service-instance-guid",
+				Name:         "service-name",
+				DashboardUrl: "http://autoscaling.example.com/dashboard",
+			}
+			expected.ServiceOffering.Name = "app-autoscaler"
+			Expect(service).To(Equal(expected))
+
+			Expect(jsonClient.DoCalls[0].Receives.URL).To(Equal("https://cloudcontroller.example.com/v2/spaces/some-space-guid/service_instances?q=name%3Aservice-name"))
+			Expect(jsonClient.DoCalls[1].Receives.URL).To(Equal("https://cloudcontroller.example.com/v2/services?q=label%3Aapp-autoscaler"))
+			Expect(jsonClient.DoCalls[2].Receives.URL).To(Equal("https://cloudcontroller.example.com/v2/services/some-service-guid/service_plans"))
+			Expect(jsonClient.DoCalls[3].Receives.URL).To(Equal("https://cloudcontroller.example.com/v2/services?q=label%3Aautoscaler"))
+
+			Expect(jsonClient.DoCalls[4].Receives.Method).To(Equal("POST"))
+			Expect(jsonClient.DoCalls[4].Receives.URL).To(Equal("https://cloudcontroller.example.com/v2/service_instances?accepts_incomplete=true"))
+			Expect(json.Marshal(jsonClient.DoCalls[4].Receives.RequestData)).To(MatchJSON(`{
+				"name": "service-name",
+				"space_guid": "some-space-guid",
+				"service_plan_guid": "standard-plan-guid"
+			}`))
+
+			Expect(jsonClient.DoCalls[5].Receives.URL).To(Equal("https://cloudcontroller.example.com/v2/service_instances/some-service-instance-guid"))
+			Expect(jsonClient.DoCalls[6].Receives.URL).To(Equal("https://cloudcontroller.example.com/v2/service_instances/some-service-instance-guid"))
+			Expect(sleeps).To(Equal([]time.Duration{time.Second, time.Second}))
+
+			Expect(jsonClient.DoCalls[7].Receives.URL).To(Equal("https://cloudcontroller.example.com/v2/service_bindings?q=app_guid%3Asome-app-guid&q=service_instance_guid%3Asome-service-instance-guid"))
+			Expect(jsonClient.DoCalls[8].Receives.Method).To(Equal("POST"))
+			Expect(jsonClient.DoCalls[8].Receives.URL).To(Equal("https://cloudcontroller.example.com/v2/service_bindings?accepts_incomplete=true"))
+			Expect(json.Marshal(jsonClient.DoCalls[8].Receives.RequestData)).To(MatchJSON(`{
+				"app_guid": "some-app-guid",
+				"service_instance_guid": "some-service-instance-guid"
+			}`))
+
+			Expect(out.String()).To(Equal("Creating service instance service-name (app-autoscaler, plan standard)...\nBinding service-name to app-name...\n"))
+		})
+
+		It("fails when no plan is given", func() {
+			_, err := provisioner.EnsureBound(dependencies, "")
+			Expect(err).To(MatchError("service instance service-name doesn't exist, provide --plan to create it"))
+			Expect(jsonClient.DoCallCount).To(Equal(1))
+		})
+
+		It("fails when the plan doesn't exist", func() {
+			_, err := provisioner.EnsureBound(dependencies, "huge")
+			Expect(err).To(MatchError("the app-autoscaler or autoscaler service offerings have no plan named huge, choose one of: small, standard"))
+			Expect(jsonClient.DoCalls[4].Receives.Method).To(BeEmpty())
+		})
+
+		It("fails when the offering isn't in the marketplace", func() {
+			jsonClient.DoCalls[1].ResponseJSON = `{"resources": []}`
+
+			_, err := provisioner.EnsureBound(dependencies, "standard")
+			Expect(err).To(MatchError("couldn't find the app-autoscaler or autoscaler service offerings in the marketplace"))
+		})
+
+		It("creates it from the App Autoscaler offering when that's the only one in the marketplace", func() {
+			jsonClient.DoCalls[1].ResponseJSON = `{"resources": []}`
+			jsonClient.DoCalls[2].ResponseJSON = `{"resources": [{"metadata": {"guid": "app-autoscaler-guid"}}]}`
+			jsonClient.DoCalls[3].ResponseJSON = `{"resources": [{"metadata": {"guid": "autoscaler-standard-plan-guid"}, "entity": {"name": "standard"}}]}`
+
+			service, err := provisioner.EnsureBound(dependencies, "standard")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(service.ServiceOffering.Name).To(Equal("autoscaler"))
+			Expect(jsonClient.DoCalls[2].Receives.URL).To(Equal("https://cloudcontroller.example.com/v2/services?q=label%3Aautoscaler"))
+			Expect(json.Marshal(jsonClient.DoCalls[4].Receives.RequestData)).To(MatchJSON(`{
+				"name": "service-name",
+				"space_guid": "some-space-guid",
+				"service_plan_guid": "autoscaler-standard-plan-guid"
+			}`))
+			Expect(out.String()).To(HavePrefix("Creating service instance service-name (autoscaler, plan standard)...\n"))
+		})
+
+		It("fails when the broker fails to create it", func() {
+			jsonClient.DoCalls[6].ResponseJSON = `{"entity": {"last_operation": {"type": "create", "state": "failed", "description": "out of capacity"}}}`
+
+			_, err := provisioner.EnsureBound(dependencies, "standard")
+			Expect(err).To(MatchError("creating service instance service-name failed: out of capacity"))
+		})
+
+		It("gives up when the broker takes too long", func() {
+			provisioner.Timeout = time.Second
+
+			_, err := provisioner.EnsureBound(dependencies, "standard")
+			Expect(err).To(MatchError("timed out after 1s creating service instance service-name"))
+			Expect(sleeps).To(HaveLen(1))
+		})
+	})
+
+	Context("when the service instance exists and is bound", func() {
+		BeforeEach(func() {
+			jsonClient = mocks.NewJSONClient(4)
+			jsonClient.DoCalls[0].ResponseJSON = `{"resources": [{
+				"metadata": {"guid": "some-service-instance-guid"},
+				"entity": {
+					"name": "service-name",
+					"dashboard_url": "http://autoscaling.example.com/dashboard",
+					"service_plan_guid": "some-plan-guid",
+					"last_operation": {"type": "create", "state": "succeeded"}
+				}
+			}]}`
+			jsonClient.DoCalls[1].ResponseJSON = `{"entity": {"service_guid": "some-service-guid"}}`
+			jsonClient.DoCalls[2].ResponseJSON = `{"entity": {"label": "app-autoscaler"}}`
+			jsonClient.DoCalls[3].ResponseJSON = `{"resources": [{"metadata": {"guid": "some-binding-guid"}}]}`
+			dependencies.JSONClient = jsonClient
+		})
+
+		It("changes nothing, without needing a plan", func() {
+			service, err := provisioner.EnsureBound(dependencies, "")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(service.Guid).To(Equal("some-service-instance-guid"))
+			Expect(service.ServiceOffering.Name).To(Equal("app-autoscaler"))
+			Expect(jsonClient.DoCallCount).To(Equal(4))
+			Expect(jsonClient.DoCalls[1].Receives.URL).To(Equal("https://cloudcontroller.example.com/v2/service_plans/some-plan-guid"))
+			Expect(jsonClient.DoCalls[2].Receives.URL).To(Equal("https://cloudcontroller.example.com/v2/services/some-service-guid"))
+			Expect(out.String()).To(BeEmpty())
+		})
+
+		It("fails when it isn't an autoscaler service instance", func() {
+			jsonClient.DoCalls[2].ResponseJSON = `{"entity": {"label": "p-mysql"}}`
+
+			_, err := provisioner.EnsureBound(dependencies, "")
+			Expect(err).To(MatchError("service instance service-name is a p-mysql service instance, not app-autoscaler or autoscaler"))
+			Expect(jsonClient.DoCallCount).To(Equal(3))
+		})
+
+		Context("when it's an App Autoscaler service instance", func() {
+			It("configures it through the App Autoscaler", func() {
+				jsonClient.DoCalls[2].ResponseJSON = `{"entity": {"label": "autoscaler"}}`
+				for i := 4; i < 7; i++ {
+					jsonClient.DoCalls[i] = &mocks.DoCall{}
+				}
+				jsonClient.DoCalls[4].ResponseJSON = `{"resources": [{"metadata": {"guid": "some-binding-guid"}}]}`
+				jsonClient.DoCalls[5].ResponseJSON = `{"instance_min_count": 1, "instance_max_count": 4, "scaling_rules": [
+					{"metric_type": "cpu", "threshold": 20, "operator": "<", "adjustment": "-1"},
+					{"metric_type": "cpu", "threshold": 80, "operator": ">=", "adjustment": "+1"}
+				]}`
+				jsonClient.DoCalls[5].Returns.Headers = map[string][]string{"Etag": {`"some-version"`}}
+
+				var err error
+				dependencies.APIEndpoint = "https://api.sys.example.com"
+				dependencies.Service, err = provisioner.EnsureBound(dependencies, "standard")
+				Expect(err).NotTo(HaveOccurred())
+
+				// leave out the space's quotas
+				dependencies.App.SpaceGuid = ""
+				Expect(plugin.NewPlugin().RunWithError(dependencies, plugin.Flags{MaxInstances: intPtr(6), Force: true})).To(Succeed())
+
+				Expect(jsonClient.DoCalls[5].Receives.URL).To(Equal("https://autoscaler.sys.example.com/v1/apps/some-app-guid/policy"))
+				Expect(jsonClient.DoCalls[6].Receives.Method).To(Equal("PUT"))
+			})
+		})
+	})
+
+	It("fails when the app's space isn't known", func() {
+		dependencies.App.SpaceGuid = ""
+
+		_, err := provisioner.EnsureBound(dependencies, "standard")
+		Expect(err).To(MatchError("couldn't find the space of app app-name"))
+	})
+})
@@ -0,0 +1,43 @@
+package plugin
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// ProxyOptions is the proxy from the plugin config file, for when the
+// standard HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables aren't
+// set, e.g.
+//
+//	url: http://proxy.example.com:3128
+//	no_proxy: .internal.example.com,10.0.0.0/8
+type ProxyOptions struct {
+	URL     string `yaml:"url,omitempty"`
+	NoProxy string `yaml:"no_proxy,omitempty"`
+}
+
+// ProxyFunc returns the proxy to use for each request, as http.Transport
+// expects it.
+func (o ProxyOptions) ProxyFunc() (func(*http.Request) (*url.URL, error), error) {
+	config := httpproxy.FromEnvironment()
+
+	if config.HTTPProxy == "" && config.HTTPSProxy == "" && o.URL != "" {
+		if _, err := url.Parse(o.URL); err != nil {
+			return nil, fmt.Errorf("invalid proxy url in plugin config file: %s", err)
+		}
+
+		config.HTTPProxy, config.HTTPSProxy = o.URL, o.URL
+	}
+
+	if config.NoProxy == "" {
+		config.NoProxy = o.NoProxy
+	}
+
+	proxy := config.ProxyFunc()
+	return func(request *http.Request) (*url.URL, error) {
+		return proxy(request.URL)
+	}, nil
+}
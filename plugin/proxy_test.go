@@ -0,0 +1,135 @@
+package plugin_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+
+	"github.com/phopper-pivotal/autoscaling-cli-plugin/mocks"
+	"github.com/phopper-pivotal/autoscaling-cli-plugin/plugin"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Proxy", func() {
+	var (
+		proxy              *httptest.Server
+		proxiedURLs        []string
+		previous           map[string]string
+		proxyEnvNames      = []string{"HTTP_PROXY", "http_proxy", "HTTPS_PROXY", "https_proxy", "NO_PROXY", "no_proxy"}
+		cloudControllerURL = "http://cloudcontroller.example.com/v2/info"
+	)
+
+	BeforeEach(func() {
+		previous = map[string]string{}
+		for _, name := range proxyEnvNames {
+			previous[name] = os.Getenv(name)
+			os.Unsetenv(name)
+		}
+
+		// a stand-in forward proxy, which answers for whichever server it's
+		// asked for
+		proxiedURLs = nil
+		proxy = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			proxiedURLs = append(proxiedURLs, r.URL.String())
+			w.Write([]byte(`{"name": "proxied"}`))
+		}))
+	})
+
+	AfterEach(func() {
+		proxy.Close()
+		for name, value := range previous {
+			os.Setenv(name, value)
+		}
+	})
+
+	proxyFor := func(options plugin.ProxyOptions, rawURL string) *url.URL {
+		proxyFunc, err := options.ProxyFunc()
+		Expect(err).NotTo(HaveOccurred())
+
+		request, err := http.NewRequest("GET", rawURL, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		proxyURL, err := proxyFunc(request)
+		Expect(err).NotTo(HaveOccurred())
+		return proxyURL
+	}
+
+	Describe("ProxyOptions.ProxyFunc", func() {
+		It("uses the standard environment variables", func() {
+			os.Setenv("HTTPS_PROXY", "http://env-proxy.example.com:3128")
+			os.Setenv("NO_PROXY", ".internal.example.com")
+
+			Expect(proxyFor(plugin.ProxyOptions{}, "https://api.example.com")).To(Equal(&url.URL{Scheme: "http", Host: "env-proxy.example.com:3128"}))
+			Expect(proxyFor(plugin.ProxyOptions{}, "https://api.internal.example.com")).To(BeNil())
+		})
+
+		It("uses the plugin's proxy when the environment doesn't give one", func() {
+			options := plugin.ProxyOptions{URL: "http://config-proxy.example.com:3128", NoProxy: "autoscaling.example.com"}
+
+			Expect(proxyFor(options, "https://api.example.com")).To(Equal(&url.URL{Scheme: "http", Host: "config-proxy.example.com:3128"}))
+			Expect(proxyFor(options, "http://api.example.com")).To(Equal(&url.URL{Scheme: "http", Host: "config-proxy.example.com:3128"}))
+			Expect(proxyFor(options, "https://autoscaling.example.com")).To(BeNil())
+		})
+
+		It("prefers the environment's proxy to the plugin's", func() {
+			os.Setenv("HTTPS_PROXY", "http://env-proxy.example.com:3128")
+
+			Expect(proxyFor(plugin.ProxyOptions{URL: "http://config-proxy.example.com:3128"}, "https://api.example.com").Host).To(Equal("env-proxy.example.com:3128"))
+		})
+
+		It("doesn't proxy without any proxy settings", func() {
+			Expect(proxyFor(plugin.ProxyOptions{}, "https://api.example.com")).To(BeNil())
+		})
+
+		Context("when the plugin's proxy is invalid", func() {
+			It("returns an error", func() {
+				_, err := plugin.ProxyOptions{URL: "http://%zz"}.ProxyFunc()
+				Expect(err).To(MatchError(ContainSubstring("invalid proxy url in plugin config file")))
+			})
+		})
+	})
+
+	Describe("connections", func() {
+		var (
+			p             *plugin.Plugin
+			cliConnection *mocks.CLIConnection
+		)
+
+		BeforeEach(func() {
+			p = plugin.NewPlugin()
+			cliConnection = &mocks.CLIConnection{}
+			cliConnection.IsLoggedInCall.Returns.LoggedIn = true
+			cliConnection.ApiEndpointCall.Returns.ApiEndpoint = "http://cloudcontroller.example.com"
+			cliConnection.AccessTokenCall.Returns.Token = "bearer some-token"
+			cliConnection.GetCurrentSpaceCall.Returns.Space.Name = "some-space"
+		})
+
+		get := func() (string, error) {
+			dependencies, err := p.FetchCLIDependencies(cliConnection, []string{"app-name", "service-name"})
+			Expect(err).NotTo(HaveOccurred())
+
+			var info struct {
+				Name string `json:"name"`
+			}
+			err = dependencies.JSONClient.Do("GET", cloudControllerURL, nil, &info)
+			return info.Name, err
+		}
+
+		It("go through the proxy from the environment", func() {
+			os.Setenv("HTTP_PROXY", proxy.URL)
+
+			Expect(get()).To(Equal("proxied"))
+			Expect(proxiedURLs).To(Equal([]string{cloudControllerURL}))
+		})
+
+		It("go through the plugin's proxy", func() {
+			p.Proxy = plugin.ProxyOptions{URL: proxy.URL}
+
+			Expect(get()).To(Equal("proxied"))
+			Expect(proxiedURLs).To(Equal([]string{cloudControllerURL}))
+		})
+	})
+})
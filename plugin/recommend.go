@@ -0,0 +1,359 @@
+package plugin
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// thresholds are kept in this band so there is always room to react
+	lowestMaxThreshold  = 50
+	highestMaxThreshold = 85
+
+	// saturatedCPU is where an instance is considered overloaded
+	saturatedCPU = 90
+)
+
+type UtilisationSnapshot struct {
+	Time time.Time
+
+	// CPU holds the CPU percentage of each running instance
+	CPU []float64
+}
+
+func (s UtilisationSnapshot) load() float64 {
+	var load float64
+	for _, cpu := range s.CPU {
+		load += cpu
+	}
+	return load
+}
+
+// ReadCPUSnapshots reads per-instance CPU data, either as a CSV time series
+// (see ReadMetrics) with one row per instance per timestamp, or as JSON
+// responses from cloud controller's /v3/processes/:guid/stats endpoint,
+// either in an array or one after another.
+func ReadCPUSnapshots(r io.Reader, format string) ([]UtilisationSnapshot, error) {
+	switch format {
+	case "csv":
+		return readCSVSnapshots(r)
+	case "json":
+		return readStatsSnapshots(r)
+	default:
+		return nil, fmt.Errorf("unknown metrics format %s, use csv or json", format)
+	}
+}
+
+func readCSVSnapshots(r io.Reader) ([]UtilisationSnapshot, error) {
+	samples, err := ReadMetrics(r, "cpu")
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshots []UtilisationSnapshot
+	for _, sample := range samples {
+		if len(snapshots) == 0 || !snapshots[len(snapshots)-1].Time.Equal(sample.Time) {
+			snapshots = append(snapshots, UtilisationSnapshot{Time: sample.Time})
+		}
+
+		snapshot := &snapshots[len(snapshots)-1]
+		if sample.Instances > 0 {
+			// the row is an average over the recorded instance count
+			for i := 0; i < sample.Instances; i++ {
+				snapshot.CPU = append(snapshot.CPU, sample.Value)
+			}
+		} else {
+			snapshot.CPU = append(snapshot.CPU, sample.Value)
+		}
+	}
+
+	return snapshots, nil
+}
+
+type processStats struct {
+	Resources []struct {
+		State string `json:"state"`
+		Usage struct {
+			Time string  `json:"time"`
+			CPU  float64 `json:"cpu"`
+		} `json:"usage"`
+	} `json:"resources"`
+}
+
+func readStatsSnapshots(r io.Reader) ([]UtilisationSnapshot, error) {
+	var responses []processStats
+
+	decoder := json.NewDecoder(r)
+	for {
+		var raw json.RawMessage
+		err := decoder.Decode(&raw)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("couldn't parse stats: %s", err)
+		}
+
+		if bytes.HasPrefix(bytes.TrimSpace(raw), []byte("[")) {
+			var batch []processStats
+			if err := json.Unmarshal(raw, &batch); err != nil {
+				return nil, fmt.Errorf("couldn't parse stats: %s", err)
+			}
+			responses = append(responses, batch...)
+		} else {
+			var response processStats
+			if err := json.Unmarshal(raw, &response); err != nil {
+				return nil, fmt.Errorf("couldn't parse stats: %s", err)
+			}
+			responses = append(responses, response)
+		}
+	}
+
+	var snapshots []UtilisationSnapshot
+	for _, response := range responses {
+		var snapshot UtilisationSnapshot
+		for _, resource := range response.Resources {
+			if resource.State != "RUNNING" {
+				continue
+			}
+
+			if snapshot.Time.IsZero() {
+				usageTime, err := time.Parse(time.RFC3339Nano, resource.Usage.Time)
+				if err != nil {
+					return nil, fmt.Errorf("invalid usage time %q in stats", resource.Usage.Time)
+				}
+				snapshot.Time = usageTime
+			}
+
+			// cloud controller reports cpu as a fraction
+			snapshot.CPU = append(snapshot.CPU, resource.Usage.CPU*100)
+		}
+
+		if len(snapshot.CPU) > 0 {
+			snapshots = append(snapshots, snapshot)
+		}
+	}
+
+	if len(snapshots) == 0 {
+		return nil, fmt.Errorf("stats have no running instances")
+	}
+
+	sort.Sort(utilisationSnapshots(snapshots))
+	return snapshots, nil
+}
+
+type utilisationSnapshots []UtilisationSnapshot
+
+func (s utilisationSnapshots) Len() int           { return len(s) }
+func (s utilisationSnapshots) Less(i, j int) bool { return s[i].Time.Before(s[j].Time) }
+func (s utilisationSnapshots) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+type Recommendation struct {
+	Binding     AutoscalingBinding
+	Explanation []string
+}
+
+// Recommend proposes limits and thresholds for the utilisation in snapshots.
+// The max threshold leaves enough headroom for the app to absorb a typical
+// rise in load while the autoscaler adds one instance at a time, the min
+// threshold is low enough that removing an instance doesn't immediately push
+// the app back over the max threshold, and the instance limits cover the
+// lowest and highest load seen.
+func Recommend(snapshots []UtilisationSnapshot) (Recommendation, error) {
+	if len(snapshots) == 0 {
+		return Recommendation{}, fmt.Errorf("no utilisation data to recommend from")
+	}
+
+	var (
+		loads         []float64
+		rises         []float64
+		instances     []float64
+		mostInstances int
+	)
+
+	for i, snapshot := range snapshots {
+		loads = append(loads, snapshot.load())
+		instances = append(instances, float64(len(snapshot.CPU)))
+		if len(snapshot.CPU) > mostInstances {
+			mostInstances = len(snapshot.CPU)
+		}
+
+		if i > 0 {
+			average := snapshot.load() / float64(len(snapshot.CPU))
+			previous := snapshots[i-1].load() / float64(len(snapshots[i-1].CPU))
+			if average > previous {
+				rises = append(rises, average-previous)
+			}
+		}
+	}
+
+	var explanation []string
+	explain := func(format string, args ...interface{}) {
+		explanation = append(explanation, fmt.Sprintf(format, args...))
+	}
+
+	explain("analysed %d samples from %s to %s",
+		len(snapshots), snapshots[0].Time.Format(time.RFC3339), snapshots[len(snapshots)-1].Time.Format(time.RFC3339))
+
+	typicalRise := percentile(rises, 95)
+	maxThreshold := clampInt(roundDownTo5(saturatedCPU-typicalRise), lowestMaxThreshold, highestMaxThreshold)
+	explain("CPU per instance rose by up to %.0f%% between samples (95th percentile), so scaling up above %d%% leaves room to absorb a rise before instances reach %d%%",
+		typicalRise, maxThreshold, saturatedCPU)
+
+	typicalInstances := int(math.Max(2, math.Floor(percentile(instances, 50))))
+	afterScaleDown := float64(maxThreshold) * float64(typicalInstances-1) / float64(typicalInstances)
+	minThreshold := clampInt(roundDownTo5(afterScaleDown)-10, 5, maxThreshold-20)
+	explain("at %d instances, scaling down below %d%% leaves the remaining instances under %d%%, well short of the max threshold, so the app won't flap",
+		typicalInstances, minThreshold, int(math.Ceil(float64(minThreshold)*float64(typicalInstances)/float64(typicalInstances-1))))
+
+	lowLoad := percentile(loads, 5)
+	peakLoad := percentile(loads, 100)
+
+	minInstances := int(math.Max(1, math.Ceil(lowLoad/float64(maxThreshold))))
+	if minInstances < 2 && mostInstances >= 2 {
+		minInstances = 2
+		explain("keeping at least 2 instances, as the app already runs more than one, so it stays available during instance restarts")
+	} else {
+		explain("the quietest periods (5th percentile) need %d instance(s) to stay under the max threshold", minInstances)
+	}
+
+	recommendedMax := int(math.Ceil(peakLoad/float64(maxThreshold))) + 1
+	if recommendedMax < minInstances {
+		recommendedMax = minInstances
+	}
+	explain("the peak load of %.0f%% CPU needs %d instance(s) to stay under the max threshold, plus one spare", peakLoad, recommendedMax-1)
+
+	return Recommendation{
+		Binding: AutoscalingBinding{
+			MinInstances:    minInstances,
+			MaxInstances:    recommendedMax,
+			CPUMinThreshold: minThreshold,
+			CPUMaxThreshold: maxThreshold,
+			Enabled:         true,
+		},
+		Explanation: explanation,
+	}, nil
+}
+
+func percentile(values []float64, p float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	index := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	if index < 0 {
+		index = 0
+	}
+	return sorted[index]
+}
+
+func roundDownTo5(value float64) int {
+	return int(math.Floor(value/5)) * 5
+}
+
+func clampInt(value, min, max int) int {
+	if value < min {
+		return min
+	}
+	if value > max {
+		return max
+	}
+	return value
+}
+
+func configureFlags(binding AutoscalingBinding) string {
+	return fmt.Sprintf("--min-instances %d --max-instances %d --min-threshold %d --max-threshold %d",
+		binding.MinInstances, binding.MaxInstances, binding.CPUMinThreshold, binding.CPUMaxThreshold)
+}
+
+func RenderRecommendation(w io.Writer, recommendation Recommendation, output string, args []string) error {
+	switch output {
+	case "text":
+		for _, line := range recommendation.Explanation {
+			fmt.Fprintf(w, "- %s\n", line)
+		}
+
+		command := append([]string{"cf configure-autoscaling", configureFlags(recommendation.Binding)}, args...)
+		fmt.Fprintf(w, "\nRecommended settings:\n  %s\n", strings.Join(command, " "))
+	case "flags":
+		fmt.Fprintln(w, configureFlags(recommendation.Binding))
+	case "policy":
+		binding := recommendation.Binding
+		policy, err := yaml.Marshal(Policy{
+			MinInstances:    binding.MinInstances,
+			MaxInstances:    binding.MaxInstances,
+			CPUMinThreshold: binding.CPUMinThreshold,
+			CPUMaxThreshold: binding.CPUMaxThreshold,
+		})
+		if err != nil {
+			return err // not tested
+		}
+
+		w.Write(policy)
+	default:
+		return fmt.Errorf("unknown output %s, use text, flags or policy", output)
+	}
+
+	return nil
+}
+
+func (p *Plugin) runRecommend(args []string) error {
+	var (
+		metricsPath string
+		format      string
+		output      string
+	)
+
+	flagSet := flag.NewFlagSet("recommend-autoscaling", flag.ContinueOnError)
+	flagSet.StringVar(&metricsPath, "metrics", "", "CSV or JSON file with historical per-instance CPU data")
+	flagSet.StringVar(&format, "format", "", "(optional) format of the metrics file, csv or json, defaults to the file extension")
+	flagSet.StringVar(&output, "output", "text", "(optional) text, flags or policy")
+	err := flagSet.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if metricsPath == "" {
+		return fmt.Errorf("provide --metrics on command line")
+	}
+
+	if flagSet.NArg() > 2 {
+		return fmt.Errorf("too many arguments provided")
+	}
+
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(metricsPath)), ".")
+	}
+
+	metricsFile, err := os.Open(metricsPath)
+	if err != nil {
+		return fmt.Errorf("couldn't read metrics file: %s", err)
+	}
+	defer metricsFile.Close()
+
+	snapshots, err := ReadCPUSnapshots(metricsFile, format)
+	if err != nil {
+		return fmt.Errorf("%s: %s", metricsPath, err)
+	}
+
+	recommendation, err := Recommend(snapshots)
+	if err != nil {
+		return err
+	}
+
+	return RenderRecommendation(os.Stdout, recommendation, output, flagSet.Args())
+}
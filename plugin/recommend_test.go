@@ -0,0 +1,158 @@
+package plugin_test
+
+import (
+	"bytes"
+	"strings"
+	"time"
+
+	"github.com/phopper-pivotal/autoscaling-cli-plugin/plugin"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Recommend", func() {
+	Describe("ReadCPUSnapshots", func() {
+		It("groups CSV rows with the same timestamp into one snapshot", func() {
+			snapshots, err := plugin.ReadCPUSnapshots(strings.NewReader(`timestamp,instance,cpu
+0,0,40
+0,1,60
+60,0,70
+`), "csv")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(snapshots).To(HaveLen(2))
+			Expect(snapshots[0].CPU).To(Equal([]float64{40, 60}))
+			Expect(snapshots[1].CPU).To(Equal([]float64{70}))
+		})
+
+		It("expands CSV averages over the recorded instance count", func() {
+			snapshots, err := plugin.ReadCPUSnapshots(strings.NewReader("timestamp,cpu,instances\n0,40,3\n"), "csv")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(snapshots[0].CPU).To(Equal([]float64{40, 40, 40}))
+		})
+
+		It("reads cloud controller process stats, one response after another or in an array", func() {
+			snapshots, err := plugin.ReadCPUSnapshots(strings.NewReader(`
+{"resources": [
+	{"state": "RUNNING", "usage": {"time": "2016-06-08T16:05:00.123Z", "cpu": 0.5}},
+	{"state": "CRASHED", "usage": {"time": "2016-06-08T16:05:00.123Z", "cpu": 0}}
+]}
+[{"resources": [{"state": "RUNNING", "usage": {"time": "2016-06-08T16:00:00Z", "cpu": 0.25}}]}]
+`), "json")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(snapshots).To(Equal([]plugin.UtilisationSnapshot{
+				{Time: time.Date(2016, 6, 8, 16, 0, 0, 0, time.UTC), CPU: []float64{25}},
+				{Time: time.Date(2016, 6, 8, 16, 5, 0, 123000000, time.UTC), CPU: []float64{50}},
+			}))
+		})
+
+		Context("failure cases", func() {
+			It("rejects unknown formats", func() {
+				_, err := plugin.ReadCPUSnapshots(strings.NewReader(""), "xml")
+				Expect(err).To(MatchError("unknown metrics format xml, use csv or json"))
+			})
+
+			It("rejects stats without running instances", func() {
+				_, err := plugin.ReadCPUSnapshots(strings.NewReader(`{"resources": []}`), "json")
+				Expect(err).To(MatchError("stats have no running instances"))
+			})
+
+			It("rejects invalid JSON", func() {
+				_, err := plugin.ReadCPUSnapshots(strings.NewReader(`{{{`), "json")
+				Expect(err).To(MatchError(ContainSubstring("couldn't parse stats")))
+			})
+		})
+	})
+
+	Describe("Recommend", func() {
+		var snapshots []plugin.UtilisationSnapshot
+
+		BeforeEach(func() {
+			start := time.Date(2016, 6, 8, 16, 0, 0, 0, time.UTC)
+			for i, cpu := range [][]float64{
+				{30, 30},
+				{40, 40},
+				{60, 60},
+				{50, 50, 50},
+				{70, 70, 70, 70},
+				{20, 20},
+			} {
+				snapshots = append(snapshots, plugin.UtilisationSnapshot{
+					Time: start.Add(time.Duration(i) * time.Minute),
+					CPU:  cpu,
+				})
+			}
+		})
+
+		It("recommends limits and thresholds with an explanation", func() {
+			recommendation, err := plugin.Recommend(snapshots)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(recommendation.Binding).To(Equal(plugin.AutoscalingBinding{
+				MinInstances:    2,
+				MaxInstances:    5,
+				CPUMinThreshold: 25,
+				CPUMaxThreshold: 70,
+				Enabled:         true,
+			}))
+			Expect(recommendation.Explanation).To(ContainElement(ContainSubstring("rose by up to 20%")))
+			Expect(recommendation.Explanation).To(ContainElement(ContainSubstring("peak load of 280% CPU")))
+		})
+
+		It("keeps the thresholds within a sensible band", func() {
+			snapshots[4].CPU = []float64{100, 100, 100, 100}
+
+			recommendation, err := plugin.Recommend(snapshots)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(recommendation.Binding.CPUMaxThreshold).To(Equal(50))
+			Expect(recommendation.Binding.CPUMinThreshold).To(Equal(15))
+		})
+
+		It("requires data", func() {
+			_, err := plugin.Recommend(nil)
+			Expect(err).To(MatchError("no utilisation data to recommend from"))
+		})
+	})
+
+	Describe("RenderRecommendation", func() {
+		var recommendation plugin.Recommendation
+
+		BeforeEach(func() {
+			recommendation = plugin.Recommendation{
+				Binding: plugin.AutoscalingBinding{
+					MinInstances:    2,
+					MaxInstances:    5,
+					CPUMinThreshold: 25,
+					CPUMaxThreshold: 70,
+					Enabled:         true,
+				},
+				Explanation: []string{"because"},
+			}
+		})
+
+		It("explains the recommended configure-autoscaling command", func() {
+			buffer := &bytes.Buffer{}
+			Expect(plugin.RenderRecommendation(buffer, recommendation, "text", []string{"app-name", "service-name"})).To(Succeed())
+			Expect(buffer.String()).To(Equal(`- because
+
+Recommended settings:
+  cf configure-autoscaling --min-instances 2 --max-instances 5 --min-threshold 25 --max-threshold 70 app-name service-name
+`))
+		})
+
+		It("prints just the flags", func() {
+			buffer := &bytes.Buffer{}
+			Expect(plugin.RenderRecommendation(buffer, recommendation, "flags", nil)).To(Succeed())
+			Expect(buffer.String()).To(Equal("--min-instances 2 --max-instances 5 --min-threshold 25 --max-threshold 70\n"))
+		})
+
+		It("prints a policy file", func() {
+			buffer := &bytes.Buffer{}
+			Expect(plugin.RenderRecommendation(buffer, recommendation, "policy", nil)).To(Succeed())
+			Expect(buffer.String()).To(Equal("min_instances: 2\nmax_instances: 5\ncpu_min_threshold: 25\ncpu_max_threshold: 70\n"))
+		})
+
+		It("rejects unknown outputs", func() {
+			Expect(plugin.RenderRecommendation(&bytes.Buffer{}, recommendation, "xml", nil)).To(MatchError("unknown output xml, use text, flags or policy"))
+		})
+	})
+})
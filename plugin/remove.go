@@ -0,0 +1,157 @@
+package plugin
+
+import (
+	"flag"
+	"fmt"
+	"net/url"
+)
+
+// RemoveOptions says how much of an app's autoscaling remove-autoscaling
+// takes away.
+type RemoveOptions struct {
+	// BackupPath, if set, is where the binding's settings are saved as a
+	// policy file before it is disabled
+	BackupPath string
+
+	// KeepBinding only disables the binding, leaving the app bound
+	KeepBinding bool
+
+	// DeleteService deletes the service instance once no apps are bound to it
+	DeleteService bool
+
+	Force bool
+}
+
+// RemoveWithError disables autoscaling for the app and unbinds it from the
+// service instance, deleting the instance too if asked to and nothing else
+// is bound to it.
+func (p *Plugin) RemoveWithError(dependencies CLIDependencies, options RemoveOptions) error {
+	if options.KeepBinding && options.DeleteService {
+		return fmt.Errorf("--keep-binding and --delete-service can't be used together")
+	}
+
+	if !options.Force {
+		changes := []string{fmt.Sprintf("autoscaling will be disabled for %s", dependencies.AppName)}
+		if !options.KeepBinding {
+			changes = append(changes, fmt.Sprintf("%s will be unbound from %s", dependencies.ServiceName, dependencies.AppName))
+		}
+		if options.DeleteService {
+			changes = append(changes, fmt.Sprintf("%s will be deleted if no other apps are bound to it", dependencies.ServiceName))
+		}
+
+		if err := confirmRisks(dependencies.UI, changes); err != nil {
+			return err
+		}
+	}
+
+	if options.BackupPath != "" {
+		current, err := p.fetchBinding(dependencies)
+		if err != nil {
+			return err
+		}
+
+		// a policy file only holds the settings
+		if current.Policy != nil && !current.Policy.onlySettings() {
+			return fmt.Errorf("couldn't back up the settings of %s: its App Autoscaler policy has schedules, rules or options a policy file can't hold, save it from the App Autoscaler API instead", dependencies.AppName)
+		}
+
+		if err := SavePolicy(options.BackupPath, PolicyFor(current.Binding)); err != nil {
+			return err
+		}
+
+		dependencies.UI.Say("Saved the settings of %s to %s", dependencies.AppName, options.BackupPath)
+	}
+
+	dependencies.Unbinding = !options.KeepBinding
+
+	enabled := false
+	err := p.RunWithError(dependencies, Flags{Enabled: &enabled, Force: true})
+	if err != nil {
+		return err
+	}
+
+	dependencies.UI.Say("Disabled autoscaling for %s", dependencies.AppName)
+
+	if options.KeepBinding {
+		return nil
+	}
+
+	bindingGUID, err := lookupServiceBindingGUID(dependencies)
+	if err != nil {
+		return err
+	}
+
+	unbindURL, err := getCCURL(dependencies.APIEndpoint, fmt.Sprintf("/v2/service_bindings/%s", bindingGUID), url.Values{"accepts_incomplete": []string{"true"}})
+	if err != nil {
+		return err
+	}
+
+	var binding ccResource
+	err = dependencies.JSONClient.Do("DELETE", unbindURL, nil, &binding)
+	if err != nil {
+		return fmt.Errorf("couldn't unbind %s from %s: %s", dependencies.ServiceName, dependencies.AppName, err)
+	}
+
+	// the binding is still listed until the broker has finished removing it
+	err = p.Provisioner.waitForDeletion(dependencies, fmt.Sprintf("unbinding %s from %s", dependencies.ServiceName, dependencies.AppName), fmt.Sprintf("/v2/service_bindings/%s", bindingGUID), binding)
+	if err != nil {
+		return err
+	}
+
+	dependencies.UI.Say("Unbound %s from %s", dependencies.ServiceName, dependencies.AppName)
+
+	if !options.DeleteService {
+		return nil
+	}
+
+	var bindings ccResources
+	err = getCCResource(dependencies, fmt.Sprintf("/v2/service_instances/%s/service_bindings", dependencies.Service.Guid), &bindings)
+	if err != nil {
+		return fmt.Errorf("couldn't retrieve the bindings of %s: %s", dependencies.ServiceName, err)
+	}
+
+	if len(bindings.Resources) > 0 {
+		dependencies.UI.Say("Not deleting %s as %d other apps are still bound to it", dependencies.ServiceName, len(bindings.Resources))
+		return nil
+	}
+
+	deleteURL, err := getCCURL(dependencies.APIEndpoint, fmt.Sprintf("/v2/service_instances/%s", dependencies.Service.Guid), url.Values{"accepts_incomplete": []string{"true"}})
+	if err != nil {
+		return err
+	}
+
+	var instance ccResource
+	err = dependencies.JSONClient.Do("DELETE", deleteURL, nil, &instance)
+	if err != nil {
+		return fmt.Errorf("couldn't delete service instance %s: %s", dependencies.ServiceName, err)
+	}
+
+	err = p.Provisioner.waitForDeletion(dependencies, fmt.Sprintf("deleting service instance %s", dependencies.ServiceName), fmt.Sprintf("/v2/service_instances/%s", dependencies.Service.Guid), instance)
+	if err != nil {
+		return err
+	}
+
+	dependencies.UI.Say("Deleted service instance %s", dependencies.ServiceName)
+	return nil
+}
+
+func (p *Plugin) runRemove(cliConnection cliConnection, args []string) error {
+	var options RemoveOptions
+	flagSet := flag.NewFlagSet("remove-autoscaling", flag.ContinueOnError)
+	flagSet.StringVar(&options.BackupPath, "backup", "", "(optional) save the settings to this policy file first")
+	flagSet.BoolVar(&options.KeepBinding, "keep-binding", false, "(optional) only disable autoscaling, leaving the app bound to the service instance")
+	flagSet.BoolVar(&options.DeleteService, "delete-service", false, "(optional) delete the service instance if no other apps are bound to it")
+	flagSet.BoolVar(&options.Force, "f", false, "(optional) remove without asking for confirmation")
+	flagSet.BoolVar(&options.Force, "force", false, "(optional) remove without asking for confirmation")
+	err := flagSet.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	dependencies, err := p.FetchCLIDependencies(cliConnection, flagSet.Args())
+	if err != nil {
+		return err
+	}
+
+	return p.RemoveWithError(dependencies, options)
+}
@@ -0,0 +1,266 @@
+package plugin_test
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"code.cloudfoundry.org/cli/plugin/models"
+	"github.com/phopper-pivotal/autoscaling-cli-plugin/mocks"
+	"github.com/phopper-pivotal/autoscaling-cli-plugin/plugin"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RemoveWithError", func() {
+	var (
+		p            *plugin.Plugin
+		jsonClient   *mocks.JSONClient
+		dependencies plugin.CLIDependencies
+		out          *bytes.Buffer
+	)
+
+	const (
+		bindings = `{"Resources": [{"Metadata": {"GUID": "some-service-binding-guid"}}]}`
+		binding  = `{"min_instances": 3, "max_instances": 7, "cpu_min_threshold": 20, "cpu_max_threshold": 80, "enabled": true}`
+	)
+
+	BeforeEach(func() {
+		p = plugin.NewPlugin()
+		jsonClient = mocks.NewJSONClient(7)
+		jsonClient.DoCalls[0].ResponseJSON = bindings
+		jsonClient.DoCalls[1].ResponseJSON = binding
+		jsonClient.DoCalls[1].Returns.Headers = http.Header{"Etag": []string{`"some-version"`}}
+		jsonClient.DoCalls[3].ResponseJSON = bindings
+		jsonClient.DoCalls[4].ResponseJSON = `{}`
+		jsonClient.DoCalls[5].ResponseJSON = `{"resources": []}`
+		jsonClient.DoCalls[6].ResponseJSON = `{}`
+
+		out = &bytes.Buffer{}
+		dependencies = plugin.CLIDependencies{
+			AppName:     "app-name",
+			ServiceName: "service-name",
+			Service: plugin_models.GetService_Model{
+				Guid:         "some-service-instance-guid",
+				DashboardUrl: "http://autoscaling.example.com/something-that-doesnot-matter",
+			},
+			APIEndpoint: "https://cloudcontroller.example.com",
+			App: plugin_models.GetAppModel{
+				Guid: "some-app-guid",
+			},
+			JSONClient: jsonClient,
+			UI:         plugin.UI{Out: out},
+		}
+	})
+
+	It("disables autoscaling and unbinds the app", func() {
+		Expect(p.RemoveWithError(dependencies, plugin.RemoveOptions{Force: true})).To(Succeed())
+
+		Expect(jsonClient.DoCalls[2].Receives.Method).To(Equal("POST"))
+		Expect(jsonClient.DoCalls[2].Receives.RequestData).To(Equal(&plugin.AutoscalingBinding{
+			AppGuid:         "some-app-guid",
+			MinInstances:    3,
+			MaxInstances:    7,
+			CPUMinThreshold: 20,
+			CPUMaxThreshold: 80,
+			Enabled:         false,
+		}))
+
+		Expect(jsonClient.DoCalls[4].Receives.Method).To(Equal("DELETE"))
+		Expect(jsonClient.DoCalls[4].Receives.URL).To(Equal("https://cloudcontroller.example.com/v2/service_bindings/some-service-binding-guid?accepts_incomplete=true"))
+		Expect(jsonClient.DoCallCount).To(Equal(5))
+
+		Expect(out.String()).To(Equal("Disabled autoscaling for app-name\nUnbound service-name from app-name\n"))
+	})
+
+	It("disables settings that no longer pass the checks", func() {
+		jsonClient.DoCalls[1].ResponseJSON = `{"min_instances": 9, "max_instances": 3, "cpu_min_threshold": 0, "cpu_max_threshold": 0, "enabled": true}`
+		guardrails := &mocks.Guardrails{}
+		guardrails.EvaluateCall.Returns.Violations = []plugin.GuardrailViolation{
+			{Rule: "some-rule", Message: "some message", Reject: true},
+		}
+		dependencies.Guardrails = guardrails
+
+		Expect(p.RemoveWithError(dependencies, plugin.RemoveOptions{Force: true, KeepBinding: true})).To(Succeed())
+		Expect(jsonClient.DoCalls[2].Receives.Method).To(Equal("POST"))
+		Expect(jsonClient.DoCalls[2].Receives.RequestData).To(Equal(&plugin.AutoscalingBinding{
+			AppGuid:      "some-app-guid",
+			MinInstances: 9,
+			MaxInstances: 3,
+		}))
+		Expect(guardrails.EvaluateCall.Receives.Subject).To(BeZero())
+	})
+
+	It("only disables autoscaling with --keep-binding", func() {
+		Expect(p.RemoveWithError(dependencies, plugin.RemoveOptions{KeepBinding: true, Force: true})).To(Succeed())
+		Expect(jsonClient.DoCallCount).To(Equal(3))
+	})
+
+	Context("with --delete-service", func() {
+		It("deletes the service instance when no other apps are bound to it", func() {
+			Expect(p.RemoveWithError(dependencies, plugin.RemoveOptions{DeleteService: true, Force: true})).To(Succeed())
+
+			Expect(jsonClient.DoCalls[5].Receives.URL).To(Equal("https://cloudcontroller.example.com/v2/service_instances/some-service-instance-guid/service_bindings"))
+			Expect(jsonClient.DoCalls[6].Receives.Method).To(Equal("DELETE"))
+			Expect(jsonClient.DoCalls[6].Receives.URL).To(Equal("https://cloudcontroller.example.com/v2/service_instances/some-service-instance-guid?accepts_incomplete=true"))
+			Expect(out.String()).To(HaveSuffix("Deleted service instance service-name\n"))
+		})
+
+		It("keeps the service instance when other apps are bound to it", func() {
+			jsonClient.DoCalls[5].ResponseJSON = `{"resources": [{"metadata": {"guid": "other-binding-guid"}}]}`
+
+			Expect(p.RemoveWithError(dependencies, plugin.RemoveOptions{DeleteService: true, Force: true})).To(Succeed())
+			Expect(jsonClient.DoCallCount).To(Equal(6))
+			Expect(out.String()).To(HaveSuffix("Not deleting service-name as 1 other apps are still bound to it\n"))
+		})
+
+		It("waits for the broker to finish unbinding and deleting", func() {
+			var sleeps []time.Duration
+			p.Provisioner = plugin.ServiceProvisioner{
+				PollInterval: time.Second,
+				Timeout:      time.Minute,
+				Sleep: func(d time.Duration) {
+					sleeps = append(sleeps, d)
+				},
+			}
+			inProgress := `{"entity": {"last_operation": {"state": "in progress"}}}`
+			gone := plugin.UnexpectedResponseError{StatusCode: http.StatusNotFound, Status: "404 Not Found"}
+			for i := 7; i < 10; i++ {
+				jsonClient.DoCalls[i] = &mocks.DoCall{}
+			}
+			jsonClient.DoCalls[4].ResponseJSON = inProgress
+			jsonClient.DoCalls[5].ResponseJSON = `{}`
+			jsonClient.DoCalls[5].Returns.Error = gone
+			jsonClient.DoCalls[6].ResponseJSON = `{"resources": []}`
+			jsonClient.DoCalls[7].ResponseJSON = inProgress
+			jsonClient.DoCalls[8].ResponseJSON = inProgress
+			jsonClient.DoCalls[9].ResponseJSON = `{}`
+			jsonClient.DoCalls[9].Returns.Error = gone
+
+			Expect(p.RemoveWithError(dependencies, plugin.RemoveOptions{DeleteService: true, Force: true})).To(Succeed())
+			Expect(jsonClient.DoCalls[5].Receives.URL).To(Equal("https://cloudcontroller.example.com/v2/service_bindings/some-service-binding-guid"))
+			Expect(jsonClient.DoCalls[6].Receives.URL).To(Equal("https://cloudcontroller.example.com/v2/service_instances/some-service-instance-guid/service_bindings"))
+			Expect(jsonClient.DoCalls[9].Receives.URL).To(Equal("https://cloudcontroller.example.com/v2/service_instances/some-service-instance-guid"))
+			Expect(jsonClient.DoCallCount).To(Equal(10))
+			Expect(sleeps).To(HaveLen(3))
+			Expect(out.String()).To(HaveSuffix("Deleted service instance service-name\n"))
+		})
+
+		It("fails when the broker fails to unbind", func() {
+			jsonClient.DoCalls[4].ResponseJSON = `{"entity": {"last_operation": {"state": "failed", "description": "some broker error"}}}`
+
+			err := p.RemoveWithError(dependencies, plugin.RemoveOptions{DeleteService: true, Force: true})
+			Expect(err).To(MatchError("unbinding service-name from app-name failed: some broker error"))
+		})
+
+		It("can't be combined with --keep-binding", func() {
+			err := p.RemoveWithError(dependencies, plugin.RemoveOptions{DeleteService: true, KeepBinding: true, Force: true})
+			Expect(err).To(MatchError("--keep-binding and --delete-service can't be used together"))
+		})
+	})
+
+	Context("with --backup", func() {
+		var dir string
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "remove")
+			Expect(err).NotTo(HaveOccurred())
+
+			jsonClient = mocks.NewJSONClient(5)
+			jsonClient.DoCalls[0].ResponseJSON = bindings
+			jsonClient.DoCalls[1].ResponseJSON = binding
+			jsonClient.DoCalls[2].ResponseJSON = bindings
+			jsonClient.DoCalls[3].ResponseJSON = binding
+			jsonClient.DoCalls[3].Returns.Headers = http.Header{"Etag": []string{`"some-version"`}}
+			dependencies.JSONClient = jsonClient
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		It("saves the settings as a policy file first", func() {
+			path := filepath.Join(dir, "backup.yml")
+
+			Expect(p.RemoveWithError(dependencies, plugin.RemoveOptions{BackupPath: path, KeepBinding: true, Force: true})).To(Succeed())
+
+			policy, err := plugin.LoadPolicy(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(policy.Binding()).To(Equal(plugin.AutoscalingBinding{
+				MinInstances:    3,
+				MaxInstances:    7,
+				CPUMinThreshold: 20,
+				CPUMaxThreshold: 80,
+				Enabled:         true,
+			}))
+			Expect(out.String()).To(HavePrefix("Saved the settings of app-name to " + path + "\n"))
+		})
+
+		It("doesn't change anything when the backup can't be saved", func() {
+			err := p.RemoveWithError(dependencies, plugin.RemoveOptions{BackupPath: filepath.Join(dir, "missing", "backup.yml"), Force: true})
+			Expect(err).To(MatchError(ContainSubstring("couldn't write policy file")))
+			Expect(jsonClient.DoCallCount).To(Equal(2))
+		})
+	})
+
+	Context("with an App Autoscaler policy holding more than the settings", func() {
+		BeforeEach(func() {
+			dependencies.APIEndpoint = "https://api.sys.example.com"
+			dependencies.Service.ServiceOffering.Name = "autoscaler"
+			jsonClient.DoCalls[1].ResponseJSON = `{
+				"instance_min_count": 2,
+				"instance_max_count": 6,
+				"scaling_rules": [
+					{"metric_type": "cpu", "threshold": 20, "operator": "<", "adjustment": "-1"},
+					{"metric_type": "cpu", "threshold": 80, "operator": ">=", "adjustment": "+1"}
+				],
+				"schedules": {"timezone": "UTC", "recurring_schedule": []}
+			}`
+		})
+
+		It("deletes it and unbinds the app, as unbinding drops the policy anyway", func() {
+			Expect(p.RemoveWithError(dependencies, plugin.RemoveOptions{Force: true})).To(Succeed())
+			Expect(jsonClient.DoCalls[2].Receives.Method).To(Equal("DELETE"))
+			Expect(jsonClient.DoCalls[2].Receives.URL).To(Equal("https://autoscaler.sys.example.com/v1/apps/some-app-guid/policy"))
+			Expect(jsonClient.DoCalls[4].Receives.Method).To(Equal("DELETE"))
+			Expect(jsonClient.DoCalls[4].Receives.URL).To(Equal("https://api.sys.example.com/v2/service_bindings/some-service-binding-guid?accepts_incomplete=true"))
+		})
+
+		It("refuses to only disable it, which would lose the schedules", func() {
+			err := p.RemoveWithError(dependencies, plugin.RemoveOptions{KeepBinding: true, Force: true})
+			Expect(err).To(MatchError(ContainSubstring("which deleting the policy would lose")))
+			Expect(jsonClient.DoCallCount).To(Equal(2))
+		})
+
+		It("refuses to back it up as a policy file, which would lose the schedules", func() {
+			err := p.RemoveWithError(dependencies, plugin.RemoveOptions{BackupPath: "/does/not/matter.yml", Force: true})
+			Expect(err).To(MatchError("couldn't back up the settings of app-name: its App Autoscaler policy has schedules, rules or options a policy file can't hold, save it from the App Autoscaler API instead"))
+			Expect(jsonClient.DoCallCount).To(Equal(2))
+		})
+	})
+
+	Context("failure cases", func() {
+		It("asks for confirmation first", func() {
+			err := p.RemoveWithError(dependencies, plugin.RemoveOptions{DeleteService: true})
+			Expect(err).To(MatchError(`this change is risky:
+  - autoscaling will be disabled for app-name
+  - service-name will be unbound from app-name
+  - service-name will be deleted if no other apps are bound to it
+re-run with -f to apply it anyway`))
+			Expect(jsonClient.DoCallCount).To(Equal(0))
+		})
+
+		It("fails when unbinding fails", func() {
+			jsonClient.DoCalls[4].Returns.Error = errors.New("some error")
+
+			err := p.RemoveWithError(dependencies, plugin.RemoveOptions{Force: true})
+			Expect(err).To(MatchError("couldn't unbind service-name from app-name: some error"))
+		})
+	})
+})
@@ -0,0 +1,82 @@
+package plugin
+
+import (
+	"crypto/rand"
+	"fmt"
+	"net/http"
+	"runtime"
+	"strings"
+)
+
+const requestIDHeader = "X-Vcap-Request-Id"
+
+// HeaderTransport adds headers to every request that goes through it.
+type HeaderTransport struct {
+	Headers   http.Header
+	Transport http.RoundTripper
+}
+
+func (t *HeaderTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	// round trippers mustn't change the request they're given
+	withHeaders := *request
+	withHeaders.Header = http.Header{}
+	for name, values := range request.Header {
+		withHeaders.Header[name] = values
+	}
+
+	for name, values := range t.Headers {
+		if withHeaders.Header.Get(name) == "" {
+			withHeaders.Header[name] = values
+		}
+	}
+
+	return t.Transport.RoundTrip(&withHeaders)
+}
+
+// NewRequestID returns a random UUID to correlate the requests of a command
+// in the logs of cloud controller, UAA and the autoscaler.
+func NewRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "" // not tested
+	}
+
+	// version 4, variant 1
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// UserAgent describes the plugin, and the cf cli running it if known.
+func UserAgent(pluginVersion, cfVersion string) string {
+	agent := fmt.Sprintf("autoscaling-cli-plugin/%s", pluginVersion)
+	if cfVersion != "" {
+		agent = fmt.Sprintf("%s cf/%s", agent, cfVersion)
+	}
+
+	return fmt.Sprintf("%s (%s; %s %s)", agent, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}
+
+// cfVersion returns the version of the cf cli, e.g.
+// 6.40.0+7e3b4f2d1.2018-08-23, or "" if the connection can't run cf commands.
+func cfVersion(cliConnection cliConnection) string {
+	runner, ok := cliConnection.(interface {
+		CliCommandWithoutTerminalOutput(args ...string) ([]string, error)
+	})
+	if !ok {
+		return ""
+	}
+
+	output, err := runner.CliCommandWithoutTerminalOutput("version")
+	if err != nil || len(output) == 0 {
+		return ""
+	}
+
+	fields := strings.Fields(output[0])
+	if len(fields) < 3 || fields[0] != "cf" || fields[1] != "version" {
+		return ""
+	}
+
+	return fields[2]
+}
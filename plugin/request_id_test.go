@@ -0,0 +1,96 @@
+package plugin_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+
+	"github.com/phopper-pivotal/autoscaling-cli-plugin/plugin"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RequestID", func() {
+	Describe("NewRequestID", func() {
+		It("returns a version 4 UUID", func() {
+			Expect(plugin.NewRequestID()).To(MatchRegexp(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`))
+		})
+
+		It("returns a new ID each time", func() {
+			Expect(plugin.NewRequestID()).NotTo(Equal(plugin.NewRequestID()))
+		})
+	})
+
+	Describe("UserAgent", func() {
+		It("describes the plugin and the cf cli", func() {
+			Expect(plugin.UserAgent("0.2.0", "6.40.0+7e3b4f2d1.2018-08-23")).To(Equal(
+				"autoscaling-cli-plugin/0.2.0 cf/6.40.0+7e3b4f2d1.2018-08-23 (" + runtime.Version() + "; " + runtime.GOOS + " " + runtime.GOARCH + ")",
+			))
+		})
+
+		It("leaves out the cf cli when its version isn't known", func() {
+			Expect(plugin.UserAgent("0.2.0", "")).To(HavePrefix("autoscaling-cli-plugin/0.2.0 ("))
+		})
+	})
+
+	Describe("HeaderTransport", func() {
+		var (
+			server   *httptest.Server
+			received http.Header
+			client   *http.Client
+		)
+
+		BeforeEach(func() {
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				received = r.Header
+			}))
+
+			headers := http.Header{}
+			headers.Set("User-Agent", "autoscaling-cli-plugin/0.2.0")
+			headers.Set("X-Vcap-Request-Id", "some-request-id")
+			client = &http.Client{
+				Transport: &plugin.HeaderTransport{Headers: headers, Transport: http.DefaultTransport},
+			}
+		})
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		It("adds the headers to every request", func() {
+			for i := 0; i < 2; i++ {
+				response, err := client.Get(server.URL)
+				Expect(err).NotTo(HaveOccurred())
+				response.Body.Close()
+
+				Expect(received.Get("User-Agent")).To(Equal("autoscaling-cli-plugin/0.2.0"))
+				Expect(received.Get("X-Vcap-Request-Id")).To(Equal("some-request-id"))
+			}
+		})
+
+		It("keeps the headers already on a request", func() {
+			request, err := http.NewRequest("GET", server.URL, nil)
+			Expect(err).NotTo(HaveOccurred())
+			request.Header.Set("X-Vcap-Request-Id", "caller-request-id")
+
+			response, err := client.Do(request)
+			Expect(err).NotTo(HaveOccurred())
+			response.Body.Close()
+
+			Expect(received.Get("X-Vcap-Request-Id")).To(Equal("caller-request-id"))
+			Expect(received.Get("User-Agent")).To(Equal("autoscaling-cli-plugin/0.2.0"))
+		})
+
+		It("doesn't change the caller's request", func() {
+			request, err := http.NewRequest("GET", server.URL, nil)
+			Expect(err).NotTo(HaveOccurred())
+
+			response, err := client.Do(request)
+			Expect(err).NotTo(HaveOccurred())
+			response.Body.Close()
+
+			Expect(request.Header).To(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,109 @@
+package plugin
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// riskyDropPercent is how much the instance limits can shrink by in one
+// change before it needs confirming.
+const riskyDropPercent = 50
+
+const (
+	productionSpacePatternEnv     = "AUTOSCALING_PRODUCTION_SPACE_PATTERN"
+	defaultProductionSpacePattern = "(?i)prod"
+)
+
+// productionSpacePattern returns the pattern that production space names
+// match, from AUTOSCALING_PRODUCTION_SPACE_PATTERN if set.
+func productionSpacePattern() (*regexp.Regexp, error) {
+	pattern := os.Getenv(productionSpacePatternEnv)
+	if pattern == "" {
+		pattern = defaultProductionSpacePattern
+	}
+
+	productionSpace, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %s", productionSpacePatternEnv, err)
+	}
+
+	return productionSpace, nil
+}
+
+// DetectRisks lists the reasons a change from current to updated could hurt
+// a running app and should be confirmed first.
+func DetectRisks(current, updated AutoscalingBinding, runningInstances int, spaceName string, productionSpace *regexp.Regexp) []string {
+	var risks []string
+
+	if updated.MaxInstances < runningInstances {
+		risks = append(risks, fmt.Sprintf("max instances (%d) is below the %d instances currently running", updated.MaxInstances, runningInstances))
+	}
+
+	if current.Enabled && !updated.Enabled {
+		risks = append(risks, "autoscaling will be disabled")
+	}
+
+	addDrop := func(setting string, from, to int) {
+		if from > 0 && to < from && (from-to)*100 >= from*riskyDropPercent {
+			risks = append(risks, fmt.Sprintf("%s drops by %d%% from %d to %d", setting, (from-to)*100/from, from, to))
+		}
+	}
+	addDrop("max instances", current.MaxInstances, updated.MaxInstances)
+	addDrop("min instances", current.MinInstances, updated.MinInstances)
+
+	if spaceName != "" && productionSpace != nil && productionSpace.MatchString(spaceName) {
+		risks = append(risks, fmt.Sprintf("space %s looks like a production space", spaceName))
+	}
+
+	return risks
+}
+
+// confirmRisks asks the user to confirm a risky change. It fails without
+// asking when nobody can answer.
+func confirmRisks(ui UI, risks []string) error {
+	if len(risks) == 0 {
+		return nil
+	}
+
+	message := []string{"this change is risky:"}
+	for _, risk := range risks {
+		message = append(message, fmt.Sprintf("  - %s", risk))
+	}
+
+	if !ui.Interactive {
+		message = append(message, "re-run with -f to apply it anyway")
+		return fmt.Errorf("%s", strings.Join(message, "\n"))
+	}
+
+	fmt.Fprintln(ui.Out, strings.Join(message, "\n"))
+	confirmed, err := ui.Confirm("Apply these settings?")
+	if err != nil {
+		return err
+	}
+
+	if !confirmed {
+		return fmt.Errorf("cancelled, the settings weren't changed")
+	}
+
+	return nil
+}
+
+// riskConfirmation returns the confirmation that postBinding asks for risky
+// changes, or nil when they're forced.
+func riskConfirmation(dependencies CLIDependencies, force bool) (confirmChange, error) {
+	if force {
+		return nil, nil
+	}
+
+	productionSpace, err := productionSpacePattern()
+	if err != nil {
+		return nil, err
+	}
+
+	return func(current, updated AutoscalingBinding) error {
+		risks := DetectRisks(current, updated, dependencies.App.RunningInstances, dependencies.SpaceName, productionSpace)
+		return confirmRisks(dependencies.UI, risks)
+	}, nil
+}
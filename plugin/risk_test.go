@@ -0,0 +1,74 @@
+package plugin_test
+
+import (
+	"regexp"
+
+	"github.com/phopper-pivotal/autoscaling-cli-plugin/plugin"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DetectRisks", func() {
+	var (
+		current         plugin.AutoscalingBinding
+		productionSpace *regexp.Regexp
+	)
+
+	BeforeEach(func() {
+		current = plugin.AutoscalingBinding{
+			MinInstances:    4,
+			MaxInstances:    50,
+			CPUMinThreshold: 20,
+			CPUMaxThreshold: 80,
+			Enabled:         true,
+		}
+		productionSpace = regexp.MustCompile("(?i)prod")
+	})
+
+	It("finds nothing risky in a small change", func() {
+		updated := current
+		updated.MaxInstances = 40
+
+		Expect(plugin.DetectRisks(current, updated, 12, "dev", productionSpace)).To(BeEmpty())
+	})
+
+	It("flags max instances below the running instances", func() {
+		updated := current
+		updated.MaxInstances = 40
+
+		Expect(plugin.DetectRisks(current, updated, 45, "dev", productionSpace)).To(Equal([]string{
+			"max instances (40) is below the 45 instances currently running",
+		}))
+	})
+
+	It("flags disabling autoscaling", func() {
+		updated := current
+		updated.Enabled = false
+
+		Expect(plugin.DetectRisks(current, updated, 12, "dev", productionSpace)).To(Equal([]string{
+			"autoscaling will be disabled",
+		}))
+	})
+
+	It("flags large drops in the instance limits", func() {
+		updated := current
+		updated.MinInstances = 2
+		updated.MaxInstances = 2
+
+		Expect(plugin.DetectRisks(current, updated, 2, "dev", productionSpace)).To(Equal([]string{
+			"max instances drops by 96% from 50 to 2",
+			"min instances drops by 50% from 4 to 2",
+		}))
+	})
+
+	It("doesn't flag drops from a binding that was never configured", func() {
+		Expect(plugin.DetectRisks(plugin.AutoscalingBinding{}, current, 0, "dev", productionSpace)).To(BeEmpty())
+	})
+
+	It("flags any change in a production space", func() {
+		Expect(plugin.DetectRisks(current, current, 12, "Production", productionSpace)).To(Equal([]string{
+			"space Production looks like a production space",
+		}))
+	})
+})
@@ -0,0 +1,222 @@
+package plugin
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+const defaultScalingInterval = 5 * time.Minute
+
+type SimulationStep struct {
+	Time      time.Time
+	CPU       float64
+	Instances int
+	Change    int
+}
+
+type SimulationSummary struct {
+	Intervals        int
+	ScaleUps         int
+	ScaleDowns       int
+	MinInstances     int
+	MaxInstances     int
+	AverageInstances float64
+	InstanceHours    float64
+
+	// SaturatedIntervals counts intervals where the app was above the max
+	// threshold but already at max instances.
+	SaturatedIntervals int
+}
+
+type SimulationResult struct {
+	Steps   []SimulationStep
+	Summary SimulationSummary
+}
+
+// Simulate replays samples against binding the way the autoscaler evaluates
+// an app: once per interval it averages the CPU seen over that interval and
+// adds one instance if it is above the max threshold or removes one if it is
+// below the min threshold, staying within the instance limits.
+//
+// When a sample records the instance count it was taken at, its CPU is
+// rescaled to the simulated instance count, assuming the load is spread
+// evenly across instances.
+func Simulate(binding AutoscalingBinding, samples []MetricSample, interval time.Duration, initialInstances int) (SimulationResult, error) {
+	if interval <= 0 {
+		return SimulationResult{}, fmt.Errorf("interval must be positive")
+	}
+
+	if err := ValidateBinding(binding, nil); err != nil {
+		return SimulationResult{}, err
+	}
+
+	if len(samples) == 0 {
+		return SimulationResult{}, fmt.Errorf("no samples to simulate")
+	}
+
+	instances := initialInstances
+	if instances < binding.MinInstances {
+		instances = binding.MinInstances
+	}
+	if instances > binding.MaxInstances {
+		instances = binding.MaxInstances
+	}
+
+	var result SimulationResult
+	start := samples[0].Time
+
+	for i := 0; i < len(samples); {
+		windowStart := start.Add(time.Duration(samples[i].Time.Sub(start)/interval) * interval)
+		windowEnd := windowStart.Add(interval)
+
+		var total float64
+		var count int
+		for ; i < len(samples) && samples[i].Time.Before(windowEnd); i++ {
+			cpu := samples[i].Value
+			if samples[i].Instances > 0 {
+				cpu = cpu * float64(samples[i].Instances) / float64(instances)
+			}
+
+			total += cpu
+			count++
+		}
+
+		step := SimulationStep{
+			Time: windowStart,
+			CPU:  total / float64(count),
+		}
+
+		if binding.Enabled {
+			switch {
+			case step.CPU > float64(binding.CPUMaxThreshold) && instances < binding.MaxInstances:
+				step.Change = 1
+			case step.CPU > float64(binding.CPUMaxThreshold):
+				result.Summary.SaturatedIntervals++
+			case step.CPU < float64(binding.CPUMinThreshold) && instances > binding.MinInstances:
+				step.Change = -1
+			}
+		}
+
+		instances += step.Change
+		step.Instances = instances
+		result.Steps = append(result.Steps, step)
+	}
+
+	summary := &result.Summary
+	summary.Intervals = len(result.Steps)
+	summary.MinInstances = result.Steps[0].Instances
+	summary.MaxInstances = result.Steps[0].Instances
+
+	var totalInstances int
+	for _, step := range result.Steps {
+		switch {
+		case step.Change > 0:
+			summary.ScaleUps++
+		case step.Change < 0:
+			summary.ScaleDowns++
+		}
+
+		if step.Instances < summary.MinInstances {
+			summary.MinInstances = step.Instances
+		}
+		if step.Instances > summary.MaxInstances {
+			summary.MaxInstances = step.Instances
+		}
+
+		totalInstances += step.Instances
+	}
+
+	summary.AverageInstances = float64(totalInstances) / float64(summary.Intervals)
+	summary.InstanceHours = float64(totalInstances) * interval.Hours()
+
+	return result, nil
+}
+
+func RenderSimulation(w io.Writer, result SimulationResult) {
+	table := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(table, "TIME\tCPU\tINSTANCES\tACTION\n")
+	for _, step := range result.Steps {
+		action := ""
+		switch {
+		case step.Change > 0:
+			action = "scale up"
+		case step.Change < 0:
+			action = "scale down"
+		}
+
+		fmt.Fprintf(table, "%s\t%.1f%%\t%d\t%s\n", step.Time.Format(time.RFC3339), step.CPU, step.Instances, action)
+	}
+	table.Flush()
+
+	summary := result.Summary
+	fmt.Fprintf(w, "\nSummary:\n")
+	table = tabwriter.NewWriter(w, 0, 4, 1, ' ', 0)
+	fmt.Fprintf(table, "  intervals:\t%d\n", summary.Intervals)
+	fmt.Fprintf(table, "  scale ups:\t%d\n", summary.ScaleUps)
+	fmt.Fprintf(table, "  scale downs:\t%d\n", summary.ScaleDowns)
+	fmt.Fprintf(table, "  instances:\tmin %d, max %d, average %.1f\n", summary.MinInstances, summary.MaxInstances, summary.AverageInstances)
+	fmt.Fprintf(table, "  instance hours:\t%.1f\n", summary.InstanceHours)
+	fmt.Fprintf(table, "  intervals over max threshold at max instances:\t%d\n", summary.SaturatedIntervals)
+	table.Flush()
+}
+
+func (p *Plugin) runSimulate(args []string) error {
+	var (
+		policyPath       string
+		metricsPath      string
+		metric           string
+		interval         time.Duration
+		initialInstances int
+	)
+
+	flagSet := flag.NewFlagSet("simulate-autoscaling", flag.ContinueOnError)
+	flagSet.StringVar(&policyPath, "policy", "", "policy file with the limits and thresholds to simulate")
+	flagSet.StringVar(&metricsPath, "metrics", "", "CSV file with the metric time series to replay")
+	flagSet.StringVar(&metric, "metric", "cpu", "(optional) metrics column to replay")
+	flagSet.DurationVar(&interval, "interval", defaultScalingInterval, "(optional) time between scaling decisions")
+	flagSet.IntVar(&initialInstances, "initial-instances", 0, "(optional) instance count at the start, defaults to the policy's min instances")
+	err := flagSet.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if policyPath == "" || metricsPath == "" {
+		return fmt.Errorf("provide --policy and --metrics on command line")
+	}
+
+	if flagSet.NArg() > 0 {
+		return fmt.Errorf("too many arguments provided")
+	}
+
+	if metric != "cpu" {
+		return fmt.Errorf("simulating %s is not supported, only cpu", metric)
+	}
+
+	policy, err := LoadPolicy(policyPath)
+	if err != nil {
+		return err
+	}
+
+	metricsFile, err := os.Open(metricsPath)
+	if err != nil {
+		return fmt.Errorf("couldn't read metrics file: %s", err)
+	}
+	defer metricsFile.Close()
+
+	samples, err := ReadMetrics(metricsFile, metric)
+	if err != nil {
+		return fmt.Errorf("%s: %s", metricsPath, err)
+	}
+
+	result, err := Simulate(policy.Binding(), samples, interval, initialInstances)
+	if err != nil {
+		return err
+	}
+
+	RenderSimulation(os.Stdout, result)
+	return nil
+}
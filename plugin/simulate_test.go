@@ -0,0 +1,131 @@
+package plugin_test
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/phopper-pivotal/autoscaling-cli-plugin/plugin"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Simulate", func() {
+	var (
+		binding plugin.AutoscalingBinding
+		start   time.Time
+	)
+
+	BeforeEach(func() {
+		binding = plugin.AutoscalingBinding{
+			MinInstances:    2,
+			MaxInstances:    4,
+			CPUMinThreshold: 20,
+			CPUMaxThreshold: 80,
+			Enabled:         true,
+		}
+		start = time.Date(2016, 6, 8, 16, 0, 0, 0, time.UTC)
+	})
+
+	samplesAt := func(values ...float64) []plugin.MetricSample {
+		var samples []plugin.MetricSample
+		for i, value := range values {
+			samples = append(samples, plugin.MetricSample{
+				Time:  start.Add(time.Duration(i) * time.Minute),
+				Value: value,
+			})
+		}
+		return samples
+	}
+
+	It("steps one instance per interval within the limits", func() {
+		samples := samplesAt(90, 90, 90, 90, 50, 10, 10, 10)
+
+		result, err := plugin.Simulate(binding, samples, time.Minute, 0)
+		Expect(err).NotTo(HaveOccurred())
+
+		var instances []int
+		for _, step := range result.Steps {
+			instances = append(instances, step.Instances)
+		}
+		Expect(instances).To(Equal([]int{3, 4, 4, 4, 4, 3, 2, 2}))
+
+		Expect(result.Summary).To(Equal(plugin.SimulationSummary{
+			Intervals:          8,
+			ScaleUps:           2,
+			ScaleDowns:         2,
+			MinInstances:       2,
+			MaxInstances:       4,
+			AverageInstances:   3.25,
+			InstanceHours:      26.0 / 60,
+			SaturatedIntervals: 2,
+		}))
+	})
+
+	It("averages the samples within each interval", func() {
+		samples := samplesAt(100, 40, 10, 10)
+
+		result, err := plugin.Simulate(binding, samples, 2*time.Minute, 3)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Steps).To(Equal([]plugin.SimulationStep{
+			{Time: start, CPU: 70, Instances: 3},
+			{Time: start.Add(2 * time.Minute), CPU: 10, Instances: 2, Change: -1},
+		}))
+	})
+
+	It("spreads the recorded load over the simulated instances", func() {
+		samples := samplesAt(90, 90)
+		samples[0].Instances = 2
+		samples[1].Instances = 2
+
+		result, err := plugin.Simulate(binding, samples, time.Minute, 3)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Steps[0].CPU).To(Equal(60.0))
+		Expect(result.Steps[0].Change).To(Equal(0))
+	})
+
+	It("doesn't scale when the policy is disabled", func() {
+		binding.Enabled = false
+
+		result, err := plugin.Simulate(binding, samplesAt(90, 90), time.Minute, 0)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Summary.ScaleUps).To(Equal(0))
+		Expect(result.Summary.MaxInstances).To(Equal(2))
+	})
+
+	Context("failure cases", func() {
+		It("rejects inconsistent limits", func() {
+			binding.MinInstances = 5
+
+			_, err := plugin.Simulate(binding, samplesAt(90), time.Minute, 0)
+			Expect(err).To(MatchError("min instances must be <= max instances"))
+		})
+
+		It("rejects an empty series", func() {
+			_, err := plugin.Simulate(binding, nil, time.Minute, 0)
+			Expect(err).To(MatchError("no samples to simulate"))
+		})
+	})
+
+	Describe("RenderSimulation", func() {
+		It("prints the timeline and the summary", func() {
+			result, err := plugin.Simulate(binding, samplesAt(90, 50), time.Minute, 0)
+			Expect(err).NotTo(HaveOccurred())
+
+			buffer := &bytes.Buffer{}
+			plugin.RenderSimulation(buffer, result)
+			Expect(buffer.String()).To(Equal(`TIME                  CPU    INSTANCES  ACTION
+2016-06-08T16:00:00Z  90.0%  3          scale up
+2016-06-08T16:01:00Z  50.0%  3          
+
+Summary:
+  intervals:                                     2
+  scale ups:                                     1
+  scale downs:                                   0
+  instances:                                     min 3, max 3, average 3.0
+  instance hours:                                0.1
+  intervals over max threshold at max instances: 0
+`))
+		})
+	})
+})
@@ -0,0 +1,255 @@
+package plugin
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/signal"
+	"time"
+)
+
+const (
+	maxStatusEvents    = 5
+	maxWatchInterval   = time.Minute
+	clearScreenControl = "\033[H\033[2J"
+)
+
+type ScalingEvent struct {
+	Timestamp string
+	Actor     string
+	Instances int
+}
+
+type Status struct {
+	Binding          AutoscalingBinding
+	Instances        int
+	RunningInstances int
+	Events           []ScalingEvent
+}
+
+func (p *Plugin) FetchStatus(dependencies CLIDependencies) (Status, error) {
+	binding, err := p.fetchBinding(dependencies)
+	if err != nil {
+		return Status{}, err
+	}
+
+	var summary struct {
+		Instances        int `json:"instances"`
+		RunningInstances int `json:"running_instances"`
+	}
+
+	err = getCCResource(dependencies, fmt.Sprintf("/v2/apps/%s/summary", dependencies.App.Guid), &summary)
+	if err != nil {
+		return Status{}, fmt.Errorf("couldn't retrieve app summary: %s", err)
+	}
+
+	// scaling shows up in cloud controller as an app update that changes the instance count
+	eventsURL, err := getCCURL(dependencies.APIEndpoint, "/v2/events", url.Values{
+		"q": []string{
+			fmt.Sprintf("actee:%s", dependencies.App.Guid),
+			"type:audit.app.update",
+		},
+		"order-direction":  []string{"desc"},
+		"results-per-page": []string{"50"},
+	})
+	if err != nil {
+		return Status{}, err
+	}
+
+	var eventsResponse struct {
+		Resources []struct {
+			Entity struct {
+				Timestamp string `json:"timestamp"`
+				ActorName string `json:"actor_name"`
+				Metadata  struct {
+					Request struct {
+						Instances *int `json:"instances"`
+					} `json:"request"`
+				} `json:"metadata"`
+			} `json:"entity"`
+		} `json:"resources"`
+	}
+
+	err = dependencies.JSONClient.Do("GET", eventsURL, nil, &eventsResponse)
+	if err != nil {
+		return Status{}, fmt.Errorf("couldn't retrieve app events: %s", err)
+	}
+
+	var events []ScalingEvent
+	for _, resource := range eventsResponse.Resources {
+		if resource.Entity.Metadata.Request.Instances == nil {
+			continue
+		}
+
+		events = append(events, ScalingEvent{
+			Timestamp: resource.Entity.Timestamp,
+			Actor:     resource.Entity.ActorName,
+			Instances: *resource.Entity.Metadata.Request.Instances,
+		})
+
+		if len(events) == maxStatusEvents {
+			break
+		}
+	}
+
+	return Status{
+		Binding:          binding.Binding,
+		Instances:        summary.Instances,
+		RunningInstances: summary.RunningInstances,
+		Events:           events,
+	}, nil
+}
+
+// RenderStatus writes a compact view of status. When previous is given, lines
+// whose values changed since then are marked with a '*'.
+func RenderStatus(w io.Writer, appName, serviceName string, status Status, previous *Status) {
+	var before Status
+	if previous != nil {
+		before = *previous
+	}
+
+	marker := func(changed bool) string {
+		if previous != nil && changed {
+			return "*"
+		}
+		return " "
+	}
+
+	fmt.Fprintf(w, "Autoscaling status for %s (%s)\n\n", appName, serviceName)
+	fmt.Fprintf(w, "%s enabled:         %t\n",
+		marker(before.Binding.Enabled != status.Binding.Enabled),
+		status.Binding.Enabled)
+	fmt.Fprintf(w, "%s instances:       %d of %d running\n",
+		marker(before.Instances != status.Instances || before.RunningInstances != status.RunningInstances),
+		status.RunningInstances, status.Instances)
+	fmt.Fprintf(w, "%s instance limits: %d - %d\n",
+		marker(before.Binding.MinInstances != status.Binding.MinInstances || before.Binding.MaxInstances != status.Binding.MaxInstances),
+		status.Binding.MinInstances, status.Binding.MaxInstances)
+	fmt.Fprintf(w, "%s cpu thresholds:  %d%% - %d%%\n",
+		marker(before.Binding.CPUMinThreshold != status.Binding.CPUMinThreshold || before.Binding.CPUMaxThreshold != status.Binding.CPUMaxThreshold),
+		status.Binding.CPUMinThreshold, status.Binding.CPUMaxThreshold)
+
+	fmt.Fprintf(w, "\nRecent scaling events:\n")
+	if len(status.Events) == 0 {
+		fmt.Fprintf(w, "  none\n")
+	}
+
+	for _, event := range status.Events {
+		seen := false
+		for _, previousEvent := range before.Events {
+			if previousEvent == event {
+				seen = true
+				break
+			}
+		}
+
+		fmt.Fprintf(w, "%s %s  scaled to %d instances by %s\n", marker(!seen), event.Timestamp, event.Instances, event.Actor)
+	}
+}
+
+type StatusWatcher struct {
+	Fetch       func() (Status, error)
+	Render      func(w io.Writer, status Status, previous *Status)
+	Out         io.Writer
+	Interval    time.Duration
+	MaxInterval time.Duration
+	After       func(time.Duration) <-chan time.Time
+}
+
+// Watch fetches and redraws the status every Interval until stop is closed.
+// Failed fetches double the interval, up to MaxInterval, until one succeeds.
+func (w StatusWatcher) Watch(stop <-chan struct{}) {
+	var previous *Status
+	interval := w.Interval
+
+	for {
+		status, err := w.Fetch()
+		if err != nil {
+			interval *= 2
+			if interval > w.MaxInterval {
+				interval = w.MaxInterval
+			}
+
+			fmt.Fprintf(w.Out, "couldn't fetch status: %s (retrying in %s)\n", err, interval)
+		} else {
+			interval = w.Interval
+
+			fmt.Fprint(w.Out, clearScreenControl)
+			fmt.Fprintf(w.Out, "Every %s, press Ctrl-C to stop\n\n", w.Interval)
+			w.Render(w.Out, status, previous)
+			previous = &status
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-w.After(interval):
+		}
+	}
+}
+
+func (p *Plugin) runStatus(cliConnection cliConnection, args []string) error {
+	var (
+		watch    bool
+		interval time.Duration
+	)
+
+	flagSet := flag.NewFlagSet("autoscaling-status", flag.ContinueOnError)
+	flagSet.BoolVar(&watch, "watch", false, "(optional) keep polling and redraw the status until interrupted")
+	flagSet.DurationVar(&interval, "interval", 5*time.Second, "(optional) time between polls when watching")
+	err := flagSet.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if interval <= 0 {
+		return fmt.Errorf("interval must be positive")
+	}
+
+	dependencies, err := p.FetchCLIDependencies(cliConnection, flagSet.Args())
+	if err != nil {
+		return err
+	}
+
+	render := func(w io.Writer, status Status, previous *Status) {
+		RenderStatus(w, dependencies.AppName, dependencies.ServiceName, status, previous)
+	}
+
+	if !watch {
+		status, err := p.FetchStatus(dependencies)
+		if err != nil {
+			return err
+		}
+
+		render(os.Stdout, status, nil)
+		return nil
+	}
+
+	maxInterval := maxWatchInterval
+	if interval > maxInterval {
+		maxInterval = interval
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	defer signal.Stop(signals)
+
+	stop := make(chan struct{})
+	go func() {
+		<-signals
+		close(stop)
+	}()
+
+	StatusWatcher{
+		Fetch:       func() (Status, error) { return p.FetchStatus(dependencies) },
+		Render:      render,
+		Out:         os.Stdout,
+		Interval:    interval,
+		MaxInterval: maxInterval,
+		After:       time.After,
+	}.Watch(stop)
+
+	return nil
+}
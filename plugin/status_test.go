@@ -0,0 +1,214 @@
+package plugin_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"time"
+
+	"code.cloudfoundry.org/cli/plugin/models"
+	"github.com/phopper-pivotal/autoscaling-cli-plugin/mocks"
+	"github.com/phopper-pivotal/autoscaling-cli-plugin/plugin"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Status", func() {
+	Describe("FetchStatus", func() {
+		var (
+			p            *plugin.Plugin
+			jsonClient   *mocks.JSONClient
+			dependencies plugin.CLIDependencies
+		)
+
+		BeforeEach(func() {
+			p = plugin.NewPlugin()
+			jsonClient = mocks.NewJSONClient(4)
+
+			jsonClient.DoCalls[0].ResponseJSON = `{"Resources": [{"Metadata": {"GUID": "some-service-binding-guid"}}]}`
+			jsonClient.DoCalls[1].ResponseJSON = `{
+				"min_instances": 3,
+				"max_instances": 7,
+				"cpu_min_threshold": 20,
+				"cpu_max_threshold": 80,
+				"enabled": true
+			}`
+			jsonClient.DoCalls[2].ResponseJSON = `{"instances": 5, "running_instances": 4}`
+			jsonClient.DoCalls[3].ResponseJSON = `{
+				"resources": [
+					{"entity": {"timestamp": "2016-06-08T16:41:45Z", "actor_name": "autoscaler", "metadata": {"request": {"instances": 5}}}},
+					{"entity": {"timestamp": "2016-06-08T16:40:45Z", "actor_name": "someone", "metadata": {"request": {"memory": 512}}}},
+					{"entity": {"timestamp": "2016-06-08T16:35:45Z", "actor_name": "autoscaler", "metadata": {"request": {"instances": 4}}}}
+				]
+			}`
+
+			dependencies = plugin.CLIDependencies{
+				AppName:     "app-name",
+				ServiceName: "service-name",
+				Service: plugin_models.GetService_Model{
+					Guid:         "some-service-instance-guid",
+					DashboardUrl: "http://autoscaling.example.com/something-that-doesnot-matter",
+				},
+				APIEndpoint: "https://cloudcontroller.example.com",
+				App: plugin_models.GetAppModel{
+					Guid: "some-app-guid",
+				},
+				JSONClient: jsonClient,
+			}
+		})
+
+		It("combines the binding, the app's instances and its recent scaling events", func() {
+			status, err := p.FetchStatus(dependencies)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(status).To(Equal(plugin.Status{
+				Binding: plugin.AutoscalingBinding{
+					MinInstances:    3,
+					MaxInstances:    7,
+					CPUMinThreshold: 20,
+					CPUMaxThreshold: 80,
+					Enabled:         true,
+				},
+				Instances:        5,
+				RunningInstances: 4,
+				Events: []plugin.ScalingEvent{
+					{Timestamp: "2016-06-08T16:41:45Z", Actor: "autoscaler", Instances: 5},
+					{Timestamp: "2016-06-08T16:35:45Z", Actor: "autoscaler", Instances: 4},
+				},
+			}))
+
+			Expect(jsonClient.DoCalls[2].Receives.URL).To(Equal("https://cloudcontroller.example.com/v2/apps/some-app-guid/summary"))
+			Expect(jsonClient.DoCalls[3].Receives.URL).To(Equal("https://cloudcontroller.example.com/v2/events?order-direction=desc&q=actee%3Asome-app-guid&q=type%3Aaudit.app.update&results-per-page=50"))
+		})
+
+		Context("when fetching the app summary fails", func() {
+			It("returns an error", func() {
+				jsonClient.DoCalls[2].Returns.Error = errors.New("some error")
+
+				_, err := p.FetchStatus(dependencies)
+				Expect(err).To(MatchError("couldn't retrieve app summary: some error"))
+			})
+		})
+
+		Context("when fetching the app events fails", func() {
+			It("returns an error", func() {
+				jsonClient.DoCalls[3].Returns.Error = errors.New("some error")
+
+				_, err := p.FetchStatus(dependencies)
+				Expect(err).To(MatchError("couldn't retrieve app events: some error"))
+			})
+		})
+	})
+
+	Describe("RenderStatus", func() {
+		var status plugin.Status
+
+		BeforeEach(func() {
+			status = plugin.Status{
+				Binding: plugin.AutoscalingBinding{
+					MinInstances:    3,
+					MaxInstances:    7,
+					CPUMinThreshold: 20,
+					CPUMaxThreshold: 80,
+					Enabled:         true,
+				},
+				Instances:        5,
+				RunningInstances: 4,
+				Events: []plugin.ScalingEvent{
+					{Timestamp: "2016-06-08T16:41:45Z", Actor: "autoscaler", Instances: 5},
+				},
+			}
+		})
+
+		It("renders a compact view of the status", func() {
+			buffer := &bytes.Buffer{}
+			plugin.RenderStatus(buffer, "app-name", "service-name", status, nil)
+			Expect(buffer.String()).To(Equal(`Autoscaling status for app-name (service-name)
+
+  enabled:         true
+  instances:       4 of 5 running
+  instance limits: 3 - 7
+  cpu thresholds:  20% - 80%
+
+Recent scaling events:
+  2016-06-08T16:41:45Z  scaled to 5 instances by autoscaler
+`))
+		})
+
+		It("marks values that changed since the previous status", func() {
+			previous := status
+			previous.Instances = 4
+			previous.Events = nil
+
+			buffer := &bytes.Buffer{}
+			plugin.RenderStatus(buffer, "app-name", "service-name", status, &previous)
+			Expect(buffer.String()).To(ContainSubstring("  enabled:         true\n"))
+			Expect(buffer.String()).To(ContainSubstring("* instances:       4 of 5 running\n"))
+			Expect(buffer.String()).To(ContainSubstring("  instance limits: 3 - 7\n"))
+			Expect(buffer.String()).To(ContainSubstring("* 2016-06-08T16:41:45Z  scaled to 5 instances by autoscaler\n"))
+		})
+	})
+
+	Describe("StatusWatcher", func() {
+		var (
+			watcher    plugin.StatusWatcher
+			out        *bytes.Buffer
+			fetchCount int
+			fetchErrs  []error
+			waits      []time.Duration
+			stop       chan struct{}
+		)
+
+		BeforeEach(func() {
+			out = &bytes.Buffer{}
+			fetchCount = 0
+			fetchErrs = nil
+			waits = nil
+			stop = make(chan struct{})
+
+			watcher = plugin.StatusWatcher{
+				Fetch: func() (plugin.Status, error) {
+					var err error
+					if fetchCount < len(fetchErrs) {
+						err = fetchErrs[fetchCount]
+					}
+					fetchCount++
+					return plugin.Status{Instances: fetchCount}, err
+				},
+				Render: func(w io.Writer, status plugin.Status, previous *plugin.Status) {
+					io.WriteString(w, "rendered\n")
+				},
+				Out:         out,
+				Interval:    5 * time.Second,
+				MaxInterval: 15 * time.Second,
+				After: func(d time.Duration) <-chan time.Time {
+					waits = append(waits, d)
+					if len(waits) == 5 {
+						close(stop)
+						return nil
+					}
+
+					c := make(chan time.Time, 1)
+					c <- time.Time{}
+					return c
+				},
+			}
+		})
+
+		It("polls at the interval until stopped", func() {
+			watcher.Watch(stop)
+			Expect(fetchCount).To(Equal(5))
+			Expect(waits).To(Equal([]time.Duration{5 * time.Second, 5 * time.Second, 5 * time.Second, 5 * time.Second, 5 * time.Second}))
+			Expect(out.String()).To(ContainSubstring("Every 5s, press Ctrl-C to stop"))
+		})
+
+		It("backs off while fetching fails", func() {
+			someError := errors.New("some error")
+			fetchErrs = []error{someError, someError, someError}
+
+			watcher.Watch(stop)
+			Expect(waits).To(Equal([]time.Duration{10 * time.Second, 15 * time.Second, 15 * time.Second, 5 * time.Second, 5 * time.Second}))
+			Expect(out.String()).To(ContainSubstring("couldn't fetch status: some error (retrying in 10s)"))
+		})
+	})
+})
@@ -0,0 +1,356 @@
+package plugin
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"code.cloudfoundry.org/cli/plugin/models"
+)
+
+const (
+	targetEnv       = "AUTOSCALING_TARGET"
+	clientIDEnv     = "AUTOSCALING_CLIENT_ID"
+	clientSecretEnv = "AUTOSCALING_CLIENT_SECRET"
+	apiEnv          = "AUTOSCALING_API"
+	orgEnv          = "AUTOSCALING_ORG"
+	spaceEnv        = "AUTOSCALING_SPACE"
+
+	// environmentTarget names the target given with environment variables
+	environmentTarget = "from environment"
+)
+
+// Target is a named foundation to run commands against instead of the one
+// the cf cli is logged in to, e.g.
+//
+//	api: https://api.sys.east.example.com
+//	refresh_token: ...
+//	skip_ssl_validation: true
+//	org: some-org
+//	space: some-space
+//
+// It authenticates with refresh_token if set, and otherwise with the
+// client_id and client_secret.
+type Target struct {
+	API               string `yaml:"api"`
+	RefreshToken      Secret `yaml:"refresh_token,omitempty"`
+	ClientID          string `yaml:"client_id,omitempty"`
+	ClientSecret      Secret `yaml:"client_secret,omitempty"`
+	SkipSSLValidation bool   `yaml:"skip_ssl_validation,omitempty"`
+	Org               string `yaml:"org,omitempty"`
+	Space             string `yaml:"space,omitempty"`
+	AutoscalerAPI     string `yaml:"autoscaler_api,omitempty"`
+}
+
+// Target returns the named target.
+func (c Config) Target(name string) (Target, error) {
+	target, ok := c.Targets[name]
+	if !ok {
+		var names []string
+		for name := range c.Targets {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		if len(names) == 0 {
+			return Target{}, fmt.Errorf("unknown target %s, no targets are configured in %s", name, DefaultConfigPath())
+		}
+		return Target{}, fmt.Errorf("unknown target %s, use one of: %s", name, strings.Join(names, ", "))
+	}
+
+	if target.API == "" {
+		return Target{}, fmt.Errorf("target %s has no api", name)
+	}
+
+	if target.RefreshToken == "" && (target.ClientID == "" || target.ClientSecret == "") {
+		return Target{}, fmt.Errorf("target %s needs a refresh_token, or a client_id and client_secret", name)
+	}
+
+	return target, nil
+}
+
+// TargetFromEnvironment returns the target given with AUTOSCALING_CLIENT_ID
+// and AUTOSCALING_CLIENT_SECRET, for pipelines that can't log in to the cf
+// cli. It runs against AUTOSCALING_API, or the cf cli's API end-point, in
+// AUTOSCALING_ORG and AUTOSCALING_SPACE.
+func TargetFromEnvironment(cliConnection cliConnection) (Target, bool, error) {
+	clientID := os.Getenv(clientIDEnv)
+	if clientID == "" {
+		return Target{}, false, nil
+	}
+
+	clientSecret := Secret(os.Getenv(clientSecretEnv))
+	if clientSecret == "" {
+		return Target{}, false, fmt.Errorf("set %s along with %s", clientSecretEnv, clientIDEnv)
+	}
+
+	target := Target{
+		API:          os.Getenv(apiEnv),
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Org:          os.Getenv(orgEnv),
+		Space:        os.Getenv(spaceEnv),
+	}
+
+	if target.API == "" {
+		apiEndpoint, err := cliConnection.ApiEndpoint()
+		if err != nil {
+			return Target{}, false, fmt.Errorf("couldn't get API end-point: %s", err)
+		}
+		if apiEndpoint == "" {
+			return Target{}, false, fmt.Errorf("set %s, or the cf cli's API end-point with cf api", apiEnv)
+		}
+		target.API = apiEndpoint
+
+		skipVerifySSL, err := cliConnection.IsSSLDisabled()
+		if err != nil {
+			return Target{}, false, fmt.Errorf("couldn't check if ssl verification is disabled: %s", err)
+		}
+		target.SkipSSLValidation = skipVerifySSL
+	}
+
+	return target, true, nil
+}
+
+// TargetConnection gives the plugin what it would otherwise get from the cf
+// cli, for a target.
+type TargetConnection struct {
+	Name   string
+	Target Target
+
+	tokens       *UAATokenSource
+	dependencies CLIDependencies
+	org          *plugin_models.Organization
+	space        *plugin_models.Space
+}
+
+// ConnectTarget logs in to the target's UAA.
+func ConnectTarget(name string, target Target, client httpClient) (*TargetConnection, error) {
+	uaa, err := discoverUAA(client, target.API)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens := &UAATokenSource{
+		UAA:          uaa,
+		ClientID:     target.ClientID,
+		ClientSecret: target.ClientSecret,
+		RefreshToken: target.RefreshToken,
+	}
+	if tokens.RefreshToken != "" && tokens.ClientID == "" {
+		tokens.ClientID = defaultUAAClientID
+	}
+
+	// log in straight away so bad credentials are reported as such
+	accessToken, err := tokens.Token()
+	if err != nil {
+		return nil, fmt.Errorf("couldn't log in to target %s: %s", name, err)
+	}
+
+	return &TargetConnection{
+		Name:   name,
+		Target: target,
+		tokens: tokens,
+		dependencies: CLIDependencies{
+			AccessToken: accessToken,
+			APIEndpoint: target.API,
+			JSONClient:  JSONClient{HTTPClient: client, TokenSource: tokens},
+		},
+	}, nil
+}
+
+func (c *TargetConnection) IsLoggedIn() (bool, error) {
+	return true, nil
+}
+
+func (c *TargetConnection) AccessToken() (string, error) {
+	return c.tokens.Token()
+}
+
+func (c *TargetConnection) ApiEndpoint() (string, error) {
+	return c.Target.API, nil
+}
+
+func (c *TargetConnection) IsSSLDisabled() (bool, error) {
+	return c.Target.SkipSSLValidation, nil
+}
+
+func (c *TargetConnection) GetCurrentOrg() (plugin_models.Organization, error) {
+	if c.org != nil {
+		return *c.org, nil
+	}
+
+	if c.Target.Org == "" {
+		return plugin_models.Organization{}, fmt.Errorf("target %s has no org", c.Name)
+	}
+
+	org, found, err := findInSpace(c.dependencies, "/v2/organizations", c.Target.Org)
+	if err != nil {
+		return plugin_models.Organization{}, err
+	}
+	if !found {
+		return plugin_models.Organization{}, fmt.Errorf("couldn't find org %s", c.Target.Org)
+	}
+
+	c.org = &plugin_models.Organization{}
+	c.org.Guid, c.org.Name = org.Metadata.GUID, c.Target.Org
+	return *c.org, nil
+}
+
+func (c *TargetConnection) GetCurrentSpace() (plugin_models.Space, error) {
+	if c.space != nil {
+		return *c.space, nil
+	}
+
+	if c.Target.Space == "" {
+		return plugin_models.Space{}, fmt.Errorf("target %s has no space", c.Name)
+	}
+
+	org, err := c.GetCurrentOrg()
+	if err != nil {
+		return plugin_models.Space{}, err
+	}
+
+	space, found, err := findInSpace(c.dependencies, fmt.Sprintf("/v2/organizations/%s/spaces", org.Guid), c.Target.Space)
+	if err != nil {
+		return plugin_models.Space{}, err
+	}
+	if !found {
+		return plugin_models.Space{}, fmt.Errorf("couldn't find space %s in org %s", c.Target.Space, org.Name)
+	}
+
+	c.space = &plugin_models.Space{}
+	c.space.Guid, c.space.Name = space.Metadata.GUID, c.Target.Space
+	return *c.space, nil
+}
+
+func (c *TargetConnection) GetApp(name string) (plugin_models.GetAppModel, error) {
+	space, err := c.GetCurrentSpace()
+	if err != nil {
+		return plugin_models.GetAppModel{}, err
+	}
+
+	app, found, err := findInSpace(c.dependencies, fmt.Sprintf("/v2/spaces/%s/apps", space.Guid), name)
+	if err != nil {
+		return plugin_models.GetAppModel{}, err
+	}
+	if !found {
+		return plugin_models.GetAppModel{}, fmt.Errorf("app %s not found", name)
+	}
+
+	var summary struct {
+		Name             string `json:"name"`
+		State            string `json:"state"`
+		Instances        int    `json:"instances"`
+		RunningInstances int    `json:"running_instances"`
+		SpaceGUID        string `json:"space_guid"`
+		Services         []struct {
+			GUID string `json:"guid"`
+			Name string `json:"name"`
+		} `json:"services"`
+	}
+	err = getCCResource(c.dependencies, fmt.Sprintf("/v2/apps/%s/summary", app.Metadata.GUID), &summary)
+	if err != nil {
+		return plugin_models.GetAppModel{}, err
+	}
+
+	model := plugin_models.GetAppModel{
+		Guid:             app.Metadata.GUID,
+		Name:             summary.Name,
+		State:            summary.State,
+		InstanceCount:    summary.Instances,
+		RunningInstances: summary.RunningInstances,
+		SpaceGuid:        summary.SpaceGUID,
+	}
+	for _, service := range summary.Services {
+		model.Services = append(model.Services, plugin_models.GetApp_ServiceSummary{Guid: service.GUID, Name: service.Name})
+	}
+
+	return model, nil
+}
+
+func (c *TargetConnection) GetService(name string) (plugin_models.GetService_Model, error) {
+	space, err := c.GetCurrentSpace()
+	if err != nil {
+		return plugin_models.GetService_Model{}, err
+	}
+
+	var summary struct {
+		Services []struct {
+			GUID         string `json:"guid"`
+			Name         string `json:"name"`
+			DashboardURL string `json:"dashboard_url"`
+			ServicePlan  struct {
+				GUID    string `json:"guid"`
+				Name    string `json:"name"`
+				Service struct {
+					Label string `json:"label"`
+				} `json:"service"`
+			} `json:"service_plan"`
+		} `json:"services"`
+	}
+	err = getCCResource(c.dependencies, fmt.Sprintf("/v2/spaces/%s/summary", space.Guid), &summary)
+	if err != nil {
+		return plugin_models.GetService_Model{}, err
+	}
+
+	for _, service := range summary.Services {
+		if service.Name != name {
+			continue
+		}
+
+		model := plugin_models.GetService_Model{
+			Guid:         service.GUID,
+			Name:         service.Name,
+			DashboardUrl: service.DashboardURL,
+		}
+		model.ServiceOffering.Name = service.ServicePlan.Service.Label
+		model.ServicePlan.Guid, model.ServicePlan.Name = service.ServicePlan.GUID, service.ServicePlan.Name
+		return model, nil
+	}
+
+	return plugin_models.GetService_Model{}, fmt.Errorf("service instance %s not found", name)
+}
+
+// selectTarget returns a connection to the target given with --target,
+// AUTOSCALING_TARGET or client credentials in the environment, or the cf
+// cli's own connection if there isn't one.
+func (p *Plugin) selectTarget(cliConnection cliConnection, config Config, name string) (cliConnection, error) {
+	if name == "" {
+		name = os.Getenv(targetEnv)
+	}
+
+	var target Target
+	if name == "" {
+		var found bool
+		var err error
+		target, found, err = TargetFromEnvironment(cliConnection)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			return cliConnection, nil
+		}
+		name = environmentTarget
+	} else {
+		var err error
+		target, err = config.Target(name)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if p.AutoscalerAPI == "" {
+		p.AutoscalerAPI = target.AutoscalerAPI
+	}
+
+	options := p.TLS
+	options.SkipVerify = options.SkipVerify || target.SkipSSLValidation
+	client, err := newHTTPClient(options, p.Proxy, p.requestHeaders())
+	if err != nil {
+		return nil, err
+	}
+
+	return ConnectTarget(name, target, client)
+}
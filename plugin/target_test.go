@@ -0,0 +1,286 @@
+package plugin_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+
+	"code.cloudfoundry.org/cli/plugin/models"
+	"github.com/phopper-pivotal/autoscaling-cli-plugin/mocks"
+	"github.com/phopper-pivotal/autoscaling-cli-plugin/plugin"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Targets", func() {
+	Describe("Config.Target", func() {
+		var config plugin.Config
+
+		BeforeEach(func() {
+			config = plugin.Config{Targets: map[string]plugin.Target{
+				"east":    {API: "https://api.east.example.com", ClientID: "some-client", ClientSecret: "some-secret"},
+				"west":    {API: "https://api.west.example.com", ClientID: "some-client"},
+				"no-api":  {RefreshToken: "some-refresh-token"},
+				"central": {API: "https://api.central.example.com", RefreshToken: "some-refresh-token"},
+			}}
+		})
+
+		It("fails for unknown targets", func() {
+			_, err := config.Target("north")
+			Expect(err).To(MatchError("unknown target north, use one of: central, east, no-api, west"))
+		})
+
+		It("fails for targets without an api", func() {
+			_, err := config.Target("no-api")
+			Expect(err).To(MatchError("target no-api has no api"))
+		})
+
+		It("fails for targets without credentials", func() {
+			_, err := config.Target("west")
+			Expect(err).To(MatchError("target west needs a refresh_token, or a client_id and client_secret"))
+		})
+	})
+
+	Describe("TargetFromEnvironment", func() {
+		var (
+			cliConnection *mocks.CLIConnection
+			previous      map[string]string
+		)
+
+		BeforeEach(func() {
+			cliConnection = &mocks.CLIConnection{}
+			cliConnection.ApiEndpointCall.Returns.ApiEndpoint = "https://api.example.com"
+			cliConnection.IsSSLDisabledCall.Returns.Disabled = true
+
+			previous = map[string]string{}
+			for _, name := range []string{"AUTOSCALING_CLIENT_ID", "AUTOSCALING_CLIENT_SECRET", "AUTOSCALING_API", "AUTOSCALING_ORG", "AUTOSCALING_SPACE"} {
+				previous[name] = os.Getenv(name)
+				os.Unsetenv(name)
+			}
+
+			os.Setenv("AUTOSCALING_CLIENT_ID", "some-client")
+			os.Setenv("AUTOSCALING_CLIENT_SECRET", "some-secret")
+			os.Setenv("AUTOSCALING_ORG", "some-org")
+			os.Setenv("AUTOSCALING_SPACE", "some-space")
+		})
+
+		AfterEach(func() {
+			for name, value := range previous {
+				os.Setenv(name, value)
+			}
+		})
+
+		It("uses the client credentials against the cf cli's API end-point", func() {
+			target, found, err := plugin.TargetFromEnvironment(cliConnection)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(found).To(BeTrue())
+			Expect(target).To(Equal(plugin.Target{
+				API:               "https://api.example.com",
+				ClientID:          "some-client",
+				ClientSecret:      "some-secret",
+				SkipSSLValidation: true,
+				Org:               "some-org",
+				Space:             "some-space",
+			}))
+		})
+
+		It("uses AUTOSCALING_API if set", func() {
+			os.Setenv("AUTOSCALING_API", "https://api.other.example.com")
+
+			target, _, err := plugin.TargetFromEnvironment(cliConnection)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(target.API).To(Equal("https://api.other.example.com"))
+			Expect(target.SkipSSLValidation).To(BeFalse())
+		})
+
+		It("isn't used without a client id", func() {
+			os.Unsetenv("AUTOSCALING_CLIENT_ID")
+
+			_, found, err := plugin.TargetFromEnvironment(cliConnection)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(found).To(BeFalse())
+		})
+
+		It("fails without a client secret", func() {
+			os.Unsetenv("AUTOSCALING_CLIENT_SECRET")
+
+			_, _, err := plugin.TargetFromEnvironment(cliConnection)
+			Expect(err).To(MatchError("set AUTOSCALING_CLIENT_SECRET along with AUTOSCALING_CLIENT_ID"))
+		})
+
+		It("fails without an API end-point", func() {
+			cliConnection.ApiEndpointCall.Returns.ApiEndpoint = ""
+
+			_, _, err := plugin.TargetFromEnvironment(cliConnection)
+			Expect(err).To(MatchError("set AUTOSCALING_API, or the cf cli's API end-point with cf api"))
+		})
+	})
+
+	Describe("TargetConnection", func() {
+		var (
+			server     *httptest.Server
+			responses  map[string]string
+			authHeader string
+			target     plugin.Target
+		)
+
+		BeforeEach(func() {
+			responses = map[string]string{}
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/oauth/token" {
+					r.ParseForm()
+					if r.PostForm.Get("refresh_token") != "some-refresh-token" {
+						w.WriteHeader(http.StatusUnauthorized)
+						return
+					}
+					w.Write([]byte(`{"access_token": "some-access-token", "token_type": "bearer"}`))
+					return
+				}
+
+				authHeader = r.Header.Get("Authorization")
+				response, ok := responses[r.URL.RequestURI()]
+				if !ok {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				w.Write([]byte(response))
+			}))
+
+			responses["/v2/info"] = `{"token_endpoint": "` + server.URL + `"}`
+			responses["/v2/organizations?q=name%3Asome-org"] = `{"resources": [{"metadata": {"guid": "org-guid"}}]}`
+			responses["/v2/organizations/org-guid/spaces?q=name%3Asome-space"] = `{"resources": [{"metadata": {"guid": "space-guid"}}]}`
+			responses["/v2/spaces/space-guid/apps?q=name%3Aapp-name"] = `{"resources": [{"metadata": {"guid": "app-guid"}}]}`
+			responses["/v2/apps/app-guid/summary"] = `{
+				"name": "app-name",
+				"state": "STARTED",
+				"instances": 3,
+				"running_instances": 2,
+				"space_guid": "space-guid",
+				"services": [{"guid": "instance-guid", "name": "service-name"}]
+			}`
+			responses["/v2/spaces/space-guid/summary"] = `{"services": [
+				{"guid": "other-guid", "name": "other-service"},
+				{
+					"guid": "instance-guid",
+					"name": "service-name",
+					"dashboard_url": "https://autoscaling.example.com/dashboard",
+					"service_plan": {"guid": "plan-guid", "name": "standard", "service": {"label": "app-autoscaler"}}
+				}
+			]}`
+
+			target = plugin.Target{
+				API:               server.URL,
+				RefreshToken:      "some-refresh-token",
+				SkipSSLValidation: true,
+				Org:               "some-org",
+				Space:             "some-space",
+			}
+		})
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		It("logs in to the target", func() {
+			connection, err := plugin.ConnectTarget("east", target, http.DefaultClient)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(connection.IsLoggedIn()).To(BeTrue())
+			Expect(connection.AccessToken()).To(Equal("bearer some-access-token"))
+			Expect(connection.ApiEndpoint()).To(Equal(server.URL))
+			Expect(connection.IsSSLDisabled()).To(BeTrue())
+		})
+
+		It("looks up the org, space, app and service instance through cloud controller", func() {
+			connection, err := plugin.ConnectTarget("east", target, http.DefaultClient)
+			Expect(err).NotTo(HaveOccurred())
+
+			space, err := connection.GetCurrentSpace()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(space.Guid).To(Equal("space-guid"))
+			Expect(space.Name).To(Equal("some-space"))
+			Expect(authHeader).To(Equal("bearer some-access-token"))
+
+			app, err := connection.GetApp("app-name")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(app).To(Equal(plugin_models.GetAppModel{
+				Guid:             "app-guid",
+				Name:             "app-name",
+				State:            "STARTED",
+				InstanceCount:    3,
+				RunningInstances: 2,
+				SpaceGuid:        "space-guid",
+				Services:         []plugin_models.GetApp_ServiceSummary{{Guid: "instance-guid", Name: "service-name"}},
+			}))
+
+			service, err := connection.GetService("service-name")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(service.Guid).To(Equal("instance-guid"))
+			Expect(service.DashboardUrl).To(Equal("https://autoscaling.example.com/dashboard"))
+			Expect(service.ServiceOffering.Name).To(Equal("app-autoscaler"))
+			Expect(service.ServicePlan.Name).To(Equal("standard"))
+		})
+
+		It("works with FetchCLIDependencies", func() {
+			connection, err := plugin.ConnectTarget("east", target, http.DefaultClient)
+			Expect(err).NotTo(HaveOccurred())
+
+			p := plugin.NewPlugin()
+			p.Warnings = nil
+
+			dependencies, err := p.FetchCLIDependencies(connection, []string{"app-name"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(dependencies.APIEndpoint).To(Equal(server.URL))
+			Expect(dependencies.SpaceName).To(Equal("some-space"))
+			Expect(dependencies.ServiceName).To(Equal("service-name"))
+			Expect(dependencies.App.Guid).To(Equal("app-guid"))
+
+			jsonClient, ok := dependencies.JSONClient.(*plugin.JSONClient)
+			Expect(ok).To(BeTrue())
+			Expect(jsonClient.TokenSource).NotTo(BeNil())
+		})
+
+		It("finds UAA through cloud controller's root info", func() {
+			responses["/"] = `{"links": {"uaa": {"href": "` + server.URL + `"}}}`
+			delete(responses, "/v2/info")
+
+			connection, err := plugin.ConnectTarget("east", target, http.DefaultClient)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(connection.AccessToken()).To(Equal("bearer some-access-token"))
+		})
+
+		Context("when logging in fails", func() {
+			It("returns an error", func() {
+				target.RefreshToken = "expired-refresh-token"
+
+				_, err := plugin.ConnectTarget("east", target, http.DefaultClient)
+				Expect(err).To(MatchError("couldn't log in to target east: couldn't get a token from UAA: unexpected response code: 401 Unauthorized"))
+			})
+		})
+
+		Context("when the target has no space", func() {
+			It("returns an error", func() {
+				target.Space = ""
+
+				connection, err := plugin.ConnectTarget("east", target, http.DefaultClient)
+				Expect(err).NotTo(HaveOccurred())
+
+				_, err = connection.GetApp("app-name")
+				Expect(err).To(MatchError("target east has no space"))
+			})
+		})
+
+		Context("when the app doesn't exist", func() {
+			It("returns an error", func() {
+				connection, err := plugin.ConnectTarget("east", target, http.DefaultClient)
+				Expect(err).NotTo(HaveOccurred())
+
+				responses["/v2/spaces/space-guid/apps?q=name%3Aother-app"] = `{"resources": []}`
+
+				_, err = connection.GetApp("other-app")
+				Expect(err).To(MatchError("app other-app not found"))
+			})
+		})
+	})
+})
@@ -0,0 +1,106 @@
+package plugin
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+const (
+	caCertFileEnv     = "SSL_CERT_FILE"
+	clientCertFileEnv = "AUTOSCALING_CLIENT_CERT_FILE"
+	clientKeyFileEnv  = "AUTOSCALING_CLIENT_KEY_FILE"
+)
+
+// TLSOptions are the TLS settings for connections to cloud controller, UAA
+// and the autoscaler.
+type TLSOptions struct {
+	// CACertFiles are PEM bundles of CAs to trust besides the system's
+	CACertFiles []string `yaml:"ca_cert_files,omitempty"`
+
+	// ClientCertFile and ClientKeyFile are a PEM certificate and key to
+	// present to servers that ask for one
+	ClientCertFile string `yaml:"client_cert_file,omitempty"`
+	ClientKeyFile  string `yaml:"client_key_file,omitempty"`
+
+	// SkipVerify doesn't verify server certificates, unless there are CAs to
+	// verify them with
+	SkipVerify bool `yaml:"-"`
+}
+
+// ResolveTLSOptions combines the TLS settings of the config file, the
+// environment and the command line. CAs from all of them are trusted, and a
+// client certificate on the command line replaces one in the environment,
+// which replaces one in the config file.
+func ResolveTLSOptions(config TLSOptions, flags GlobalFlags) TLSOptions {
+	options := config
+	options.CACertFiles = append([]string{}, config.CACertFiles...)
+
+	if file := os.Getenv(caCertFileEnv); file != "" {
+		options.CACertFiles = append(options.CACertFiles, file)
+	}
+	options.CACertFiles = append(options.CACertFiles, flags.CACertFiles...)
+
+	if file := os.Getenv(clientCertFileEnv); file != "" {
+		options.ClientCertFile, options.ClientKeyFile = file, os.Getenv(clientKeyFileEnv)
+	}
+	if flags.ClientCertFile != "" || flags.ClientKeyFile != "" {
+		options.ClientCertFile, options.ClientKeyFile = flags.ClientCertFile, flags.ClientKeyFile
+	}
+
+	if len(options.CACertFiles) == 0 {
+		options.CACertFiles = nil
+	}
+
+	return options
+}
+
+// skipsVerification is whether server certificates won't be verified, which
+// is the last resort when there are no CAs to verify them with.
+func (o TLSOptions) skipsVerification() bool {
+	return o.SkipVerify && len(o.CACertFiles) == 0
+}
+
+// Config builds the tls.Config for the options.
+func (o TLSOptions) Config() (*tls.Config, error) {
+	config := &tls.Config{
+		InsecureSkipVerify: o.skipsVerification(),
+	}
+
+	if len(o.CACertFiles) > 0 {
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+
+		for _, file := range o.CACertFiles {
+			contents, err := ioutil.ReadFile(file)
+			if err != nil {
+				return nil, fmt.Errorf("couldn't read CA certificate file: %s", err)
+			}
+
+			if !pool.AppendCertsFromPEM(contents) {
+				return nil, fmt.Errorf("no certificates found in CA certificate file %s", file)
+			}
+		}
+
+		config.RootCAs = pool
+	}
+
+	if o.ClientCertFile != "" || o.ClientKeyFile != "" {
+		if o.ClientCertFile == "" || o.ClientKeyFile == "" {
+			return nil, fmt.Errorf("provide both a client certificate and its key")
+		}
+
+		certificate, err := tls.LoadX509KeyPair(o.ClientCertFile, o.ClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't load client certificate: %s", err)
+		}
+
+		config.Certificates = []tls.Certificate{certificate}
+	}
+
+	return config, nil
+}
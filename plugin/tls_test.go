@@ -0,0 +1,198 @@
+package plugin_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/phopper-pivotal/autoscaling-cli-plugin/plugin"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("TLS", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "tls")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	writePEM := func(name, blockType string, contents []byte) string {
+		path := filepath.Join(dir, name)
+		Expect(ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: contents}), 0600)).To(Succeed())
+		return path
+	}
+
+	writeClientCertificate := func() (string, string) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		Expect(err).NotTo(HaveOccurred())
+
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(1),
+			Subject:      pkix.Name{CommonName: "some-client"},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		}
+		certificate, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+		Expect(err).NotTo(HaveOccurred())
+
+		keyBytes, err := x509.MarshalECPrivateKey(key)
+		Expect(err).NotTo(HaveOccurred())
+
+		return writePEM("client.pem", "CERTIFICATE", certificate), writePEM("client-key.pem", "EC PRIVATE KEY", keyBytes)
+	}
+
+	Describe("TLSOptions.Config", func() {
+		var server *httptest.Server
+
+		BeforeEach(func() {
+			server = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if len(r.TLS.PeerCertificates) > 0 {
+					w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+				}
+			}))
+			server.TLS = &tls.Config{ClientAuth: tls.RequestClientCert}
+			server.StartTLS()
+		})
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		get := func(options plugin.TLSOptions) (string, error) {
+			config, err := options.Config()
+			Expect(err).NotTo(HaveOccurred())
+
+			client := &http.Client{Transport: &http.Transport{TLSClientConfig: config}}
+			response, err := client.Get(server.URL)
+			if err != nil {
+				return "", err
+			}
+			defer response.Body.Close()
+
+			body, err := ioutil.ReadAll(response.Body)
+			return string(body), err
+		}
+
+		It("trusts the given CAs", func() {
+			caFile := writePEM("ca.pem", "CERTIFICATE", server.Certificate().Raw)
+
+			_, err := get(plugin.TLSOptions{})
+			Expect(err).To(MatchError(ContainSubstring("certificate")))
+
+			_, err = get(plugin.TLSOptions{CACertFiles: []string{caFile}})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("verifies certificates with the given CAs even when skipping verification", func() {
+			otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			Expect(err).NotTo(HaveOccurred())
+			template := &x509.Certificate{SerialNumber: big.NewInt(2), NotBefore: time.Now(), NotAfter: time.Now().Add(time.Hour), IsCA: true, BasicConstraintsValid: true}
+			otherCA, err := x509.CreateCertificate(rand.Reader, template, template, &otherKey.PublicKey, otherKey)
+			Expect(err).NotTo(HaveOccurred())
+			caFile := writePEM("other-ca.pem", "CERTIFICATE", otherCA)
+
+			_, err = get(plugin.TLSOptions{CACertFiles: []string{caFile}, SkipVerify: true})
+			Expect(err).To(MatchError(ContainSubstring("certificate")))
+
+			_, err = get(plugin.TLSOptions{SkipVerify: true})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("presents the client certificate", func() {
+			certFile, keyFile := writeClientCertificate()
+
+			body, err := get(plugin.TLSOptions{SkipVerify: true, ClientCertFile: certFile, ClientKeyFile: keyFile})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(body).To(Equal("some-client"))
+		})
+
+		Context("failure cases", func() {
+			It("fails when a CA file can't be read", func() {
+				_, err := plugin.TLSOptions{CACertFiles: []string{filepath.Join(dir, "missing.pem")}}.Config()
+				Expect(err).To(MatchError(ContainSubstring("couldn't read CA certificate file")))
+			})
+
+			It("fails when a CA file has no certificates", func() {
+				path := filepath.Join(dir, "empty.pem")
+				Expect(ioutil.WriteFile(path, []byte("not a certificate"), 0600)).To(Succeed())
+
+				_, err := plugin.TLSOptions{CACertFiles: []string{path}}.Config()
+				Expect(err).To(MatchError("no certificates found in CA certificate file " + path))
+			})
+
+			It("fails when the client certificate has no key", func() {
+				certFile, _ := writeClientCertificate()
+
+				_, err := plugin.TLSOptions{ClientCertFile: certFile}.Config()
+				Expect(err).To(MatchError("provide both a client certificate and its key"))
+			})
+
+			It("fails when the client certificate can't be loaded", func() {
+				_, keyFile := writeClientCertificate()
+
+				_, err := plugin.TLSOptions{ClientCertFile: keyFile, ClientKeyFile: keyFile}.Config()
+				Expect(err).To(MatchError(ContainSubstring("couldn't load client certificate")))
+			})
+		})
+	})
+
+	Describe("ResolveTLSOptions", func() {
+		var previous map[string]string
+
+		BeforeEach(func() {
+			previous = map[string]string{}
+			for _, name := range []string{"SSL_CERT_FILE", "AUTOSCALING_CLIENT_CERT_FILE", "AUTOSCALING_CLIENT_KEY_FILE"} {
+				previous[name] = os.Getenv(name)
+				os.Unsetenv(name)
+			}
+		})
+
+		AfterEach(func() {
+			for name, value := range previous {
+				os.Setenv(name, value)
+			}
+		})
+
+		It("trusts the CAs from everywhere", func() {
+			os.Setenv("SSL_CERT_FILE", "env-ca.pem")
+
+			options := plugin.ResolveTLSOptions(plugin.TLSOptions{CACertFiles: []string{"config-ca.pem"}}, plugin.GlobalFlags{CACertFiles: []string{"flag-ca.pem"}})
+			Expect(options.CACertFiles).To(Equal([]string{"config-ca.pem", "env-ca.pem", "flag-ca.pem"}))
+		})
+
+		It("takes the client certificate from the command line, then the environment, then the config file", func() {
+			config := plugin.TLSOptions{ClientCertFile: "config.pem", ClientKeyFile: "config-key.pem"}
+			Expect(plugin.ResolveTLSOptions(config, plugin.GlobalFlags{}).ClientCertFile).To(Equal("config.pem"))
+
+			os.Setenv("AUTOSCALING_CLIENT_CERT_FILE", "env.pem")
+			os.Setenv("AUTOSCALING_CLIENT_KEY_FILE", "env-key.pem")
+			options := plugin.ResolveTLSOptions(config, plugin.GlobalFlags{})
+			Expect(options.ClientCertFile).To(Equal("env.pem"))
+			Expect(options.ClientKeyFile).To(Equal("env-key.pem"))
+
+			options = plugin.ResolveTLSOptions(config, plugin.GlobalFlags{ClientCertFile: "flag.pem", ClientKeyFile: "flag-key.pem"})
+			Expect(options.ClientCertFile).To(Equal("flag.pem"))
+			Expect(options.ClientKeyFile).To(Equal("flag-key.pem"))
+		})
+	})
+})
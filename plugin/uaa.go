@@ -0,0 +1,205 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultUAAClientID = "cf"
+
+// tokenExpiryMargin is how long before it expires a token is replaced, so it
+// doesn't expire on the way to the server.
+const tokenExpiryMargin = 30 * time.Second
+
+// Secret is a credential that is never printed.
+type Secret string
+
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+
+	return "[REDACTED]"
+}
+
+func (s Secret) GoString() string {
+	return fmt.Sprintf("%q", s.String())
+}
+
+// uaaToken is a token from UAA's /oauth/token end-point.
+type uaaToken struct {
+	AccessToken  Secret `json:"access_token"`
+	RefreshToken Secret `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+// UAAClient gets access tokens from the UAA of a foundation.
+type UAAClient struct {
+	HTTPClient    httpClient
+	TokenEndpoint string
+}
+
+// discoverUAA returns a UAA client for the foundation at apiEndpoint, as
+// advertised by cloud controller's root info, or by /v2/info on cloud
+// controllers without it.
+func discoverUAA(client httpClient, apiEndpoint string) (UAAClient, error) {
+	rootURL, err := getCCURL(apiEndpoint, "/", nil)
+	if err != nil {
+		return UAAClient{}, err
+	}
+
+	var root struct {
+		Links struct {
+			UAA struct {
+				Href string `json:"href"`
+			} `json:"uaa"`
+		} `json:"links"`
+	}
+	err = JSONClient{HTTPClient: client}.Do("GET", rootURL, nil, &root)
+	if err == nil && root.Links.UAA.Href != "" {
+		return UAAClient{HTTPClient: client, TokenEndpoint: root.Links.UAA.Href}, nil
+	}
+
+	infoURL, err := getCCURL(apiEndpoint, "/v2/info", nil)
+	if err != nil {
+		return UAAClient{}, err // not tested
+	}
+
+	var info struct {
+		TokenEndpoint string `json:"token_endpoint"`
+	}
+	err = JSONClient{HTTPClient: client}.Do("GET", infoURL, nil, &info)
+	if err != nil {
+		return UAAClient{}, fmt.Errorf("couldn't get the UAA end-point of %s: %s", apiEndpoint, err)
+	}
+
+	return UAAClient{HTTPClient: client, TokenEndpoint: info.TokenEndpoint}, nil
+}
+
+// Token requests a token with the grant, authenticating as the client.
+func (c UAAClient) Token(grant url.Values, clientID string, clientSecret Secret) (uaaToken, error) {
+	request, err := http.NewRequest("POST", strings.TrimSuffix(c.TokenEndpoint, "/")+"/oauth/token", strings.NewReader(grant.Encode()))
+	if err != nil {
+		return uaaToken{}, err
+	}
+
+	// UAA only url-decodes the credentials when told they are encoded, like
+	// the cf cli does, so secrets with characters such as + / = % work
+	request.SetBasicAuth(url.QueryEscape(clientID), url.QueryEscape(string(clientSecret)))
+	request.Header.Set("X-CF-ENCODED-CREDENTIALS", "true")
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+
+	response, err := c.HTTPClient.Do(request)
+	if err != nil {
+		return uaaToken{}, fmt.Errorf("couldn't get a token from UAA: %s", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return uaaToken{}, fmt.Errorf("couldn't get a token from UAA: %s", UnexpectedResponseError{StatusCode: response.StatusCode, Status: response.Status})
+	}
+
+	var token uaaToken
+	if err := json.NewDecoder(response.Body).Decode(&token); err != nil {
+		return uaaToken{}, fmt.Errorf("couldn't parse token from UAA: %s", err)
+	}
+
+	if token.TokenType == "" {
+		token.TokenType = "bearer"
+	}
+
+	return token, nil
+}
+
+// RefreshToken exchanges a refresh token, e.g. from the cf cli's config, for
+// an access token.
+func (c UAAClient) RefreshToken(refreshToken Secret, clientID string, clientSecret Secret) (uaaToken, error) {
+	return c.Token(url.Values{
+		"grant_type":    []string{"refresh_token"},
+		"refresh_token": []string{string(refreshToken)},
+	}, clientID, clientSecret)
+}
+
+// ClientCredentials gets an access token for a UAA client.
+func (c UAAClient) ClientCredentials(clientID string, clientSecret Secret) (uaaToken, error) {
+	return c.Token(url.Values{
+		"grant_type": []string{"client_credentials"},
+	}, clientID, clientSecret)
+}
+
+// authorization returns the token as an Authorization header value.
+func (t uaaToken) authorization() string {
+	return fmt.Sprintf("%s %s", strings.ToLower(t.TokenType), string(t.AccessToken))
+}
+
+// UAATokenSource gets tokens from UAA with a refresh token or, without one,
+// with client credentials, and gets a new one shortly before each expires.
+// It's safe to use from several goroutines.
+type UAATokenSource struct {
+	UAA          UAAClient
+	ClientID     string
+	ClientSecret Secret
+	RefreshToken Secret
+
+	// Now is time.Now unless it's replaced in tests
+	Now func() time.Time
+
+	mutex  sync.Mutex
+	token  uaaToken
+	expiry time.Time
+}
+
+// Token returns an Authorization header value with a current token.
+func (s *UAATokenSource) Token() (string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now
+	if s.Now != nil {
+		now = s.Now
+	}
+
+	if s.token.AccessToken != "" && (s.expiry.IsZero() || now().Before(s.expiry)) {
+		return s.token.authorization(), nil
+	}
+
+	var token uaaToken
+	var err error
+	if s.RefreshToken != "" {
+		token, err = s.UAA.RefreshToken(s.RefreshToken, s.ClientID, s.ClientSecret)
+	} else {
+		token, err = s.UAA.ClientCredentials(s.ClientID, s.ClientSecret)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	// UAA can hand out a new refresh token with each access token
+	if token.RefreshToken != "" && s.RefreshToken != "" {
+		s.RefreshToken = token.RefreshToken
+	}
+
+	s.token = token
+	s.expiry = time.Time{}
+	if token.ExpiresIn > 0 {
+		s.expiry = now().Add(time.Duration(token.ExpiresIn)*time.Second - tokenExpiryMargin)
+	}
+
+	return token.authorization(), nil
+}
+
+// String describes the token source without its credentials.
+func (s *UAATokenSource) String() string {
+	return fmt.Sprintf("UAA token source for client %s at %s", s.ClientID, s.UAA.TokenEndpoint)
+}
+
+func (s *UAATokenSource) GoString() string {
+	return s.String()
+}
@@ -0,0 +1,145 @@
+package plugin_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"time"
+
+	"github.com/phopper-pivotal/autoscaling-cli-plugin/plugin"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("UAAClient", func() {
+	var (
+		server  *httptest.Server
+		request *http.Request
+		status  int
+		uaa     plugin.UAAClient
+	)
+
+	BeforeEach(func() {
+		status = http.StatusOK
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.ParseForm()
+			request = r
+			w.WriteHeader(status)
+			w.Write([]byte(`{"access_token": "some-token", "token_type": "bearer", "expires_in": 600}`))
+		}))
+		uaa = plugin.UAAClient{HTTPClient: http.DefaultClient, TokenEndpoint: server.URL + "/"}
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("gets a token with client credentials", func() {
+		_, err := uaa.ClientCredentials("some-client", "some-secret")
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(request.Method).To(Equal("POST"))
+		Expect(request.URL.Path).To(Equal("/oauth/token"))
+		Expect(request.PostForm.Get("grant_type")).To(Equal("client_credentials"))
+		clientID, clientSecret, _ := request.BasicAuth()
+		Expect(clientID).To(Equal("some-client"))
+		Expect(clientSecret).To(Equal("some-secret"))
+	})
+
+	It("encodes the client credentials and says so", func() {
+		_, err := uaa.ClientCredentials("some client", "a+b/c=d%e")
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(request.Header.Get("X-CF-ENCODED-CREDENTIALS")).To(Equal("true"))
+		clientID, clientSecret, _ := request.BasicAuth()
+		Expect(clientSecret).To(Equal("a%2Bb%2Fc%3Dd%25e"))
+		Expect(url.QueryUnescape(clientID)).To(Equal("some client"))
+		Expect(url.QueryUnescape(clientSecret)).To(Equal("a+b/c=d%e"))
+	})
+
+	It("exchanges a refresh token", func() {
+		_, err := uaa.RefreshToken("some-refresh-token", "cf", "")
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(request.PostForm.Get("grant_type")).To(Equal("refresh_token"))
+		Expect(request.PostForm.Get("refresh_token")).To(Equal("some-refresh-token"))
+	})
+
+	Context("when UAA rejects the request", func() {
+		It("returns an error", func() {
+			status = http.StatusUnauthorized
+
+			_, err := uaa.ClientCredentials("some-client", "wrong-secret")
+			Expect(err).To(MatchError("couldn't get a token from UAA: unexpected response code: 401 Unauthorized"))
+		})
+	})
+
+	Describe("UAATokenSource", func() {
+		var (
+			tokenCount int
+			now        time.Time
+			tokens     *plugin.UAATokenSource
+		)
+
+		BeforeEach(func() {
+			tokenCount = 0
+			now = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+			server.Close()
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				r.ParseForm()
+				request = r
+				tokenCount++
+				fmt.Fprintf(w, `{"access_token": "token-%d", "refresh_token": "refresh-token-%d", "token_type": "bearer", "expires_in": 600}`, tokenCount, tokenCount)
+			}))
+
+			tokens = &plugin.UAATokenSource{
+				UAA:          plugin.UAAClient{HTTPClient: http.DefaultClient, TokenEndpoint: server.URL},
+				ClientID:     "some-client",
+				ClientSecret: "some-secret",
+				Now:          func() time.Time { return now },
+			}
+		})
+
+		It("reuses the token until shortly before it expires", func() {
+			Expect(tokens.Token()).To(Equal("bearer token-1"))
+
+			now = now.Add(9 * time.Minute)
+			Expect(tokens.Token()).To(Equal("bearer token-1"))
+
+			now = now.Add(45 * time.Second)
+			Expect(tokens.Token()).To(Equal("bearer token-2"))
+			Expect(request.PostForm.Get("grant_type")).To(Equal("client_credentials"))
+		})
+
+		It("uses the newest refresh token", func() {
+			tokens.RefreshToken = "some-refresh-token"
+
+			Expect(tokens.Token()).To(Equal("bearer token-1"))
+			Expect(request.PostForm.Get("refresh_token")).To(Equal("some-refresh-token"))
+
+			now = now.Add(time.Hour)
+			Expect(tokens.Token()).To(Equal("bearer token-2"))
+			Expect(request.PostForm.Get("refresh_token")).To(Equal("refresh-token-1"))
+		})
+
+		It("never prints the credentials or tokens", func() {
+			tokens.RefreshToken = "some-refresh-token"
+			Expect(tokens.Token()).To(Equal("bearer token-1"))
+
+			for _, format := range []string{"%s", "%v", "%+v", "%#v"} {
+				printed := fmt.Sprintf(format, tokens)
+				Expect(printed).NotTo(ContainSubstring("some-secret"))
+				Expect(printed).NotTo(ContainSubstring("some-refresh-token"))
+				Expect(printed).NotTo(ContainSubstring("token-1"))
+			}
+
+			target := plugin.Target{API: "https://api.example.com", ClientID: "some-client", ClientSecret: "some-secret"}
+			for _, format := range []string{"%v", "%+v", "%#v"} {
+				Expect(fmt.Sprintf(format, target)).NotTo(ContainSubstring("some-secret"))
+			}
+		})
+	})
+})
@@ -0,0 +1,143 @@
+package plugin
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// UI is where the plugin asks the user questions.
+type UI struct {
+	In  io.Reader
+	Out io.Writer
+
+	// Interactive is false when there's nobody to answer, e.g. when stdin is
+	// a pipe in a CI job
+	Interactive bool
+}
+
+// NewUI returns a UI on stdin and stdout, which is interactive when stdin is
+// a terminal.
+func NewUI() UI {
+	interactive := false
+	if stat, err := os.Stdin.Stat(); err == nil {
+		interactive = stat.Mode()&os.ModeCharDevice != 0
+	}
+
+	return UI{
+		In:          os.Stdin,
+		Out:         os.Stdout,
+		Interactive: interactive,
+	}
+}
+
+// readLine reads up to the end of the line a byte at a time, so that nothing
+// after it is lost for the next question.
+func (u UI) readLine() (string, error) {
+	var line []byte
+	buffer := make([]byte, 1)
+	for {
+		n, err := u.In.Read(buffer)
+		if n == 1 {
+			if buffer[0] == '\n' {
+				break
+			}
+			line = append(line, buffer[0])
+		}
+		if err == io.EOF && len(line) > 0 {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return strings.TrimSpace(string(line)), nil
+}
+
+// Say prints a line for the user, if there's anywhere to print it.
+func (u UI) Say(format string, args ...interface{}) {
+	if u.Out == nil {
+		return
+	}
+
+	fmt.Fprintf(u.Out, format+"\n", args...)
+}
+
+// Confirm asks a yes/no question, defaulting to no.
+func (u UI) Confirm(question string) (bool, error) {
+	if !u.Interactive {
+		return false, fmt.Errorf("can't ask for confirmation, stdin isn't a terminal")
+	}
+
+	fmt.Fprintf(u.Out, "%s [y/N]: ", question)
+	answer, err := u.readLine()
+	if err != nil {
+		return false, fmt.Errorf("couldn't read answer: %s", err)
+	}
+
+	switch strings.ToLower(answer) {
+	case "y", "yes":
+		return true, nil
+	default:
+		return false, nil
+	}
+}
+
+// AskInt asks for a number until it gets one that check accepts. An empty
+// answer means defaultValue.
+func (u UI) AskInt(question string, defaultValue int, check func(int) error) (int, error) {
+	for {
+		fmt.Fprintf(u.Out, "%s [%d]: ", question, defaultValue)
+		answer, err := u.readLine()
+		if err != nil {
+			return 0, fmt.Errorf("couldn't read answer: %s", err)
+		}
+
+		value := defaultValue
+		if answer != "" {
+			value, err = strconv.Atoi(answer)
+			if err != nil {
+				u.Say("%s isn't a number", answer)
+				continue
+			}
+		}
+
+		if err := check(value); err != nil {
+			u.Say("%s", err)
+			continue
+		}
+
+		return value, nil
+	}
+}
+
+// AskBool asks a yes/no question until it gets an answer. An empty answer
+// means defaultValue.
+func (u UI) AskBool(question string, defaultValue bool) (bool, error) {
+	choices := "y/N"
+	if defaultValue {
+		choices = "Y/n"
+	}
+
+	for {
+		fmt.Fprintf(u.Out, "%s [%s]: ", question, choices)
+		answer, err := u.readLine()
+		if err != nil {
+			return false, fmt.Errorf("couldn't read answer: %s", err)
+		}
+
+		switch strings.ToLower(answer) {
+		case "":
+			return defaultValue, nil
+		case "y", "yes":
+			return true, nil
+		case "n", "no":
+			return false, nil
+		default:
+			u.Say("answer yes or no")
+		}
+	}
+}
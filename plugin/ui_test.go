@@ -0,0 +1,104 @@
+package plugin_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+
+	"github.com/phopper-pivotal/autoscaling-cli-plugin/plugin"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("UI", func() {
+	Describe("Confirm", func() {
+		var out *bytes.Buffer
+
+		BeforeEach(func() {
+			out = &bytes.Buffer{}
+		})
+
+		It("asks the question and accepts yes", func() {
+			ui := plugin.UI{In: strings.NewReader("Yes\n"), Out: out, Interactive: true}
+
+			Expect(ui.Confirm("Really?")).To(BeTrue())
+			Expect(out.String()).To(Equal("Really? [y/N]: "))
+		})
+
+		It("defaults to no", func() {
+			ui := plugin.UI{In: strings.NewReader("\n"), Out: out, Interactive: true}
+
+			Expect(ui.Confirm("Really?")).To(BeFalse())
+		})
+
+		It("accepts an answer without a newline", func() {
+			ui := plugin.UI{In: strings.NewReader("y"), Out: out, Interactive: true}
+
+			Expect(ui.Confirm("Really?")).To(BeTrue())
+		})
+
+		It("only reads its own answer", func() {
+			in := strings.NewReader("n\ny\n")
+			ui := plugin.UI{In: in, Out: out, Interactive: true}
+
+			Expect(ui.Confirm("Really?")).To(BeFalse())
+			Expect(ui.Confirm("Really?")).To(BeTrue())
+		})
+
+		It("fails when there's nothing to read", func() {
+			ui := plugin.UI{In: strings.NewReader(""), Out: out, Interactive: true}
+
+			_, err := ui.Confirm("Really?")
+			Expect(err).To(MatchError("couldn't read answer: EOF"))
+		})
+
+		It("fails when it isn't interactive", func() {
+			ui := plugin.UI{In: strings.NewReader("y\n"), Out: out}
+
+			_, err := ui.Confirm("Really?")
+			Expect(err).To(MatchError("can't ask for confirmation, stdin isn't a terminal"))
+			Expect(out.String()).To(BeEmpty())
+		})
+	})
+
+	Describe("AskInt", func() {
+		It("asks until it gets a valid number", func() {
+			out := &bytes.Buffer{}
+			ui := plugin.UI{In: strings.NewReader("ten\n-1\n10\n"), Out: out, Interactive: true}
+
+			value, err := ui.AskInt("How many?", 5, func(n int) error {
+				if n < 0 {
+					return errors.New("too few")
+				}
+				return nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(value).To(Equal(10))
+			Expect(out.String()).To(Equal("How many? [5]: ten isn't a number\nHow many? [5]: too few\nHow many? [5]: "))
+		})
+
+		It("defaults to the given value", func() {
+			ui := plugin.UI{In: strings.NewReader("\n"), Out: &bytes.Buffer{}, Interactive: true}
+
+			Expect(ui.AskInt("How many?", 5, func(int) error { return nil })).To(Equal(5))
+		})
+	})
+
+	Describe("AskBool", func() {
+		It("asks until it gets yes or no", func() {
+			out := &bytes.Buffer{}
+			ui := plugin.UI{In: strings.NewReader("maybe\nno\n"), Out: out, Interactive: true}
+
+			Expect(ui.AskBool("Enabled?", true)).To(BeFalse())
+			Expect(out.String()).To(Equal("Enabled? [Y/n]: answer yes or no\nEnabled? [Y/n]: "))
+		})
+
+		It("defaults to the given value", func() {
+			ui := plugin.UI{In: strings.NewReader("\n\n"), Out: &bytes.Buffer{}, Interactive: true}
+
+			Expect(ui.AskBool("Enabled?", true)).To(BeTrue())
+			Expect(ui.AskBool("Enabled?", false)).To(BeFalse())
+		})
+	})
+})
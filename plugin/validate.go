@@ -0,0 +1,138 @@
+package plugin
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	MinCPUThreshold = 1
+	MaxCPUThreshold = 100
+
+	// MinThresholdGap keeps the thresholds far enough apart that scaling down
+	// doesn't immediately push the app back over the max threshold
+	MinThresholdGap = 10
+)
+
+// ValidationErrors lists every problem found with a binding.
+type ValidationErrors []string
+
+func (e ValidationErrors) Error() string {
+	if len(e) == 1 {
+		return e[0]
+	}
+
+	return fmt.Sprintf("invalid autoscaling settings:\n  - %s", strings.Join(e, "\n  - "))
+}
+
+// InstanceQuota is the app instance limit of a space or org quota. A limit of
+// -1 means unlimited.
+type InstanceQuota struct {
+	Description string
+	Limit       int
+}
+
+func ValidateBinding(binding AutoscalingBinding, quotas []InstanceQuota) error {
+	var errs ValidationErrors
+
+	if binding.MinInstances < 1 {
+		errs = append(errs, "min instances must be >= 1")
+	}
+
+	if binding.MinInstances > binding.MaxInstances {
+		errs = append(errs, "min instances must be <= max instances")
+	}
+
+	for _, quota := range quotas {
+		if quota.Limit >= 0 && binding.MaxInstances > quota.Limit {
+			errs = append(errs, fmt.Sprintf("max instances (%d) exceeds the app instance limit of %d in %s", binding.MaxInstances, quota.Limit, quota.Description))
+		}
+	}
+
+	thresholdsInRange := true
+	if binding.CPUMinThreshold < MinCPUThreshold || binding.CPUMinThreshold > MaxCPUThreshold {
+		errs = append(errs, fmt.Sprintf("CPU min threshold must be between %d and %d", MinCPUThreshold, MaxCPUThreshold))
+		thresholdsInRange = false
+	}
+
+	if binding.CPUMaxThreshold < MinCPUThreshold || binding.CPUMaxThreshold > MaxCPUThreshold {
+		errs = append(errs, fmt.Sprintf("CPU max threshold must be between %d and %d", MinCPUThreshold, MaxCPUThreshold))
+		thresholdsInRange = false
+	}
+
+	if binding.CPUMinThreshold > binding.CPUMaxThreshold {
+		errs = append(errs, "CPU min threshold must be <= CPU max threshold")
+	} else if thresholdsInRange && binding.CPUMaxThreshold-binding.CPUMinThreshold < MinThresholdGap {
+		errs = append(errs, fmt.Sprintf("CPU thresholds must be at least %d apart to prevent flapping", MinThresholdGap))
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+// fetchInstanceQuotas returns the app instance limits of the quotas that
+// apply to the app's space and org.
+func fetchInstanceQuotas(dependencies CLIDependencies) ([]InstanceQuota, error) {
+	var quotas []InstanceQuota
+
+	var space struct {
+		Entity struct {
+			Name                     string `json:"name"`
+			OrganizationGUID         string `json:"organization_guid"`
+			SpaceQuotaDefinitionGUID string `json:"space_quota_definition_guid"`
+		} `json:"entity"`
+	}
+
+	err := getCCResource(dependencies, fmt.Sprintf("/v2/spaces/%s", dependencies.App.SpaceGuid), &space)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't retrieve space: %s", err)
+	}
+
+	type quotaDefinition struct {
+		Entity struct {
+			Name             string `json:"name"`
+			AppInstanceLimit int    `json:"app_instance_limit"`
+		} `json:"entity"`
+	}
+
+	if space.Entity.SpaceQuotaDefinitionGUID != "" {
+		var spaceQuota quotaDefinition
+		err := getCCResource(dependencies, fmt.Sprintf("/v2/space_quota_definitions/%s", space.Entity.SpaceQuotaDefinitionGUID), &spaceQuota)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't retrieve space quota: %s", err)
+		}
+
+		quotas = append(quotas, InstanceQuota{
+			Description: fmt.Sprintf("space quota %s of space %s", spaceQuota.Entity.Name, space.Entity.Name),
+			Limit:       spaceQuota.Entity.AppInstanceLimit,
+		})
+	}
+
+	var org struct {
+		Entity struct {
+			Name                string `json:"name"`
+			QuotaDefinitionGUID string `json:"quota_definition_guid"`
+		} `json:"entity"`
+	}
+
+	err = getCCResource(dependencies, fmt.Sprintf("/v2/organizations/%s", space.Entity.OrganizationGUID), &org)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't retrieve org: %s", err)
+	}
+
+	var orgQuota quotaDefinition
+	err = getCCResource(dependencies, fmt.Sprintf("/v2/quota_definitions/%s", org.Entity.QuotaDefinitionGUID), &orgQuota)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't retrieve org quota: %s", err)
+	}
+
+	quotas = append(quotas, InstanceQuota{
+		Description: fmt.Sprintf("quota %s of org %s", orgQuota.Entity.Name, org.Entity.Name),
+		Limit:       orgQuota.Entity.AppInstanceLimit,
+	})
+
+	return quotas, nil
+}
@@ -0,0 +1,73 @@
+package plugin_test
+
+import (
+	"github.com/phopper-pivotal/autoscaling-cli-plugin/plugin"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ValidateBinding", func() {
+	var binding plugin.AutoscalingBinding
+
+	BeforeEach(func() {
+		binding = plugin.AutoscalingBinding{
+			MinInstances:    2,
+			MaxInstances:    10,
+			CPUMinThreshold: 20,
+			CPUMaxThreshold: 80,
+		}
+	})
+
+	It("accepts sane settings", func() {
+		Expect(plugin.ValidateBinding(binding, nil)).To(Succeed())
+	})
+
+	It("requires at least one instance", func() {
+		binding.MinInstances = 0
+
+		Expect(plugin.ValidateBinding(binding, nil)).To(MatchError("min instances must be >= 1"))
+	})
+
+	It("requires CPU thresholds to be percentages", func() {
+		binding.CPUMaxThreshold = 500
+
+		Expect(plugin.ValidateBinding(binding, nil)).To(MatchError("CPU max threshold must be between 1 and 100"))
+	})
+
+	It("requires a min threshold of at least 1", func() {
+		binding.CPUMinThreshold = 0
+
+		Expect(plugin.ValidateBinding(binding, nil)).To(MatchError("CPU min threshold must be between 1 and 100"))
+	})
+
+	It("requires a gap between the thresholds", func() {
+		binding.CPUMinThreshold = 75
+
+		Expect(plugin.ValidateBinding(binding, nil)).To(MatchError("CPU thresholds must be at least 10 apart to prevent flapping"))
+	})
+
+	It("checks max instances against the quotas", func() {
+		quotas := []plugin.InstanceQuota{
+			{Description: "space quota small of space dev", Limit: 8},
+			{Description: "quota default of org org", Limit: -1},
+		}
+
+		Expect(plugin.ValidateBinding(binding, quotas)).To(MatchError("max instances (10) exceeds the app instance limit of 8 in space quota small of space dev"))
+	})
+
+	It("lists every violation", func() {
+		binding.MinInstances = 0
+		binding.MaxInstances = 10000
+		binding.CPUMinThreshold = -1
+		binding.CPUMaxThreshold = 500
+
+		err := plugin.ValidateBinding(binding, []plugin.InstanceQuota{{Description: "quota default of org org", Limit: 100}})
+		Expect(err).To(MatchError(`invalid autoscaling settings:
+  - min instances must be >= 1
+  - max instances (10000) exceeds the app instance limit of 100 in quota default of org org
+  - CPU min threshold must be between 1 and 100
+  - CPU max threshold must be between 1 and 100`))
+		Expect(err).To(HaveLen(4))
+	})
+})
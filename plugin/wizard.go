@@ -0,0 +1,189 @@
+package plugin
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ChooseAutoscalerService asks which of the autoscaler service instances
+// bound to the app to configure, unless there is only one.
+func ChooseAutoscalerService(cliConnection cliConnection, ui UI, appName string) (string, error) {
+	app, err := cliConnection.GetApp(appName)
+	if err != nil {
+		return "", fmt.Errorf("couldn't get app %s: %s", appName, err)
+	}
+
+	names, err := findAutoscalerServices(cliConnection, app.Services)
+	if err != nil {
+		return "", err
+	}
+
+	switch len(names) {
+	case 0:
+		return "", fmt.Errorf("no %s service instances are bound to %s", strings.Join(autoscalerServiceOfferings(), " or "), appName)
+	case 1:
+		ui.Say("Using service instance %s", names[0])
+		return names[0], nil
+	}
+
+	ui.Say("Service instances bound to %s:", appName)
+	for i, name := range names {
+		ui.Say("  %d. %s", i+1, name)
+	}
+
+	choice, err := ui.AskInt("Service instance", 1, func(choice int) error {
+		if choice < 1 || choice > len(names) {
+			return fmt.Errorf("choose a service instance from 1 to %d", len(names))
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return names[choice-1], nil
+}
+
+// RunWizard asks for each setting, defaulting to the binding's current
+// settings updated with flags, and applies them once the user has seen and
+// confirmed the changes and their risks. Each answer is validated as it is
+// given, with the settings that haven't been asked for yet treated as
+// permissively as possible. It fails with a ConflictError when the binding
+// changed while the questions were answered.
+func (p *Plugin) RunWizard(dependencies CLIDependencies, flags Flags) error {
+	ui := dependencies.UI
+	if !ui.Interactive {
+		return fmt.Errorf("--interactive needs a terminal to ask questions on")
+	}
+
+	current, err := p.fetchBinding(dependencies)
+	if err != nil {
+		return err
+	}
+
+	var quotas []InstanceQuota
+	if dependencies.App.SpaceGuid != "" {
+		quotas, err = fetchInstanceQuotas(dependencies)
+		if err != nil {
+			return err
+		}
+	}
+
+	ui.Say("Current settings of %s to %s:", dependencies.AppName, dependencies.ServiceName)
+	ui.Say("  enabled:         %t", current.Binding.Enabled)
+	ui.Say("  instance limits: %d - %d", current.Binding.MinInstances, current.Binding.MaxInstances)
+	ui.Say("  cpu thresholds:  %d%% - %d%%", current.Binding.CPUMinThreshold, current.Binding.CPUMaxThreshold)
+	ui.Say("")
+
+	binding := flags.Apply(current.Binding)
+
+	binding.MinInstances, err = ui.AskInt("Min instances", binding.MinInstances, func(n int) error {
+		return ValidateBinding(AutoscalingBinding{MinInstances: n, MaxInstances: n, CPUMinThreshold: MinCPUThreshold, CPUMaxThreshold: MaxCPUThreshold}, nil)
+	})
+	if err != nil {
+		return err
+	}
+
+	binding.MaxInstances, err = ui.AskInt("Max instances", binding.MaxInstances, func(n int) error {
+		return ValidateBinding(AutoscalingBinding{MinInstances: binding.MinInstances, MaxInstances: n, CPUMinThreshold: MinCPUThreshold, CPUMaxThreshold: MaxCPUThreshold}, quotas)
+	})
+	if err != nil {
+		return err
+	}
+
+	binding.CPUMinThreshold, err = ui.AskInt("CPU min threshold %", binding.CPUMinThreshold, func(n int) error {
+		return ValidateBinding(AutoscalingBinding{MinInstances: binding.MinInstances, MaxInstances: binding.MaxInstances, CPUMinThreshold: n, CPUMaxThreshold: MaxCPUThreshold}, quotas)
+	})
+	if err != nil {
+		return err
+	}
+
+	binding.CPUMaxThreshold, err = ui.AskInt("CPU max threshold %", binding.CPUMaxThreshold, func(n int) error {
+		candidate := binding
+		candidate.CPUMaxThreshold = n
+		return ValidateBinding(candidate, quotas)
+	})
+	if err != nil {
+		return err
+	}
+
+	binding.Enabled, err = ui.AskBool("Enable autoscaling?", binding.Enabled)
+	if err != nil {
+		return err
+	}
+
+	changes := DiffBindings(current.Binding, binding)
+	if len(changes) == 0 {
+		ui.Say("Nothing to change.")
+		return nil
+	}
+
+	ui.Say("")
+	ui.Say("Changes:")
+	for _, change := range changes {
+		ui.Say("  %s", change)
+	}
+
+	if flags.GuardrailsFile != "" {
+		guardrails, err := LoadGuardrails(flags.GuardrailsFile)
+		if err != nil {
+			return err
+		}
+		dependencies.Guardrails = guardrails
+	}
+
+	productionSpace, err := productionSpacePattern()
+	if err != nil {
+		return err
+	}
+
+	// the confirmation doubles as the risk prompt, and the settings are
+	// posted on top of the binding the questions started from, so changes
+	// made in the meantime are reported rather than overwritten
+	confirm := func(current, updated AutoscalingBinding) error {
+		for _, risk := range DetectRisks(current, updated, dependencies.App.RunningInstances, dependencies.SpaceName, productionSpace) {
+			ui.Say("Warning: %s", risk)
+		}
+
+		confirmed, err := ui.Confirm("Apply these settings?")
+		if err != nil {
+			return err
+		}
+
+		if !confirmed {
+			return fmt.Errorf("cancelled, the settings weren't changed")
+		}
+
+		return nil
+	}
+
+	binding.AppGuid = dependencies.App.Guid
+
+	if err := postBinding(dependencies, current, binding, confirm); err != nil {
+		return err
+	}
+
+	return scaleIntoLimits(dependencies, binding, flags.ScaleNow)
+}
+
+func (p *Plugin) runWizard(cliConnection cliConnection, flags Flags, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("provide APP_NAME on command line")
+	}
+
+	if len(args) == 1 {
+		serviceName, err := ChooseAutoscalerService(cliConnection, NewUI(), args[0])
+		if err != nil {
+			return err
+		}
+
+		args = append(args, serviceName)
+	}
+
+	dependencies, err := p.FetchCLIDependencies(cliConnection, args)
+	if err != nil {
+		return err
+	}
+
+	return p.RunWizard(dependencies, flags)
+}
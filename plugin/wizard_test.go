@@ -0,0 +1,222 @@
+package plugin_test
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"strings"
+
+	"code.cloudfoundry.org/cli/plugin/models"
+	"github.com/phopper-pivotal/autoscaling-cli-plugin/mocks"
+	"github.com/phopper-pivotal/autoscaling-cli-plugin/plugin"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Wizard", func() {
+	Describe("ChooseAutoscalerService", func() {
+		var (
+			cliConnection *mocks.CLIConnection
+			out           *bytes.Buffer
+		)
+
+		BeforeEach(func() {
+			cliConnection = &mocks.CLIConnection{}
+			cliConnection.GetAppCall.Returns.App.Services = []plugin_models.GetApp_ServiceSummary{
+				{Name: "some-database"},
+				{Name: "scaler"},
+				{Name: "other-scaler"},
+			}
+
+			database := plugin_models.GetService_Model{}
+			database.ServiceOffering.Name = "p-mysql"
+			autoscaler := plugin_models.GetService_Model{}
+			autoscaler.ServiceOffering.Name = "app-autoscaler"
+
+			cliConnection.GetServiceCall.Returns.ServicesByName = map[string]plugin_models.GetService_Model{
+				"some-database": database,
+				"scaler":        autoscaler,
+				"other-scaler":  autoscaler,
+			}
+
+			out = &bytes.Buffer{}
+		})
+
+		It("asks which autoscaler to use when there are several", func() {
+			ui := plugin.UI{In: strings.NewReader("5\n2\n"), Out: out, Interactive: true}
+
+			Expect(plugin.ChooseAutoscalerService(cliConnection, ui, "app-name")).To(Equal("other-scaler"))
+			Expect(cliConnection.GetAppCall.Receives.AppName).To(Equal("app-name"))
+			Expect(out.String()).To(Equal(`Service instances bound to app-name:
+  1. scaler
+  2. other-scaler
+Service instance [1]: choose a service instance from 1 to 2
+Service instance [1]: `))
+		})
+
+		It("uses the only autoscaler without asking", func() {
+			cliConnection.GetAppCall.Returns.App.Services = cliConnection.GetAppCall.Returns.App.Services[:2]
+			ui := plugin.UI{Out: out}
+
+			Expect(plugin.ChooseAutoscalerService(cliConnection, ui, "app-name")).To(Equal("scaler"))
+			Expect(out.String()).To(Equal("Using service instance scaler\n"))
+		})
+
+		Context("failure cases", func() {
+			It("fails when no autoscaler is bound to the app", func() {
+				cliConnection.GetAppCall.Returns.App.Services = cliConnection.GetAppCall.Returns.App.Services[:1]
+
+				_, err := plugin.ChooseAutoscalerService(cliConnection, plugin.UI{}, "app-name")
+				Expect(err).To(MatchError("no app-autoscaler or autoscaler service instances are bound to app-name"))
+			})
+
+			It("fails when the app can't be retrieved", func() {
+				cliConnection.GetAppCall.Returns.Error = errors.New("some error")
+
+				_, err := plugin.ChooseAutoscalerService(cliConnection, plugin.UI{}, "app-name")
+				Expect(err).To(MatchError("couldn't get app app-name: some error"))
+			})
+		})
+	})
+
+	Describe("RunWizard", func() {
+		var (
+			p            *plugin.Plugin
+			jsonClient   *mocks.JSONClient
+			dependencies plugin.CLIDependencies
+			out          *bytes.Buffer
+		)
+
+		BeforeEach(func() {
+			p = plugin.NewPlugin()
+			jsonClient = mocks.NewJSONClient(5)
+			bindings := `{"Resources": [{"Metadata": {"GUID": "some-service-binding-guid"}}]}`
+			binding := `{"min_instances": 3, "max_instances": 7, "cpu_min_threshold": 20, "cpu_max_threshold": 80, "enabled": false}`
+			jsonClient.DoCalls[0].ResponseJSON = bindings
+			jsonClient.DoCalls[1].ResponseJSON = binding
+			jsonClient.DoCalls[1].Returns.Headers = http.Header{"Etag": []string{`"some-version"`}}
+
+			out = &bytes.Buffer{}
+			dependencies = plugin.CLIDependencies{
+				AppName:     "app-name",
+				ServiceName: "service-name",
+				Service: plugin_models.GetService_Model{
+					Guid:         "some-service-instance-guid",
+					DashboardUrl: "http://autoscaling.example.com/something-that-doesnot-matter",
+				},
+				APIEndpoint: "https://cloudcontroller.example.com",
+				App: plugin_models.GetAppModel{
+					Guid: "some-app-guid",
+				},
+				JSONClient: jsonClient,
+				UI:         plugin.UI{Out: out, Interactive: true},
+			}
+		})
+
+		It("asks for each setting, validating the answers, and applies them once confirmed", func() {
+			dependencies.UI.In = strings.NewReader("\n1\n12\n\n25\n70\n\ny\n")
+
+			Expect(p.RunWizard(dependencies, plugin.Flags{})).To(Succeed())
+			Expect(out.String()).To(Equal(`Current settings of app-name to service-name:
+  enabled:         false
+  instance limits: 3 - 7
+  cpu thresholds:  20% - 80%
+
+Min instances [3]: Max instances [7]: min instances must be <= max instances
+Max instances [7]: CPU min threshold % [20]: CPU max threshold % [80]: CPU thresholds must be at least 10 apart to prevent flapping
+CPU max threshold % [80]: Enable autoscaling? [Y/n]: 
+Changes:
+  max_instances: 7 -> 12
+  cpu_max_threshold: 80 -> 70
+  enabled: false -> true
+Apply these settings? [y/N]: `))
+
+			Expect(jsonClient.DoCalls[2].Receives.Method).To(Equal("POST"))
+			Expect(jsonClient.DoCalls[2].Receives.Headers.Get("If-Match")).To(Equal(`"some-version"`))
+			Expect(jsonClient.DoCalls[2].Receives.RequestData).To(Equal(&plugin.AutoscalingBinding{
+				AppGuid:         "some-app-guid",
+				MinInstances:    3,
+				MaxInstances:    12,
+				CPUMinThreshold: 20,
+				CPUMaxThreshold: 70,
+				Enabled:         true,
+			}))
+		})
+
+		It("defaults to the settings given as flags", func() {
+			dependencies.UI.In = strings.NewReader("\n\n\n\n\ny\n")
+
+			Expect(p.RunWizard(dependencies, plugin.Flags{MaxInstances: intPtr(10)})).To(Succeed())
+			Expect(out.String()).To(ContainSubstring("Max instances [10]: "))
+			Expect(jsonClient.DoCalls[2].Receives.RequestData).To(Equal(&plugin.AutoscalingBinding{
+				AppGuid:         "some-app-guid",
+				MinInstances:    3,
+				MaxInstances:    10,
+				CPUMinThreshold: 20,
+				CPUMaxThreshold: 80,
+				Enabled:         true,
+			}))
+		})
+
+		It("warns about risky changes in the preview", func() {
+			dependencies.App.RunningInstances = 6
+			dependencies.UI.In = strings.NewReader("2\n4\n\n\n\ny\n")
+
+			Expect(p.RunWizard(dependencies, plugin.Flags{})).To(Succeed())
+			Expect(out.String()).To(ContainSubstring("Warning: max instances (4) is below the 6 instances currently running\n"))
+			Expect(jsonClient.DoCalls[2].Receives.Method).To(Equal("POST"))
+		})
+
+		It("doesn't post when nothing changed", func() {
+			dependencies.UI.In = strings.NewReader("\n\n\n\nn\n")
+
+			Expect(p.RunWizard(dependencies, plugin.Flags{})).To(Succeed())
+			Expect(out.String()).To(HaveSuffix("Nothing to change.\n"))
+			Expect(jsonClient.DoCalls[2].Receives.Method).To(BeEmpty())
+		})
+
+		Context("failure cases", func() {
+			It("doesn't post when the user declines", func() {
+				dependencies.UI.In = strings.NewReader("\n\n\n\n\nn\n")
+
+				Expect(p.RunWizard(dependencies, plugin.Flags{})).To(MatchError("cancelled, the settings weren't changed"))
+				Expect(jsonClient.DoCalls[2].Receives.Method).To(BeEmpty())
+			})
+
+			It("reports changes made while the questions were answered", func() {
+				dependencies.UI.In = strings.NewReader("\n\n\n\n\ny\n")
+				jsonClient.DoCalls[2].ResponseJSON = "{}"
+				jsonClient.DoCalls[2].Returns.Error = plugin.UnexpectedResponseError{StatusCode: http.StatusPreconditionFailed, Status: "412 Precondition Failed"}
+				jsonClient.DoCalls[3].ResponseJSON = `{"min_instances": 5, "max_instances": 7, "cpu_min_threshold": 20, "cpu_max_threshold": 80, "enabled": false}`
+
+				err := p.RunWizard(dependencies, plugin.Flags{})
+				Expect(err).To(BeAssignableToTypeOf(plugin.ConflictError{}))
+				Expect(err.(plugin.ConflictError).Changes).To(Equal([]plugin.FieldChange{{Field: "min_instances", From: "3", To: "5"}}))
+				Expect(jsonClient.DoCallCount).To(Equal(4))
+			})
+
+			It("asks before applying a risky change even though it was previewed", func() {
+				dependencies.App.RunningInstances = 6
+				dependencies.UI.In = strings.NewReader("2\n4\n\n\n\nn\n")
+
+				Expect(p.RunWizard(dependencies, plugin.Flags{})).To(MatchError("cancelled, the settings weren't changed"))
+				Expect(out.String()).To(HaveSuffix("Warning: max instances (4) is below the 6 instances currently running\nApply these settings? [y/N]: "))
+				Expect(jsonClient.DoCalls[2].Receives.Method).To(BeEmpty())
+			})
+
+			It("fails when the answers run out", func() {
+				dependencies.UI.In = strings.NewReader("\n")
+
+				Expect(p.RunWizard(dependencies, plugin.Flags{})).To(MatchError("couldn't read answer: EOF"))
+			})
+
+			It("fails when it isn't interactive", func() {
+				dependencies.UI.Interactive = false
+
+				Expect(p.RunWizard(dependencies, plugin.Flags{})).To(MatchError("--interactive needs a terminal to ask questions on"))
+				Expect(jsonClient.DoCalls[0].Receives.Method).To(BeEmpty())
+			})
+		})
+	})
+})